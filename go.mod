@@ -2,10 +2,14 @@ module github.com/LubyRuffy/aic
 
 go 1.21
 
-require github.com/fatih/color v1.18.0
-
 require (
-	github.com/mattn/go-colorable v0.1.13 // indirect
-	github.com/mattn/go-isatty v0.0.20 // indirect
-	golang.org/x/sys v0.25.0 // indirect
+	github.com/creack/pty v1.1.24
+	github.com/fatih/color v1.18.0
+	github.com/mattn/go-isatty v0.0.20
+	golang.org/x/crypto v0.28.0
+	golang.org/x/sys v0.26.0
+	golang.org/x/term v0.25.0
+	gopkg.in/yaml.v3 v3.0.1
 )
+
+require github.com/mattn/go-colorable v0.1.13 // indirect
@@ -0,0 +1,178 @@
+package cli
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/LubyRuffy/aic/pkg/agent"
+	"github.com/LubyRuffy/aic/pkg/executor"
+	"github.com/LubyRuffy/aic/pkg/history"
+	"github.com/LubyRuffy/aic/pkg/injection"
+	"github.com/LubyRuffy/aic/pkg/ollama"
+	"github.com/LubyRuffy/aic/pkg/pipeline"
+	"github.com/LubyRuffy/aic/pkg/remote"
+	"github.com/LubyRuffy/aic/pkg/safety"
+	"github.com/LubyRuffy/aic/pkg/session"
+)
+
+// Limits of the agent mode
+const (
+	defaultAgentSteps = 8
+	agentStepTimeout  = 30 * time.Second
+)
+
+// runAgent lets the model investigate the prompt by running read-only commands,
+// feeding their truncated output back through the chat API until it answers or the step budget is used
+func (a *App) runAgent(opts *options, prompt, stdinContext string) int {
+	if opts.continueSession || opts.plan || opts.dryRun || opts.printOnly {
+		a.err.Error("Error: --agent cannot be combined with --continue, --plan, --dry-run or --print-only\n")
+		return ExitError
+	}
+	if opts.maxSteps < 1 {
+		a.err.Error("Error: --max-steps must be at least 1\n")
+		return ExitError
+	}
+
+	request := prompt
+	if stdinContext != "" {
+		stdinContext = session.Truncate(stdinContext, maxStdinContext)
+		a.scanContext("piped input", stdinContext)
+		request = ollama.PromptWithContext(prompt, stdinContext)
+	}
+	client := a.newClient(opts)
+	messages := []ollama.Message{{Role: ollama.RoleUser, Content: request}}
+	entry := &history.Entry{Time: time.Now(), Kind: history.KindAgent, Prompt: prompt, Model: opts.model}
+
+	err := a.agentLoop(opts, client, entry, &messages, stdinContext != "")
+	entry.Transcript = messages
+	if err != nil {
+		entry.Error = err.Error()
+	}
+	a.saveHistory(opts, entry)
+
+	if err != nil {
+		a.err.Error("Error: %v\n", err)
+		return ExitError
+	}
+	if opts.output == outputJSON {
+		enc := json.NewEncoder(a.Stdout)
+		enc.SetIndent("", "  ")
+		_ = enc.Encode(entry)
+		return ExitOK
+	}
+	fmt.Fprintln(a.Stdout, entry.Answer)
+	return ExitOK
+}
+
+// agentLoop runs the steps of the agent, recording them in entry and the conversation in messages,
+// untrusted is set when the model was given piped data, so that its commands are checked for prompt injection from the start
+func (a *App) agentLoop(opts *options, client *ollama.Client, entry *history.Entry, messages *[]ollama.Message, untrusted bool) error {
+	for step := 1; ; step++ {
+		final := step > opts.maxSteps
+		if final {
+			*messages = append(*messages, ollama.Message{Role: ollama.RoleUser, Content: agent.BudgetExhausted})
+		}
+
+		response, err := client.Agent(opts.model, *messages)
+		if err != nil {
+			return err
+		}
+		*messages = append(*messages, ollama.Message{Role: ollama.RoleAssistant, Content: response})
+
+		action, err := agent.ParseAction(response)
+		if err == nil && action.Answer != "" {
+			entry.Answer = action.Answer
+			return nil
+		}
+		if final {
+			return fmt.Errorf("no answer within %d steps", opts.maxSteps)
+		}
+		if err != nil {
+			if opts.verbose {
+				a.err.Warning("Invalid response: %v\n", err)
+			}
+			*messages = append(*messages, ollama.Message{Role: ollama.RoleUser, Content: agent.Invalid(err)})
+			continue
+		}
+
+		// Only read-only commands pass the safety gate, and once the model has seen data the user did not write,
+		// only commands that do not reach hosts unrelated to the question
+		command := safety.Sanitize(action.Command)
+		ok, reason := safety.ReadOnly(command)
+		if ok && untrusted {
+			if reasons := injection.CheckCommand(command, entry.Prompt); len(reasons) > 0 {
+				ok, reason = false, "possible prompt injection, "+strings.Join(reasons, "; ")
+			}
+		}
+		if !ok {
+			a.err.Warning("[%d/%d] Rejected: %s (%s)\n", step, opts.maxSteps, command, reason)
+			entry.Steps = append(entry.Steps, history.Step{Command: command, Reason: action.Reason, Rejected: reason})
+			*messages = append(*messages, ollama.Message{Role: ollama.RoleUser, Content: agent.Rejected(command, reason)})
+			continue
+		}
+
+		a.err.Info("[%d/%d] $ %s\n", step, opts.maxSteps, command)
+		if opts.verbose && action.Reason != "" {
+			a.err.Info("        %s\n", action.Reason)
+		}
+		exitCode, output := a.observe(opts, entry.Prompt, command)
+		a.scanContext("output of "+command, output)
+		untrusted = true
+		entry.Steps = append(entry.Steps, history.Step{Command: command, Reason: action.Reason, ExitCode: exitCode, Output: output})
+		*messages = append(*messages, ollama.Message{Role: ollama.RoleUser, Content: agent.Observation(command, exitCode, output)})
+	}
+}
+
+// observe runs a read-only command of the agent without a terminal and returns its exit code and truncated output
+func (a *App) observe(opts *options, prompt, command string) (int, string) {
+	var stdout, stderr io.Writer = io.Discard, io.Discard
+	if opts.verbose {
+		stdout, stderr = a.Stderr, a.Stderr
+	}
+
+	// The model only sees the captured output, so commands get neither stdin nor a terminal
+	exec := a.newExecutor(opts, stdout, stderr)
+	switch exec := exec.(type) {
+	case *executor.ShellExecutor:
+		exec.Stdin = nil
+		exec.PTY = false
+		if exec.Timeout == 0 {
+			exec.Timeout = agentStepTimeout
+		}
+	case *remote.Executor:
+		exec.Stdin = nil
+		if exec.Timeout == 0 {
+			exec.Timeout = agentStepTimeout
+		}
+	}
+
+	report := safety.Analyze(command)
+	result := &pipeline.Result{Prompt: prompt, Command: command, Model: opts.model, Risk: report.Risk, Explanation: report.Explanation(), Report: report}
+	execResult, err := a.executeWith(opts, exec, result)
+
+	output := session.Truncate(capturedOutput(execResult), session.MaxOutputSnippet)
+	var exitErr *executor.ExitError
+	if err != nil && !errors.As(err, &exitErr) {
+		return -1, fmt.Sprintf("error running command: %v", err)
+	}
+	if execResult == nil {
+		return -1, output
+	}
+	return execResult.ExitCode, output
+}
+
+// saveHistory appends entry to the history, failures are only reported in verbose mode
+func (a *App) saveHistory(opts *options, entry *history.Entry) {
+	dir, err := a.configDir()
+	if err == nil {
+		err = history.Append(filepath.Join(dir, history.FileName), entry)
+	}
+	if err != nil && opts.verbose {
+		a.err.Warning("Failed to save history: %v\n", err)
+	}
+}
@@ -0,0 +1,239 @@
+package cli
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/LubyRuffy/aic/pkg/alias"
+	"github.com/LubyRuffy/aic/pkg/pipeline"
+	"github.com/LubyRuffy/aic/pkg/safety"
+	"github.com/LubyRuffy/aic/pkg/session"
+)
+
+// runSave runs `aic save <name>`, which saves the last executed command under name
+func (a *App) runSave(opts *options, args []string) int {
+	if len(args) != 1 {
+		a.err.Warning("Usage: aic save <name>\n")
+		return ExitError
+	}
+	name := args[0]
+
+	dir, err := a.configDir()
+	if err != nil {
+		a.err.Error("Error: %v\n", err)
+		return ExitError
+	}
+	sess, err := session.Load(filepath.Join(dir, session.FileName))
+	if err != nil && !errors.Is(err, session.ErrNoSession) {
+		a.err.Error("Error loading session: %v\n", err)
+		return ExitError
+	}
+	if sess == nil || !sess.Executed || sess.Command == "" {
+		a.err.Error("No executed command to save, run a command with aic first\n")
+		return ExitError
+	}
+
+	lib, path, err := a.loadAliases()
+	if err != nil {
+		a.err.Error("Error: %v\n", err)
+		return ExitError
+	}
+	err = lib.Add(&alias.Alias{Name: name, Command: sess.Command, Shell: opts.sh.Name, Created: time.Now()})
+	if err != nil {
+		a.err.Error("Error: %v, remove it first with: aic alias rm %s\n", err, name)
+		return ExitError
+	}
+	if err := lib.Save(path); err != nil {
+		a.err.Error("Error: %v\n", err)
+		return ExitError
+	}
+	a.out.Success("Saved %s: %s\n", name, sess.Command)
+	return ExitOK
+}
+
+// runAlias runs `aic run <name> [args...]`, substituting the arguments quoted for the shell,
+// which is the login shell of the remote user with -host
+func (a *App) runAlias(opts *options, args []string) int {
+	if len(args) == 0 {
+		a.err.Warning("Usage: aic run <name> [args...]\n")
+		return ExitError
+	}
+
+	lib, _, err := a.loadAliases()
+	if err != nil {
+		a.err.Error("Error: %v\n", err)
+		return ExitError
+	}
+	saved, ok := lib.Aliases[args[0]]
+	if !ok {
+		a.err.Error("Alias %q not found, list saved commands with: aic alias list\n", args[0])
+		return ExitError
+	}
+	sh := opts.sh
+	if opts.remote != nil {
+		if sh, err = opts.remote.Shell(); err != nil {
+			a.err.Error("Error: %v\n", err)
+			return ExitError
+		}
+	}
+	if saved.Shell != "" && saved.Shell != sh.Name {
+		a.err.Warning("%s was saved for %s but runs in %s\n", saved.Name, saved.Shell, sh.Name)
+	}
+
+	command, err := alias.Expand(saved.Command, args[1:], sh.Quote)
+	if err != nil {
+		a.err.Error("Error: %s: %v\n", saved.Name, err)
+		return ExitError
+	}
+	report := safety.Analyze(command)
+	result := &pipeline.Result{
+		Prompt:      "aic run " + saved.Name,
+		Command:     command,
+		Risk:        report.Risk,
+		Explanation: report.Explanation(),
+		Report:      report,
+	}
+
+	if opts.printOnly || opts.output == outputJSON {
+		if opts.output == outputJSON {
+			enc := json.NewEncoder(a.Stdout)
+			enc.SetIndent("", "  ")
+			_ = enc.Encode(result)
+		} else {
+			fmt.Fprintln(a.Stdout, command)
+		}
+		return ExitOK
+	}
+	if opts.verbose {
+		a.out.Info("Command: %s\n", command)
+	}
+	if opts.dryRun {
+		a.printDryRun(result)
+		return ExitOK
+	}
+	if !a.confirmRisk(opts, result) {
+		return ExitError
+	}
+
+	if _, err := a.execute(opts, result, a.Stdout, a.Stderr); err != nil {
+		a.err.Error("Error executing command: %v\n", err)
+		return exitCode(err)
+	}
+	return ExitOK
+}
+
+// matchSave reports whether args are a single alias name, so that prompts like "save the logs to a file" are still generated
+func (a *App) matchSave(args []string) bool {
+	return len(args) == 1 && alias.ValidateName(args[0]) == nil
+}
+
+// matchRun reports whether args start with a saved alias, so that prompts like "run the tests" are still generated
+func (a *App) matchRun(args []string) bool {
+	if len(args) == 0 {
+		return true
+	}
+	lib, _, err := a.loadAliases()
+	if err != nil {
+		return true
+	}
+	_, ok := lib.Aliases[args[0]]
+	return ok
+}
+
+// runAliasAdmin runs `aic alias list|rm|export|import`
+func (a *App) runAliasAdmin(_ *options, args []string) int {
+	usage := func() int {
+		a.err.Warning("Usage: aic alias list | rm <name> | export [file] | import <file>\n")
+		return ExitError
+	}
+	if len(args) == 0 {
+		return usage()
+	}
+
+	lib, path, err := a.loadAliases()
+	if err != nil {
+		a.err.Error("Error: %v\n", err)
+		return ExitError
+	}
+
+	switch {
+	case args[0] == "list" && len(args) == 1:
+		for _, name := range lib.Names() {
+			fmt.Fprintf(a.Stdout, "%s\t%s\n", name, lib.Aliases[name].Command)
+		}
+		return ExitOK
+
+	case args[0] == "rm" && len(args) == 2:
+		if _, ok := lib.Aliases[args[1]]; !ok {
+			a.err.Error("Alias %q not found\n", args[1])
+			return ExitError
+		}
+		delete(lib.Aliases, args[1])
+		if err := lib.Save(path); err != nil {
+			a.err.Error("Error: %v\n", err)
+			return ExitError
+		}
+		a.out.Success("Removed %s\n", args[1])
+		return ExitOK
+
+	case args[0] == "export" && len(args) <= 2:
+		var w io.Writer = a.Stdout
+		if len(args) == 2 {
+			f, err := os.Create(args[1])
+			if err != nil {
+				a.err.Error("Error: %v\n", err)
+				return ExitError
+			}
+			defer f.Close()
+			w = f
+		}
+		if err := lib.Export(w); err != nil {
+			a.err.Error("Error exporting aliases: %v\n", err)
+			return ExitError
+		}
+		return ExitOK
+
+	case args[0] == "import" && len(args) == 2:
+		var r io.Reader = a.Stdin
+		if args[1] != "-" {
+			f, err := os.Open(args[1])
+			if err != nil {
+				a.err.Error("Error: %v\n", err)
+				return ExitError
+			}
+			defer f.Close()
+			r = f
+		}
+		added, conflicts, err := lib.Import(r)
+		if err != nil {
+			a.err.Error("Error importing aliases: %v\n", err)
+			return ExitError
+		}
+		if err := lib.Save(path); err != nil {
+			a.err.Error("Error: %v\n", err)
+			return ExitError
+		}
+		a.out.Success("Imported %d alias(es)\n", added)
+		for _, name := range conflicts {
+			a.err.Warning("Skipped %s: an alias with a different command already exists\n", name)
+		}
+		return ExitOK
+	}
+	return usage()
+}
+
+// loadAliases loads the saved commands from the config directory
+func (a *App) loadAliases() (*alias.Library, string, error) {
+	dir, err := a.configDir()
+	if err != nil {
+		return nil, "", err
+	}
+	path := filepath.Join(dir, alias.FileName)
+	lib, err := alias.Load(path)
+	return lib, path, err
+}
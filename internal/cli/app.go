@@ -0,0 +1,544 @@
+package cli
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/LubyRuffy/aic/pkg/color"
+	"github.com/LubyRuffy/aic/pkg/config"
+	"github.com/LubyRuffy/aic/pkg/container"
+	"github.com/LubyRuffy/aic/pkg/executor"
+	"github.com/LubyRuffy/aic/pkg/ollama"
+	"github.com/LubyRuffy/aic/pkg/policy"
+	"github.com/LubyRuffy/aic/pkg/remote"
+	"github.com/LubyRuffy/aic/pkg/sandbox"
+	"github.com/LubyRuffy/aic/pkg/session"
+	"github.com/LubyRuffy/aic/pkg/shell"
+	"github.com/LubyRuffy/aic/pkg/sysinfo"
+	"github.com/mattn/go-isatty"
+)
+
+// Exit codes returned by App.Run, the exit code of an executed command is propagated as is
+const (
+	ExitOK    = 0
+	ExitError = 1
+)
+
+// App is the aic command line application
+type App struct {
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+
+	// Version information shown by -version
+	Version string
+	Commit  string
+	Date    string
+
+	// ConfigDir overrides the directory holding config and session files
+	ConfigDir string
+
+	// NewExecutor creates the executor for generated commands, defaults to a ShellExecutor
+	NewExecutor func(stdout, stderr io.Writer) executor.CommandExecutor
+
+	// PolicyPath overrides the machine-wide policy file, defaults to policy.DefaultPath
+	PolicyPath string
+
+	// SSHConfig overrides the SSH configuration used by -host, defaults to the user's keys and known_hosts
+	SSHConfig *remote.Config
+
+	out *color.Printer
+	err *color.Printer
+	// interactive is true when both stdin and stdout are terminals
+	interactive bool
+}
+
+// options holds the global command line options
+type options struct {
+	model           string
+	verbose         bool
+	ollamaURL       string
+	showVersion     bool
+	continueSession bool
+	printOnly       bool
+	profile         string
+	promptFile      string
+	stdinContext    bool
+	execTimeout     time.Duration
+	noPTY           bool
+	shell           string
+	dryRun          bool
+	output          string
+	yes             bool
+	auditLog        string
+	noCache         bool
+	plan            bool
+	agent           bool
+	maxSteps        int
+	summarize       bool
+	answerOnly      bool
+	host            string
+	containerName   string
+	sandbox         bool
+	snapshot        bool
+	allowSudo       bool
+	noSudo          bool
+
+	// sh is the shell resolved from -shell, used by both the system prompt and the executor
+	sh shell.Shell
+	// remote is the SSH connection to -host, commands are generated for and executed on it
+	remote *remote.Client
+	// container is the -container commands are generated for and executed in
+	container *container.Container
+	// box is the -sandbox commands are executed in
+	box *sandbox.Sandbox
+
+	cfg *config.Config
+	// policy is the machine-wide policy, nil when there is no policy file
+	policy *policy.Policy
+	// modelTimeout limits requests to Ollama, zero waits as long as the model needs
+	modelTimeout time.Duration
+}
+
+// command is a subcommand of aic
+type command struct {
+	name   string
+	args   string
+	hidden bool
+	run    func(a *App, opts *options, args []string) int
+	// match reports whether args are meant for the subcommand rather than being a prompt
+	// starting with its name, subcommands without match always take the arguments
+	match func(a *App, args []string) bool
+}
+
+// commands returns the subcommands, the default action is generating a command from the prompt
+func commands() []command {
+	return []command{
+		{name: "shell-init", args: "<shell>", run: (*App).runShellInit},
+		{name: "completion", args: "<shell>", run: (*App).runCompletion},
+		{name: "save", args: "<name>", run: (*App).runSave, match: (*App).matchSave},
+		{name: "run", args: "<name> [args...]", run: (*App).runAlias, match: (*App).matchRun},
+		{name: "alias", args: "list|rm|export|import", run: (*App).runAliasAdmin},
+		{name: "history", args: "[show <id>]", run: (*App).runHistory, match: (*App).matchHistory},
+		{name: "undo", args: "[id]", run: (*App).runUndo, match: (*App).matchUndo},
+		{name: "serve", args: "[--listen addr] [--allow-execute --token token]", run: (*App).runServe, match: (*App).matchOptions},
+		{name: "mcp", args: "[--allow-run]", run: (*App).runMCP, match: (*App).matchOptions},
+		{name: "policy", args: "test <command>", run: (*App).runPolicy, match: (*App).matchPolicy},
+		{name: "cache", args: "clear|stats", run: (*App).runCache},
+		{name: "audit", args: "verify [path]", run: (*App).runAudit},
+		{name: "__complete", args: "<kind>", hidden: true, run: (*App).runComplete},
+	}
+}
+
+// New creates an App wired to the standard streams
+func New(version, commit, date string) *App {
+	return &App{
+		Stdin:   os.Stdin,
+		Stdout:  os.Stdout,
+		Stderr:  os.Stderr,
+		Version: version,
+		Commit:  commit,
+		Date:    date,
+	}
+}
+
+// Run runs aic with args (without the program name) and returns the exit code
+func (a *App) Run(args []string) int {
+	a.out = color.NewPrinter(a.Stdout)
+	a.out.NoColor = !isTerminal(a.Stdout)
+	a.err = color.NewPrinter(a.Stderr)
+	a.err.NoColor = !isTerminal(a.Stderr)
+	a.interactive = isTerminal(a.Stdin) && isTerminal(a.Stdout)
+
+	opts := &options{}
+	fs := a.flagSet(opts)
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return ExitOK
+		}
+		return ExitError
+	}
+
+	// Display version information
+	if opts.showVersion {
+		fmt.Fprintf(a.Stdout, "aic version %s\nbuilt on %s\ncommit hash %s\n", a.Version, a.Date, a.Commit)
+		return ExitOK
+	}
+
+	// Apply the config file, command line arguments take precedence
+	if err := a.applyConfig(fs, opts); err != nil {
+		a.err.Error("Error: %v\n", err)
+		return ExitError
+	}
+	// The machine-wide policy is loaded separately from the user config, which cannot override it
+	if err := a.loadPolicy(opts); err != nil {
+		a.err.Error("Error: %v\n", err)
+		return ExitError
+	}
+	if opts.answerOnly {
+		opts.summarize = true
+	}
+	if opts.output != outputText && opts.output != outputJSON {
+		a.err.Error("Error: unsupported output format %q, use text or json\n", opts.output)
+		return ExitError
+	}
+	if err := resolveShell(opts); err != nil {
+		a.err.Error("Error: %v\n", err)
+		return ExitError
+	}
+	if opts.allowSudo && opts.noSudo {
+		a.err.Error("Error: -allow-sudo and -no-sudo cannot be used together\n")
+		return ExitError
+	}
+	if opts.host != "" && opts.containerName != "" {
+		a.err.Error("Error: -host and -container cannot be used together\n")
+		return ExitError
+	}
+	if opts.sandbox && (opts.host != "" || opts.containerName != "") {
+		a.err.Error("Error: -sandbox cannot be used with -host or -container\n")
+		return ExitError
+	}
+	if opts.sandbox {
+		box, err := newSandbox(opts)
+		if err != nil {
+			a.err.Error("Error: %v\n", err)
+			return ExitError
+		}
+		opts.box = box
+	}
+	if opts.containerName != "" {
+		if err := openContainer(opts); err != nil {
+			a.err.Error("Error: %v\n", err)
+			return ExitError
+		}
+	}
+	if opts.host != "" {
+		client, err := a.dialHost(opts.host)
+		if err != nil {
+			a.err.Error("Error: %v\n", err)
+			return ExitError
+		}
+		defer client.Close()
+		opts.remote = client
+	}
+
+	rest := fs.Args()
+	// Arguments after -- are always a prompt, the shell widgets pass the edited line this way
+	if len(rest) > 0 && !afterTerminator(args, rest) {
+		for _, cmd := range commands() {
+			if rest[0] == cmd.name && (cmd.match == nil || cmd.match(a, rest[1:])) {
+				return cmd.run(a, opts, rest[1:])
+			}
+		}
+	}
+
+	prompt, stdinContext, err := a.readPrompt(opts, rest)
+	if err != nil {
+		a.err.Error("Error: %v\n", err)
+		return ExitError
+	}
+	if prompt == "" {
+		a.usage()
+		return ExitError
+	}
+
+	if opts.agent {
+		return a.runAgent(opts, prompt, stdinContext)
+	}
+	if opts.plan {
+		return a.runPlan(opts, prompt, stdinContext)
+	}
+	return a.runGenerate(opts, prompt, stdinContext)
+}
+
+// afterTerminator reports whether the positional arguments rest followed -- in args
+func afterTerminator(args, rest []string) bool {
+	i := len(args) - len(rest) - 1
+	return i >= 0 && args[i] == "--"
+}
+
+// readPrompt returns the prompt from the arguments, the -f file or piped stdin,
+// and the piped stdin data when it is used as context
+func (a *App) readPrompt(opts *options, args []string) (prompt, stdinContext string, err error) {
+	if opts.stdinContext {
+		if isTerminal(a.Stdin) {
+			return "", "", fmt.Errorf("--stdin-context requires data piped to stdin")
+		}
+		data, err := io.ReadAll(a.Stdin)
+		if err != nil {
+			return "", "", fmt.Errorf("error reading stdin: %v", err)
+		}
+		stdinContext = string(data)
+	}
+
+	switch {
+	case opts.promptFile != "":
+		if len(args) > 0 {
+			return "", "", fmt.Errorf("a prompt cannot be given both as arguments and with -f")
+		}
+		data, err := os.ReadFile(opts.promptFile)
+		if err != nil {
+			return "", "", fmt.Errorf("error reading prompt file: %v", err)
+		}
+		prompt = string(data)
+	case len(args) > 0:
+		prompt = strings.Join(args, " ")
+	case !opts.stdinContext && !isTerminal(a.Stdin):
+		data, err := io.ReadAll(a.Stdin)
+		if err != nil {
+			return "", "", fmt.Errorf("error reading stdin: %v", err)
+		}
+		prompt = string(data)
+	}
+
+	return strings.TrimSpace(prompt), stdinContext, nil
+}
+
+// flagSet defines the global flags
+func (a *App) flagSet(opts *options) *flag.FlagSet {
+	fs := flag.NewFlagSet("aic", flag.ContinueOnError)
+	fs.SetOutput(a.Stderr)
+	fs.Usage = a.usage
+	fs.StringVar(&opts.model, "model", "qwen2.5-coder", "Ollama model name to use")
+	fs.BoolVar(&opts.verbose, "verbose", false, "Enable verbose mode to print actual commands")
+	fs.StringVar(&opts.ollamaURL, "ollama-url", "http://localhost:11434", "Ollama service address")
+	fs.BoolVar(&opts.showVersion, "version", false, "Show version information")
+	fs.BoolVar(&opts.continueSession, "continue", false, "Continue the last session with a follow-up request")
+	fs.BoolVar(&opts.printOnly, "print-only", false, "Only print the generated command to stdout without executing it")
+	fs.StringVar(&opts.profile, "profile", "", "Profile from the config file to use")
+	fs.StringVar(&opts.promptFile, "f", "", "Read the prompt from a file")
+	fs.DurationVar(&opts.execTimeout, "exec-timeout", 0, "Kill the generated command after this duration, e.g. 30s (0 means no timeout)")
+	fs.StringVar(&opts.shell, "shell", "", "Shell to generate and run commands for: "+strings.Join(shell.Names(), ", ")+" (default: detected)")
+	fs.BoolVar(&opts.dryRun, "dry-run", false, "Generate and analyse the command without executing it")
+	fs.StringVar(&opts.output, "output", outputText, "Output format: text or json (json prints the result without executing the command)")
+	fs.StringVar(&opts.host, "host", "", "Generate and run the command on a remote host over SSH: [user@]host[:port]")
+	fs.StringVar(&opts.containerName, "container", "", "Generate and run the command inside a running Docker or Podman container: [docker:|podman:]name")
+	fs.BoolVar(&opts.sandbox, "sandbox", false, "Run the command isolated on Linux: read-only filesystem except the current directory, no network, limited CPU time and memory")
+	fs.BoolVar(&opts.snapshot, "snapshot", false, "Save the files the command deletes or modifies in the current directory before executing it, restore them with aic undo")
+	fs.BoolVar(&opts.allowSudo, "allow-sudo", false, "Execute commands using sudo, doas or su without asking for confirmation")
+	fs.BoolVar(&opts.noSudo, "no-sudo", false, "Never execute commands using sudo, doas or su, and tell the model not to use them")
+	fs.BoolVar(&opts.yes, "yes", false, "Execute high risk commands without asking for confirmation")
+	fs.BoolVar(&opts.noPTY, "no-pty", false, "Do not run the generated command in a pseudo-terminal")
+	fs.BoolVar(&opts.plan, "plan", false, "Break the task into several commands and execute them step by step")
+	fs.BoolVar(&opts.agent, "agent", false, "Investigate the prompt by running read-only commands and answer in natural language")
+	fs.IntVar(&opts.maxSteps, "max-steps", defaultAgentSteps, "Maximum number of commands run in agent mode")
+	fs.BoolVar(&opts.summarize, "summarize", false, "Answer the prompt in natural language from the command output, below the raw output")
+	fs.BoolVar(&opts.answerOnly, "answer-only", false, "Like -summarize, but only print the answer without the raw output")
+	fs.BoolVar(&opts.noCache, "no-cache", false, "Always ask the model instead of using cached commands")
+	fs.StringVar(&opts.auditLog, "audit-log", "", "Path of the audit log of executed commands (default: audit.jsonl in the config directory)")
+	fs.BoolVar(&opts.stdinContext, "stdin-context", false, "Give data piped to stdin to the model as context instead of using it as the prompt")
+	return fs
+}
+
+// usage prints the usage to stderr
+func (a *App) usage() {
+	a.err.Warning("Usage: aic [options] <prompt>\n")
+	a.err.Warning("       echo <prompt> | aic [options]\n")
+	for _, cmd := range commands() {
+		if !cmd.hidden {
+			a.err.Warning("       aic [options] %s %s\n", cmd.name, cmd.args)
+		}
+	}
+	fmt.Fprintln(a.Stderr, "\nOptions:")
+	fs := a.flagSet(&options{})
+	fs.SetOutput(a.Stderr)
+	fs.PrintDefaults()
+}
+
+// configDir returns the directory holding config and session files
+func (a *App) configDir() (string, error) {
+	if a.ConfigDir != "" {
+		return a.ConfigDir, nil
+	}
+	return config.Dir()
+}
+
+// applyConfig loads the config file and fills unset options from the selected profile
+func (a *App) applyConfig(fs *flag.FlagSet, opts *options) error {
+	dir, err := a.configDir()
+	if err != nil {
+		return err
+	}
+	cfg, err := config.Load(filepath.Join(dir, config.FileName))
+	if err != nil {
+		return err
+	}
+	opts.cfg = cfg
+
+	p, err := cfg.Profile(opts.profile)
+	if err != nil {
+		return err
+	}
+
+	explicit := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = true
+	})
+	if p.Model != "" && !explicit["model"] {
+		opts.model = p.Model
+	}
+	if p.OllamaURL != "" && !explicit["ollama-url"] {
+		opts.ollamaURL = p.OllamaURL
+	}
+	return nil
+}
+
+// resolveShell resolves the -shell option, an explicitly selected shell must be installed
+func resolveShell(opts *options) error {
+	sh, err := shell.Resolve(opts.shell)
+	if err != nil {
+		return err
+	}
+	if opts.shell != "" {
+		if _, err := exec.LookPath(sh.Executable); err != nil {
+			return fmt.Errorf("shell %s not found: %v", sh.Name, err)
+		}
+	}
+	opts.sh = sh
+	return nil
+}
+
+// newClient creates the Ollama client for opts
+func (a *App) newClient(opts *options) *ollama.Client {
+	client := ollama.NewClient(opts.ollamaURL, opts.verbose)
+	client.Output = a.Stdout
+	if opts.modelTimeout > 0 {
+		client.HTTPClient = &http.Client{Timeout: opts.modelTimeout}
+	}
+	client.SystemInfo = func() (*sysinfo.SystemInfo, error) {
+		return a.systemInfo(opts)
+	}
+	return client
+}
+
+// systemInfo returns the environment the command is generated for
+func (a *App) systemInfo(opts *options) (*sysinfo.SystemInfo, error) {
+	var info *sysinfo.SystemInfo
+	var err error
+	switch {
+	case opts.remote != nil:
+		info, err = opts.remote.SystemInfo()
+	case opts.container != nil:
+		info, err = opts.container.SystemInfo()
+	default:
+		info, err = sysinfo.GetSystemInfo()
+		if err == nil {
+			info.Shell = opts.sh.Name
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	info.SudoDisabled = opts.noSudo
+	return info, nil
+}
+
+// newExecutor creates the executor for generated commands
+func (a *App) newExecutor(opts *options, stdout, stderr io.Writer) executor.CommandExecutor {
+	if opts.dryRun {
+		return executor.NoopExecutor{}
+	}
+	if a.NewExecutor != nil {
+		return a.NewExecutor(stdout, stderr)
+	}
+	captureLimit := session.MaxOutputSnippet
+	if opts.summarize {
+		captureLimit = maxSummaryOutput
+	}
+
+	if opts.remote != nil {
+		exec := opts.remote.NewExecutor()
+		exec.Stdin = a.Stdin
+		exec.Stdout = stdout
+		exec.Stderr = stderr
+		exec.Timeout = opts.execTimeout
+		exec.CaptureLimit = captureLimit
+		return exec
+	}
+	exec := executor.NewShellExecutor()
+	exec.Shell = &opts.sh
+	if opts.container != nil {
+		exec.Wrapper = opts.container.Wrapper()
+	}
+	if opts.box != nil {
+		exec.Wrapper = opts.box.Wrapper()
+	}
+	exec.Stdin = a.Stdin
+	exec.PTY = !opts.noPTY
+	exec.Stdout = stdout
+	exec.Stderr = stderr
+	exec.Timeout = opts.execTimeout
+	exec.CaptureLimit = captureLimit
+	return exec
+}
+
+// target returns the remote host or container commands are executed on, empty for the local machine
+func (opts *options) target() string {
+	switch {
+	case opts.remote != nil:
+		return opts.remote.Target
+	case opts.container != nil:
+		return opts.container.Target()
+	}
+	return ""
+}
+
+// newSandbox creates the -sandbox for the current directory with the limits of the config file
+func newSandbox(opts *options) (*sandbox.Sandbox, error) {
+	box, err := sandbox.New(".")
+	if err != nil {
+		return nil, err
+	}
+	cfg := opts.cfg.Sandbox
+	if cfg.CPUTime != "" {
+		if box.CPUTime, err = time.ParseDuration(cfg.CPUTime); err != nil {
+			return nil, fmt.Errorf("invalid sandbox cpu_time %q: %v", cfg.CPUTime, err)
+		}
+	}
+	if cfg.MemoryMB > 0 {
+		box.Memory = cfg.MemoryMB << 20
+	}
+	return box, nil
+}
+
+// openContainer checks the -container is running and uses its shell, which also collects its system information
+func openContainer(opts *options) error {
+	c, err := container.New(opts.containerName)
+	if err != nil {
+		return err
+	}
+	if opts.sh, err = c.Shell(); err != nil {
+		return err
+	}
+	opts.container = c
+	return nil
+}
+
+// dialHost connects to the -host target
+func (a *App) dialHost(target string) (*remote.Client, error) {
+	cfg := a.SSHConfig
+	if cfg == nil {
+		var err error
+		if cfg, err = remote.DefaultConfig(); err != nil {
+			return nil, err
+		}
+	}
+	return remote.Dial(target, cfg)
+}
+
+// isTerminal reports whether v is a terminal
+func isTerminal(v interface{}) bool {
+	f, ok := v.(*os.File)
+	if !ok {
+		return false
+	}
+	return isatty.IsTerminal(f.Fd()) || isatty.IsCygwinTerminal(f.Fd())
+}
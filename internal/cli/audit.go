@@ -0,0 +1,125 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/LubyRuffy/aic/pkg/audit"
+	"github.com/LubyRuffy/aic/pkg/executor"
+	"github.com/LubyRuffy/aic/pkg/pipeline"
+	"github.com/LubyRuffy/aic/pkg/policy"
+)
+
+// runAudit runs `aic audit verify [path]`, which checks the hash chain of the audit log
+func (a *App) runAudit(opts *options, args []string) int {
+	if len(args) == 0 || args[0] != "verify" || len(args) > 2 {
+		a.err.Warning("Usage: aic audit verify [path]\n")
+		return ExitError
+	}
+
+	path, err := a.auditPath(opts)
+	if err != nil {
+		a.err.Error("Error: %v\n", err)
+		return ExitError
+	}
+	if len(args) == 2 {
+		path = args[1]
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		a.err.Error("Error opening audit log: %v\n", err)
+		return ExitError
+	}
+	defer f.Close()
+
+	count, err := audit.Verify(f)
+	if err != nil {
+		a.err.Error("%v\n", err)
+		return ExitError
+	}
+	a.out.Success("%s: %d entries verified\n", path, count)
+	a.out.Info("The hash chain only detects accidental corruption and partial edits: " +
+		"whoever can write the file can rewrite it with a new chain or remove the last entries unnoticed\n")
+	return ExitOK
+}
+
+// auditPolicy returns the audit settings of the machine-wide policy, which take precedence over the user's
+func auditPolicy(opts *options) policy.Audit {
+	if opts.policy == nil {
+		return policy.Audit{}
+	}
+	return opts.policy.Audit
+}
+
+// auditPath returns the path of the file audit log, the machine-wide policy overrides -audit-log
+// which overrides the config file
+func (a *App) auditPath(opts *options) (string, error) {
+	if p := auditPolicy(opts).Path; p != "" {
+		return p, nil
+	}
+	if opts.auditLog != "" {
+		return opts.auditLog, nil
+	}
+	if opts.cfg != nil && opts.cfg.Audit.Path != "" {
+		return opts.cfg.Audit.Path, nil
+	}
+	dir, err := a.configDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, audit.FileName), nil
+}
+
+// recordAudit appends an entry for an executed command to the audit log,
+// failures are reported but do not change the exit code as the command already ran.
+// execResult is nil when the command could not be started, execErr then says why.
+// The user config can disable the log unless the machine-wide policy requires it
+func (a *App) recordAudit(opts *options, result *pipeline.Result, execResult *executor.ExecResult, execErr error) {
+	if opts.cfg != nil && opts.cfg.Audit.Disabled && !auditPolicy(opts).Required {
+		return
+	}
+
+	entry := audit.NewEntry()
+	entry.Prompt = result.Prompt
+	entry.Model = result.Model
+	entry.ServerURL = opts.ollamaURL
+	entry.Command = result.Command
+	entry.Target = opts.target()
+	entry.Risk = result.Risk
+	if execResult != nil {
+		entry.ExitCode = execResult.ExitCode
+		entry.DurationMs = execResult.Duration.Milliseconds()
+	} else {
+		entry.ExitCode = -1
+		if execErr != nil {
+			entry.Error = execErr.Error()
+		}
+	}
+
+	if err := a.writeAudit(opts, entry); err != nil {
+		a.err.Warning("Failed to write audit log: %v\n", err)
+	}
+}
+
+// writeAudit writes entry to the configured sink
+func (a *App) writeAudit(opts *options, entry *audit.Entry) error {
+	sink := auditPolicy(opts).Sink
+	if sink == "" && opts.cfg != nil {
+		sink = opts.cfg.Audit.Sink
+	}
+	path := ""
+	if sink == "" || sink == audit.SinkFile {
+		var err error
+		if path, err = a.auditPath(opts); err != nil {
+			return err
+		}
+	}
+
+	s, err := audit.Open(sink, path)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	return s.Write(entry)
+}
@@ -0,0 +1,86 @@
+package cli
+
+import (
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/LubyRuffy/aic/pkg/cache"
+)
+
+// runCache runs `aic cache clear|stats`
+func (a *App) runCache(opts *options, args []string) int {
+	if len(args) != 1 || (args[0] != "clear" && args[0] != "stats") {
+		a.err.Warning("Usage: aic cache clear|stats\n")
+		return ExitError
+	}
+
+	c, err := a.newCache(opts)
+	if err != nil {
+		a.err.Error("Error: %v\n", err)
+		return ExitError
+	}
+
+	if args[0] == "clear" {
+		if err := c.Clear(); err != nil {
+			a.err.Error("Error: %v\n", err)
+			return ExitError
+		}
+		a.out.Success("Cache cleared\n")
+		return ExitOK
+	}
+
+	stats, err := c.Stats()
+	if err != nil {
+		a.err.Error("Error: %v\n", err)
+		return ExitError
+	}
+	fmt.Fprintf(a.Stdout, "Path:     %s\n", c.Path)
+	fmt.Fprintf(a.Stdout, "Entries:  %d (%d expired, limit %d)\n", stats.Entries, stats.Expired, c.MaxEntries)
+	fmt.Fprintf(a.Stdout, "TTL:      %s\n", c.TTL)
+	fmt.Fprintf(a.Stdout, "Hits:     %d\n", stats.Hits)
+	fmt.Fprintf(a.Stdout, "Misses:   %d\n", stats.Misses)
+	fmt.Fprintf(a.Stdout, "Size:     %d bytes\n", stats.Size)
+	return ExitOK
+}
+
+// newCache creates the prompt cache with the limits from the config file
+func (a *App) newCache(opts *options) (*cache.Cache, error) {
+	dir, err := a.configDir()
+	if err != nil {
+		return nil, err
+	}
+	c := cache.New(filepath.Join(dir, cache.FileName))
+
+	cfg := opts.cfg.Cache
+	if cfg.TTL != "" {
+		ttl, err := time.ParseDuration(cfg.TTL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cache ttl %q: %v", cfg.TTL, err)
+		}
+		c.TTL = ttl
+	}
+	if cfg.MaxEntries > 0 {
+		c.MaxEntries = cfg.MaxEntries
+	}
+	return c, nil
+}
+
+// useCache reports whether the prompt cache is used for generating commands,
+// follow-ups are never cached as they depend on the conversation
+func (a *App) useCache(opts *options) bool {
+	return !opts.noCache && !opts.continueSession && !opts.cfg.Cache.Disabled
+}
+
+// cacheKey returns the cache and the key of request for the current environment
+func (a *App) cacheKey(opts *options, request string) (*cache.Cache, string, error) {
+	c, err := a.newCache(opts)
+	if err != nil {
+		return nil, "", err
+	}
+	info, err := a.systemInfo(opts)
+	if err != nil {
+		return nil, "", err
+	}
+	return c, cache.Key(request, opts.model, cache.Fingerprint(info)), nil
+}
@@ -0,0 +1,333 @@
+package cli
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/LubyRuffy/aic/pkg/executor"
+	"github.com/LubyRuffy/aic/pkg/ollama"
+	"github.com/LubyRuffy/aic/pkg/pipeline"
+	"github.com/LubyRuffy/aic/pkg/safety"
+	"github.com/LubyRuffy/aic/pkg/session"
+)
+
+// maxStdinContext is the maximum number of bytes of piped stdin given to the model as context
+const maxStdinContext = 8192
+
+// maxSummaryOutput is the maximum number of bytes of command output given to the model for --summarize
+const maxSummaryOutput = 16384
+
+// Output formats accepted by -output
+const (
+	outputText = "text"
+	outputJSON = "json"
+)
+
+// runGenerate generates a command from prompt and executes it,
+// stdinContext is data piped to aic that is given to the model as context
+func (a *App) runGenerate(opts *options, prompt, stdinContext string) int {
+	// Print debug information in verbose mode
+	if opts.verbose {
+		a.out.Info("Version: %s (built on %s, commit %s)\n", a.Version, a.Date, a.Commit)
+		a.out.Info("Ollama URL: %s\n", opts.ollamaURL)
+		a.out.Info("Model: %s\n", opts.model)
+		a.out.Info("Prompt: %s\n", prompt)
+		if stdinContext != "" {
+			a.out.Info("Stdin context: %d bytes\n", len(stdinContext))
+		}
+	}
+
+	dir, err := a.configDir()
+	if err != nil {
+		a.err.Error("Error locating session: %v\n", err)
+		return ExitError
+	}
+	sessionPath := filepath.Join(dir, session.FileName)
+
+	// Build the conversation, reusing the last session for follow-ups
+	request := prompt
+	var findings []string
+	if stdinContext != "" {
+		stdinContext = session.Truncate(stdinContext, maxStdinContext)
+		findings = a.scanContext("piped input", stdinContext)
+		request = ollama.PromptWithContext(prompt, stdinContext)
+	}
+	sess := &session.Session{}
+	messages := []ollama.Message{{Role: ollama.RoleUser, Content: request}}
+	if opts.continueSession {
+		sess, err = session.Load(sessionPath)
+		if err != nil {
+			if errors.Is(err, session.ErrNoSession) {
+				a.err.Error("No previous session to continue, run aic without --continue first\n")
+			} else {
+				a.err.Error("Error loading session: %v\n", err)
+			}
+			return ExitError
+		}
+		messages = sess.FollowUp(request)
+		findings = append(findings, a.scanContext("output of the previous command", sess.Output)...)
+		if opts.verbose {
+			a.out.Info("Continuing session with previous command: %s\n", sess.Command)
+		}
+	}
+
+	// Generate, sanitise and analyse the command
+	result, err := a.generate(opts, prompt, request, messages)
+	if err != nil {
+		a.err.Error("Error generating command: %v\n", err)
+		return ExitError
+	}
+	command := result.Command
+
+	// The model saw data the user did not write, check the command still does what the user asked for.
+	// The previous command was approved by the user, so hosts it uses count as requested
+	if stdinContext != "" || opts.continueSession {
+		result.Injection = checkInjection(command, result.Risk, prompt+"\n"+sess.Command, findings)
+		if len(result.Injection) > 0 && opts.printOnly {
+			a.err.Warning("Possible prompt injection: %s\n", strings.Join(result.Injection, "; "))
+		}
+	}
+
+	// Only print the command so that shell widgets can insert it into the prompt buffer,
+	// or print the machine-readable result for other tools
+	if opts.printOnly || opts.output == outputJSON {
+		if opts.output == outputJSON {
+			enc := json.NewEncoder(a.Stdout)
+			enc.SetIndent("", "  ")
+			_ = enc.Encode(result)
+		} else {
+			fmt.Fprintln(a.Stdout, command)
+		}
+		sess.Record(opts.model, messages, command, "")
+		a.saveSession(opts, sess, sessionPath)
+		return ExitOK
+	}
+
+	// Print actual command in verbose mode
+	if opts.verbose {
+		a.out.Info("Generated command: %s\n", command)
+		a.out.Info("Risk: %s (%s)\n", result.Risk, result.Explanation)
+	}
+
+	// Show the result instead of executing it in dry-run mode
+	if opts.dryRun {
+		a.printDryRun(result)
+	} else if !a.confirmRisk(opts, result) {
+		return ExitError
+	}
+
+	// Execute command, the raw output is hidden when only the answer is wanted
+	stdout, stderr := a.Stdout, a.Stderr
+	if opts.answerOnly && !opts.dryRun {
+		stdout, stderr = io.Discard, io.Discard
+	}
+	execResult, execErr := a.execute(opts, result, stdout, stderr)
+	if opts.verbose && execResult != nil && !opts.dryRun {
+		a.out.Info("Exit code: %d (took %s)\n", execResult.ExitCode, execResult.Duration.Round(time.Millisecond))
+	}
+	if opts.summarize && !opts.dryRun {
+		a.printSummary(opts, prompt, command, execResult)
+	}
+
+	// Save the session so that the next run can use --continue, commands refused before they ran cannot be saved as aliases
+	sess.Record(opts.model, messages, command, capturedOutput(execResult))
+	sess.Executed = !opts.dryRun && execResult != nil
+	a.saveSession(opts, sess, sessionPath)
+
+	if execErr != nil {
+		a.err.Error("Error executing command: %v\n", execErr)
+		return exitCode(execErr)
+	}
+	return ExitOK
+}
+
+// execute runs the command of result and records it in the audit log
+func (a *App) execute(opts *options, result *pipeline.Result, stdout, stderr io.Writer) (*executor.ExecResult, error) {
+	return a.executeWith(opts, a.newExecutor(opts, stdout, stderr), result)
+}
+
+// executeWith runs the command of result with exec and records it in the audit log,
+// after checking it against the policy, the -no-sudo mode and signs of prompt injection and saving a snapshot of the files it modifies when snapshots are enabled
+func (a *App) executeWith(opts *options, exec executor.CommandExecutor, result *pipeline.Result) (*executor.ExecResult, error) {
+	if err := a.enforcePolicy(opts, result.Command); err != nil {
+		return nil, err
+	}
+	if err := a.enforcePrivileges(opts, result.Command); err != nil {
+		return nil, err
+	}
+	if err := a.confirmInjection(opts, result); err != nil {
+		return nil, err
+	}
+	snap, err := a.takeSnapshot(opts, result)
+	if err != nil {
+		return nil, fmt.Errorf("%v, the command was not executed", err)
+	}
+	execResult, err := exec.Execute(result.Command)
+	if !opts.dryRun {
+		a.recordAudit(opts, result, execResult, err)
+	}
+	if snap != nil {
+		a.recordSnapshot(result, snap, execResult)
+	}
+	return execResult, err
+}
+
+// printSummary asks the model to answer prompt from the captured output of command and prints the answer
+func (a *App) printSummary(opts *options, prompt, command string, execResult *executor.ExecResult) {
+	output := capturedOutput(execResult)
+	if execResult != nil && execResult.ExitCode != 0 {
+		output += fmt.Sprintf("\n(command exited with code %d)", execResult.ExitCode)
+	}
+	a.scanContext("command output", output)
+
+	answer, err := a.newClient(opts).Summarize(opts.model, prompt, command, output)
+	if err != nil {
+		a.err.Error("Error summarizing output: %v\n", err)
+		return
+	}
+	if !opts.answerOnly {
+		a.out.Info("\nSummary:\n")
+	}
+	fmt.Fprintln(a.Stdout, answer)
+}
+
+// generate asks the model for a command, following up on the session when -continue is set
+func (a *App) generate(opts *options, prompt, request string, messages []ollama.Message) (*pipeline.Result, error) {
+	client := a.newClient(opts)
+	start := time.Now()
+
+	if opts.continueSession {
+		response, err := client.Chat(opts.model, messages)
+		if err != nil {
+			return nil, err
+		}
+		return pipeline.NewResult(prompt, opts.model, response, time.Since(start)), nil
+	}
+
+	if !a.useCache(opts) {
+		response, err := client.Generate(opts.model, request)
+		if err != nil {
+			return nil, err
+		}
+		return pipeline.NewResult(prompt, opts.model, response, time.Since(start)), nil
+	}
+
+	// Look up the cache before calling the model, cache failures only disable caching
+	c, key, err := a.cacheKey(opts, request)
+	if err != nil {
+		return nil, err
+	}
+	if response, ok, err := c.Get(key); err != nil {
+		a.err.Warning("Failed to read cache: %v\n", err)
+	} else if ok {
+		if opts.verbose {
+			a.out.Info("Using cached response\n")
+		}
+		result := pipeline.NewResult(prompt, opts.model, response, time.Since(start))
+		result.Cached = true
+		return result, nil
+	}
+
+	response, err := client.Generate(opts.model, request)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.Put(key, opts.model, request, response); err != nil && opts.verbose {
+		a.err.Warning("Failed to write cache: %v\n", err)
+	}
+	return pipeline.NewResult(prompt, opts.model, response, time.Since(start)), nil
+}
+
+// printDryRun prints the generated command and its analysis
+func (a *App) printDryRun(result *pipeline.Result) {
+	fmt.Fprintln(a.Stdout, result.Command)
+	printer := a.err.Info
+	if result.Risk.AtLeast(safety.RiskMedium) {
+		printer = a.err.Warning
+	}
+	printer("Risk: %s (%s)\n", result.Risk, result.Explanation)
+}
+
+// confirmRisk asks for confirmation before executing a high risk command,
+// in non-interactive mode high risk commands are only executed with -yes
+func (a *App) confirmRisk(opts *options, result *pipeline.Result) bool {
+	if opts.yes || !result.Risk.AtLeast(safety.RiskHigh) {
+		return true
+	}
+
+	a.err.Warning("%s\n", result.Command)
+	a.err.Warning("This command is %s risk: %s\n", result.Risk, result.Explanation)
+	if !a.interactive {
+		a.err.Error("Refusing to execute a %s risk command without a terminal, use -yes to execute it anyway\n", result.Risk)
+		return false
+	}
+	if !a.confirm("Execute it? [y/N] ") {
+		a.err.Warning("Command not executed\n")
+		return false
+	}
+	return true
+}
+
+// confirm asks a yes/no question on the terminal, the default answer is no
+func (a *App) confirm(question string) bool {
+	a.err.Warning("%s", question)
+	answer, err := readLine(a.Stdin)
+	if err != nil {
+		return false
+	}
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
+
+// readLine reads a single line without buffering beyond it, so that the rest of stdin is left for the command
+func readLine(r io.Reader) (string, error) {
+	var line []byte
+	buf := make([]byte, 1)
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			if buf[0] == '\n' {
+				return string(line), nil
+			}
+			line = append(line, buf[0])
+		}
+		if err != nil {
+			if len(line) > 0 {
+				return string(line), nil
+			}
+			return "", err
+		}
+	}
+}
+
+// capturedOutput returns the captured stdout and stderr of result
+func capturedOutput(result *executor.ExecResult) string {
+	if result == nil {
+		return ""
+	}
+	return result.Stdout + result.Stderr
+}
+
+// exitCode returns the exit code of aic for an execution error, propagating the child's exit code
+func exitCode(err error) int {
+	var exitErr *executor.ExitError
+	if !errors.As(err, &exitErr) {
+		return ExitError
+	}
+	if exitErr.Result.TimedOut {
+		return executor.ExitCodeTimeout
+	}
+	return exitErr.Result.ExitCode
+}
+
+// saveSession saves the session, failures are only reported in verbose mode
+func (a *App) saveSession(opts *options, sess *session.Session, path string) {
+	if err := sess.Save(path); err != nil && opts.verbose {
+		a.err.Warning("Failed to save session: %v\n", err)
+	}
+}
@@ -0,0 +1,63 @@
+package cli
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/LubyRuffy/aic/pkg/history"
+	"github.com/LubyRuffy/aic/pkg/ollama"
+)
+
+// runHistory runs `aic history [show <id>]`, listing the history or showing the transcript of an entry
+func (a *App) runHistory(_ *options, args []string) int {
+	dir, err := a.configDir()
+	if err != nil {
+		a.err.Error("Error: %v\n", err)
+		return ExitError
+	}
+	entries, err := history.Load(filepath.Join(dir, history.FileName))
+	if err != nil {
+		a.err.Error("Error: %v\n", err)
+		return ExitError
+	}
+
+	if len(args) == 0 {
+		for _, e := range entries {
+			fmt.Fprintf(a.Stdout, "%s\t%s\t%s\n", e.ID, e.Kind, e.Prompt)
+		}
+		return ExitOK
+	}
+
+	e, ok := history.Find(entries, args[1])
+	if !ok {
+		a.err.Error("History entry %q not found\n", args[1])
+		return ExitError
+	}
+	a.out.Info("%s %s (%s, %s)\n", e.Kind, e.ID, e.Model, e.Time.Format("2006-01-02 15:04:05"))
+	if e.Kind == history.KindCommand {
+		for _, step := range e.Steps {
+			fmt.Fprintf(a.Stdout, "%s\n(exit code %d)\n", step.Command, step.ExitCode)
+		}
+	}
+	if e.Snapshot != "" {
+		a.out.Info("Snapshot %s, restore it with aic undo %s\n", e.Snapshot, e.Snapshot)
+	}
+	for _, m := range e.Transcript {
+		if m.Role == ollama.RoleUser {
+			a.out.Success("\n%s:\n", m.Role)
+		} else {
+			a.out.Warning("\n%s:\n", m.Role)
+		}
+		fmt.Fprintln(a.Stdout, strings.TrimRight(m.Content, "\n"))
+	}
+	if e.Error != "" {
+		a.err.Error("\nError: %s\n", e.Error)
+	}
+	return ExitOK
+}
+
+// matchHistory reports whether args are meant for the history subcommand rather than a prompt
+func (a *App) matchHistory(args []string) bool {
+	return len(args) == 0 || (len(args) == 2 && args[0] == "show")
+}
@@ -0,0 +1,54 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/LubyRuffy/aic/pkg/injection"
+	"github.com/LubyRuffy/aic/pkg/pipeline"
+	"github.com/LubyRuffy/aic/pkg/safety"
+)
+
+// scanContext warns when data given to the model, such as piped stdin or command output, contains
+// text that looks like instructions for the model, source describes where the data came from
+func (a *App) scanContext(source, data string) []string {
+	findings := injection.Scan(data)
+	if len(findings) > 0 {
+		a.err.Warning("Possible prompt injection in the %s: %s\n", source, strings.Join(findings, "; "))
+	}
+	return findings
+}
+
+// checkInjection checks a command generated after the model saw untrusted data against request, what the user asked for.
+// When the data itself looked like a prompt injection, any medium or high risk command is suspicious too
+func checkInjection(command string, risk safety.Level, request string, findings []string) []string {
+	reasons := injection.CheckCommand(command, request)
+	if len(reasons) == 0 && len(findings) > 0 && risk.AtLeast(safety.RiskMedium) {
+		reasons = append(reasons, fmt.Sprintf("the command is %s risk and was generated from data that looks like a prompt injection", risk))
+	}
+	return reasons
+}
+
+// confirmInjection checks commands that may follow instructions injected in untrusted data before they run.
+// They are never executed without confirmation on the terminal, not even with -yes, since the user did not ask for them
+func (a *App) confirmInjection(opts *options, result *pipeline.Result) error {
+	if len(result.Injection) == 0 {
+		return nil
+	}
+	reason := strings.Join(result.Injection, "; ")
+	if opts.dryRun {
+		a.err.Warning("Possible prompt injection: %s\n", reason)
+		return nil
+	}
+
+	a.err.Warning("%s\n", result.Command)
+	a.err.Warning("This command may follow instructions injected in the context rather than your request: %s\n", reason)
+	if !a.interactive {
+		return fmt.Errorf("not executed: possible prompt injection (%s), review the command above and run it yourself if it is intended", reason)
+	}
+	if !a.confirm("Execute it anyway? [y/N] ") {
+		return errors.New("command not executed")
+	}
+	return nil
+}
@@ -0,0 +1,233 @@
+package cli
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/LubyRuffy/aic/pkg/executor"
+	"github.com/LubyRuffy/aic/pkg/mcp"
+	"github.com/LubyRuffy/aic/pkg/pipeline"
+	"github.com/LubyRuffy/aic/pkg/safety"
+)
+
+// runMCP runs `aic mcp`, an MCP server on stdin/stdout exposing aic's tools to AI assistants
+func (a *App) runMCP(opts *options, args []string) int {
+	fs := flag.NewFlagSet("aic mcp", flag.ContinueOnError)
+	fs.SetOutput(a.Stderr)
+	allowRun := fs.Bool("allow-run", false, "Provide the run_command tool executing commands on this machine")
+	allowRisky := fs.Bool("allow-risky", false, "Let run_command execute medium and high risk commands the assistant says the user approved")
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return ExitOK
+		}
+		return ExitError
+	}
+	if fs.NArg() > 0 {
+		a.err.Error("Error: unexpected arguments: %s\n", strings.Join(fs.Args(), " "))
+		return ExitError
+	}
+
+	// stdout carries the protocol, everything else printed while handling a call goes to stderr
+	protocol := a.Stdout
+	a.Stdout = a.Stderr
+	a.out = a.err
+	// stdin carries the protocol too, so nothing can be confirmed on the terminal
+	a.interactive = false
+	opts.modelTimeout = serveModelTimeout
+
+	if err := a.newMCPServer(opts, *allowRun, *allowRisky).Serve(a.Stdin, protocol); err != nil {
+		a.err.Error("Error: %v\n", err)
+		return ExitError
+	}
+	return ExitOK
+}
+
+// newMCPServer creates the MCP server, run_command is only provided with allowRun
+// and only executes risky commands with allowRisky
+func (a *App) newMCPServer(opts *options, allowRun, allowRisky bool) *mcp.Server {
+	backend := &serveBackend{app: a, opts: opts}
+	model := func(model string) string {
+		if model == "" {
+			return opts.model
+		}
+		return model
+	}
+
+	s := &mcp.Server{Name: "aic", Version: a.Version}
+	s.AddTool(&mcp.Tool{
+		Name:        "generate_command",
+		Description: "Generate a shell command for this machine from a natural language description. The command is not executed.",
+		InputSchema: objectSchema([]string{"prompt"}, map[string]interface{}{
+			"prompt": stringProperty("What the command should do"),
+			"model":  stringProperty("Ollama model to use instead of the default"),
+		}),
+		Handler: func(raw json.RawMessage) (interface{}, error) {
+			var args struct {
+				Prompt string `json:"prompt"`
+				Model  string `json:"model"`
+			}
+			if err := mcp.DecodeArgs(raw, &args); err != nil {
+				return nil, err
+			}
+			if strings.TrimSpace(args.Prompt) == "" {
+				return nil, errors.New("prompt is required")
+			}
+			return backend.Generate(model(args.Model), args.Prompt)
+		},
+	})
+	s.AddTool(&mcp.Tool{
+		Name:        "explain_command",
+		Description: "Explain what a shell command does and assess its risk. The command is not executed.",
+		InputSchema: objectSchema([]string{"command"}, map[string]interface{}{
+			"command": stringProperty("The command to explain"),
+			"model":   stringProperty("Ollama model to use instead of the default"),
+		}),
+		Handler: func(raw json.RawMessage) (interface{}, error) {
+			var args struct {
+				Command string `json:"command"`
+				Model   string `json:"model"`
+			}
+			if err := mcp.DecodeArgs(raw, &args); err != nil {
+				return nil, err
+			}
+			if strings.TrimSpace(args.Command) == "" {
+				return nil, errors.New("command is required")
+			}
+			return backend.Explain(model(args.Model), args.Command)
+		},
+	})
+	s.AddTool(&mcp.Tool{
+		Name:        "system_info",
+		Description: "Describe the operating system, shell, user and working directory commands run in.",
+		InputSchema: objectSchema(nil, map[string]interface{}{}),
+		Handler: func(raw json.RawMessage) (interface{}, error) {
+			if err := mcp.DecodeArgs(raw, &struct{}{}); err != nil {
+				return nil, err
+			}
+			return a.mcpSystemInfo(opts)
+		},
+	})
+	if allowRun {
+		s.AddTool(&mcp.Tool{
+			Name: "run_command",
+			Description: "Execute a shell command on this machine and return its output. " +
+				"Medium and high risk commands are refused unless the server allows them and confirm is true, which must only be set after the user approved the command.",
+			InputSchema: objectSchema([]string{"command"}, map[string]interface{}{
+				"command": stringProperty("The command to execute"),
+				"confirm": map[string]interface{}{"type": "boolean", "description": "The user approved executing a risky command"},
+			}),
+			Handler: func(raw json.RawMessage) (interface{}, error) {
+				var args struct {
+					Command string `json:"command"`
+					Confirm bool   `json:"confirm"`
+				}
+				if err := mcp.DecodeArgs(raw, &args); err != nil {
+					return nil, err
+				}
+				return a.mcpRun(opts, args.Command, args.Confirm, allowRisky)
+			},
+		})
+	}
+	return s
+}
+
+// mcpRunResult is the result of the run_command tool
+type mcpRunResult struct {
+	Command     string       `json:"command"`
+	Risk        safety.Level `json:"risk"`
+	Explanation string       `json:"explanation"`
+	ExitCode    int          `json:"exit_code"`
+	Stdout      string       `json:"stdout"`
+	Stderr      string       `json:"stderr"`
+	TimedOut    bool         `json:"timed_out,omitempty"`
+	DurationMs  int64        `json:"duration_ms"`
+}
+
+// mcpRun executes command for the run_command tool. The same safety analysis as the CLI applies.
+// confirm comes from the assistant calling the tool, not from the user, so it cannot authorize anything on its own:
+// medium and high risk commands need the server to be started with --allow-risky and confirm,
+// and high risk commands additionally need aic to run with -yes
+func (a *App) mcpRun(opts *options, command string, confirm, allowRisky bool) (*mcpRunResult, error) {
+	if strings.TrimSpace(command) == "" {
+		return nil, errors.New("command is required")
+	}
+	result := pipeline.NewResult("", opts.model, command, 0)
+	if result.Risk.AtLeast(safety.RiskMedium) && !allowRisky {
+		return nil, fmt.Errorf("refusing to execute a %s risk command, aic mcp was not started with --allow-risky: %s", result.Risk, result.Explanation)
+	}
+	if result.Risk.AtLeast(safety.RiskMedium) && !confirm {
+		return nil, fmt.Errorf("refusing to execute a %s risk command without confirm: %s", result.Risk, result.Explanation)
+	}
+	if result.Risk.AtLeast(safety.RiskHigh) && !opts.yes {
+		return nil, fmt.Errorf("refusing to execute a %s risk command, aic mcp was not started with -yes: %s", result.Risk, result.Explanation)
+	}
+
+	execResult, err := a.executeWith(opts, a.captureExecutor(opts), result)
+	var exitErr *executor.ExitError
+	if err != nil && !errors.As(err, &exitErr) {
+		return nil, err
+	}
+	res := &mcpRunResult{Command: result.Command, Risk: result.Risk, Explanation: result.Explanation}
+	if execResult != nil {
+		res.ExitCode = execResult.ExitCode
+		res.Stdout = execResult.Stdout
+		res.Stderr = execResult.Stderr
+		res.TimedOut = execResult.TimedOut
+		res.DurationMs = execResult.Duration.Milliseconds()
+	}
+	return res, nil
+}
+
+// mcpSystemInfo is the result of the system_info tool
+type mcpSystemInfo struct {
+	OS         string `json:"os"`
+	OSVersion  string `json:"os_version"`
+	Shell      string `json:"shell"`
+	Username   string `json:"username"`
+	HomeDir    string `json:"home_dir"`
+	CurrentDir string `json:"current_dir"`
+	// EnvVars only lists the names, values may hold secrets
+	EnvVars []string `json:"env_vars"`
+	IsRoot  bool     `json:"is_root"`
+	HasSudo bool     `json:"has_sudo"`
+}
+
+func (a *App) mcpSystemInfo(opts *options) (*mcpSystemInfo, error) {
+	info, err := a.systemInfo(opts)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(info.EnvVars))
+	for name := range info.EnvVars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return &mcpSystemInfo{
+		OS:         info.OS,
+		OSVersion:  info.OSVersion,
+		Shell:      info.Shell,
+		Username:   info.Username,
+		IsRoot:     info.IsRoot,
+		HasSudo:    info.HasSudo,
+		HomeDir:    info.HomeDir,
+		CurrentDir: info.CurrentDir,
+		EnvVars:    names,
+	}, nil
+}
+
+// objectSchema returns the JSON schema of tool arguments
+func objectSchema(required []string, properties map[string]interface{}) map[string]interface{} {
+	schema := map[string]interface{}{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+func stringProperty(description string) map[string]interface{} {
+	return map[string]interface{}{"type": "string", "description": description}
+}
@@ -0,0 +1,186 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/LubyRuffy/aic/pkg/executor"
+	"github.com/LubyRuffy/aic/pkg/ollama"
+	"github.com/LubyRuffy/aic/pkg/pipeline"
+	"github.com/LubyRuffy/aic/pkg/plan"
+	"github.com/LubyRuffy/aic/pkg/safety"
+	"github.com/LubyRuffy/aic/pkg/session"
+)
+
+// runPlan asks the model for an ordered list of steps and executes them one by one,
+// asking for confirmation before each step and offering to fix, skip or abort failed steps
+func (a *App) runPlan(opts *options, prompt, stdinContext string) int {
+	if opts.continueSession {
+		a.err.Error("Error: --plan cannot be combined with --continue\n")
+		return ExitError
+	}
+
+	request := prompt
+	var findings []string
+	if stdinContext != "" {
+		stdinContext = session.Truncate(stdinContext, maxStdinContext)
+		findings = a.scanContext("piped input", stdinContext)
+		request = ollama.PromptWithContext(prompt, stdinContext)
+	}
+
+	client := a.newClient(opts)
+	start := time.Now()
+	response, err := client.Plan(opts.model, request)
+	if err != nil {
+		a.err.Error("Error planning commands: %v\n", err)
+		return ExitError
+	}
+	steps, err := plan.Parse(response)
+	if err != nil {
+		a.err.Error("Error planning commands: %v\n", err)
+		return ExitError
+	}
+	p := &plan.Plan{Prompt: prompt, Model: opts.model, Steps: steps, DurationMs: time.Since(start).Milliseconds()}
+	if stdinContext != "" {
+		for _, step := range p.Steps {
+			step.Injection = checkInjection(step.Command, step.Risk, prompt, findings)
+		}
+	}
+
+	switch {
+	case opts.output == outputJSON:
+		enc := json.NewEncoder(a.Stdout)
+		enc.SetIndent("", "  ")
+		_ = enc.Encode(p)
+		return ExitOK
+	case opts.printOnly:
+		for _, step := range p.Steps {
+			fmt.Fprintln(a.Stdout, step.Command)
+		}
+		return ExitOK
+	}
+
+	a.printPlan(p)
+	if opts.dryRun {
+		return ExitOK
+	}
+	if !a.interactive && !opts.yes {
+		a.err.Error("Refusing to execute a plan without a terminal to confirm each step, use -yes to execute it anyway\n")
+		return ExitError
+	}
+
+	for i := 0; i < len(p.Steps); i++ {
+		step := p.Steps[i]
+		a.out.Info("\n[%d/%d] %s\n", i+1, len(p.Steps), step.Command)
+
+		if !opts.yes {
+			switch a.choose(fmt.Sprintf("Run step %d? [y]es, [s]kip, [a]bort: ", i+1), "yes", "skip", "abort") {
+			case "skip":
+				continue
+			case "yes":
+			default:
+				a.err.Warning("Plan aborted\n")
+				return ExitError
+			}
+		}
+
+		execResult, err := a.execute(opts, stepResult(p, step), a.Stdout, a.Stderr)
+		if err == nil {
+			continue
+		}
+		a.err.Error("Step %d failed: %v\n", i+1, err)
+		if !a.interactive {
+			return exitCode(err)
+		}
+
+		switch a.choose("[f]ix, [s]kip or [a]bort? ", "fix", "skip", "abort") {
+		case "fix":
+			fixed, fixErr := a.fixStep(opts, client, p, step, execResult)
+			if fixErr != nil {
+				a.err.Error("Error fixing step: %v\n", fixErr)
+				return exitCode(err)
+			}
+			p.Steps[i] = fixed
+			i--
+		case "skip":
+		default:
+			a.err.Warning("Plan aborted\n")
+			return exitCode(err)
+		}
+	}
+	return ExitOK
+}
+
+// printPlan prints the steps of p with their rationale and risk
+func (a *App) printPlan(p *plan.Plan) {
+	a.out.Info("Plan (%d steps):\n", len(p.Steps))
+	for i, step := range p.Steps {
+		fmt.Fprintf(a.Stdout, "%3d. %s\n", i+1, step.Command)
+		if step.Rationale != "" {
+			fmt.Fprintf(a.Stdout, "     %s\n", step.Rationale)
+		}
+		if step.Risk.AtLeast(safety.RiskMedium) {
+			a.out.Warning("     Risk: %s (%s)\n", step.Risk, step.Explanation)
+		}
+		if len(step.Injection) > 0 {
+			a.out.Warning("     Possible prompt injection: %s\n", strings.Join(step.Injection, "; "))
+		}
+	}
+}
+
+// fixStep asks the model for a corrected command for a failed step
+func (a *App) fixStep(opts *options, client *ollama.Client, p *plan.Plan, step *plan.Step, execResult *executor.ExecResult) (*plan.Step, error) {
+	exitCode := -1
+	if execResult != nil {
+		exitCode = execResult.ExitCode
+	}
+	output := session.Truncate(capturedOutput(execResult), session.MaxOutputSnippet)
+	findings := a.scanContext("output of the failed step", output)
+	response, err := client.Generate(opts.model, plan.FixPrompt(p.Prompt, step, exitCode, output))
+	if err != nil {
+		return nil, err
+	}
+	fixed := plan.NewStep(safety.Sanitize(response), step.Rationale)
+	if fixed.Command == "" {
+		return nil, fmt.Errorf("the model returned an empty command")
+	}
+	if fixed.Risk.AtLeast(safety.RiskMedium) {
+		a.err.Warning("The fixed command is %s risk: %s\n", fixed.Risk, fixed.Explanation)
+	}
+	// The fix was generated from the output of the step, which the user did not write
+	fixed.Injection = checkInjection(fixed.Command, fixed.Risk, p.Prompt+"\n"+step.Command, findings)
+	return fixed, nil
+}
+
+// stepResult converts a step to the result recorded in the audit log
+func stepResult(p *plan.Plan, step *plan.Step) *pipeline.Result {
+	return &pipeline.Result{
+		Prompt:      p.Prompt,
+		Command:     step.Command,
+		Model:       p.Model,
+		Risk:        step.Risk,
+		Explanation: step.Explanation,
+		Injection:   step.Injection,
+		Report:      step.Report,
+	}
+}
+
+// choose asks question until one of choices or its first letter is answered,
+// it returns the last choice when stdin is closed
+func (a *App) choose(question string, choices ...string) string {
+	for {
+		a.err.Warning("%s", question)
+		answer, err := readLine(a.Stdin)
+		if err != nil {
+			return choices[len(choices)-1]
+		}
+		answer = strings.ToLower(strings.TrimSpace(answer))
+		for _, c := range choices {
+			if answer != "" && (answer == c || answer == c[:1]) {
+				return c
+			}
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/LubyRuffy/aic/pkg/policy"
+)
+
+// runPolicy runs `aic policy test <command>`, showing how the machine-wide policy treats command
+func (a *App) runPolicy(opts *options, args []string) int {
+	if len(args) < 2 || args[0] != "test" {
+		a.err.Warning("Usage: aic policy test <command>\n")
+		return ExitError
+	}
+	command := strings.Join(args[1:], " ")
+
+	if opts.policy == nil {
+		a.out.Info("No policy at %s, all commands are allowed\n", a.policyPath())
+		return ExitOK
+	}
+	d := opts.policy.Check(command, a.policyDir(opts))
+	switch d.Action {
+	case policy.ActionDeny:
+		a.out.Error("Denied: %s\n", d)
+		return ExitError
+	case policy.ActionConfirm:
+		a.out.Warning("Confirm: %s\n", d)
+	default:
+		a.out.Success("Allowed by %s (%d rules)\n", opts.policy.Path, len(opts.policy.Rules))
+	}
+	return ExitOK
+}
+
+// matchPolicy reports whether args are meant for the policy subcommand rather than a prompt
+func (a *App) matchPolicy(args []string) bool {
+	return len(args) >= 2 && args[0] == "test"
+}
+
+// policyPath returns the path of the machine-wide policy file
+func (a *App) policyPath() string {
+	if a.PolicyPath != "" {
+		return a.PolicyPath
+	}
+	return policy.DefaultPath()
+}
+
+// loadPolicy loads the machine-wide policy, an invalid policy is an error rather than being ignored
+func (a *App) loadPolicy(opts *options) error {
+	p, err := policy.Load(a.policyPath())
+	if err != nil {
+		return err
+	}
+	opts.policy = p
+	return nil
+}
+
+// policyDir returns the working directory relative paths of commands are resolved against,
+// which is the remote one for -host and -container
+func (a *App) policyDir(opts *options) string {
+	if opts.remote != nil || opts.container != nil {
+		if info, err := a.systemInfo(opts); err == nil {
+			return info.CurrentDir
+		}
+		return ""
+	}
+	dir, _ := os.Getwd()
+	return dir
+}
+
+// enforcePolicy checks command against the machine-wide policy before it runs.
+// Denied commands are never executed, and commands requiring confirmation are confirmed on the terminal
+// even with -yes, as the policy cannot be overridden by the user. In dry-run mode the decision is only shown
+func (a *App) enforcePolicy(opts *options, command string) error {
+	d := opts.policy.Check(command, a.policyDir(opts))
+	if d.Allowed() {
+		return nil
+	}
+	if opts.dryRun {
+		a.err.Warning("Policy: %s\n", d)
+		return nil
+	}
+	if d.Action == policy.ActionDeny {
+		return fmt.Errorf("command %s", d)
+	}
+
+	a.err.Warning("%s\n", command)
+	a.err.Warning("This command %s\n", d)
+	if !a.interactive {
+		return errors.New("command requires confirmation by policy and cannot be confirmed without a terminal")
+	}
+	if !a.confirm("Execute it? [y/N] ") {
+		return errors.New("command not confirmed")
+	}
+	return nil
+}
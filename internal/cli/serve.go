@@ -0,0 +1,189 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/LubyRuffy/aic/pkg/executor"
+	"github.com/LubyRuffy/aic/pkg/pipeline"
+	"github.com/LubyRuffy/aic/pkg/server"
+)
+
+// Defaults of aic serve
+const (
+	defaultListen        = "127.0.0.1:8765"
+	defaultMaxConcurrent = 4
+	serveExecTimeout     = time.Minute
+	serveModelTimeout    = 5 * time.Minute
+	serveCaptureLimit    = 64 * 1024
+	shutdownTimeout      = 10 * time.Second
+)
+
+// runServe runs `aic serve`, exposing generate, explain and optionally execute over HTTP
+func (a *App) runServe(opts *options, args []string) int {
+	fs := flag.NewFlagSet("aic serve", flag.ContinueOnError)
+	fs.SetOutput(a.Stderr)
+	listen := fs.String("listen", defaultListen, "Address to listen on")
+	allowExecute := fs.Bool("allow-execute", false, "Enable the /v1/execute endpoint, requires a token")
+	token := fs.String("token", "", "Bearer token required by /v1/execute (default: $AIC_SERVE_TOKEN)")
+	maxConcurrent := fs.Int("max-concurrent", defaultMaxConcurrent, "Maximum number of requests handled at the same time")
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return ExitOK
+		}
+		return ExitError
+	}
+	if fs.NArg() > 0 {
+		a.err.Error("Error: unexpected arguments: %s\n", strings.Join(fs.Args(), " "))
+		return ExitError
+	}
+	if *token == "" {
+		*token = os.Getenv("AIC_SERVE_TOKEN")
+	}
+	if *allowExecute && *token == "" {
+		a.err.Error("Error: --allow-execute requires --token or AIC_SERVE_TOKEN\n")
+		return ExitError
+	}
+
+	ln, err := net.Listen("tcp", *listen)
+	if err != nil {
+		a.err.Error("Error: %v\n", err)
+		return ExitError
+	}
+	// Requests are handled concurrently, so nothing can be confirmed on the terminal,
+	// and a hanging model must not hold a request slot forever
+	a.interactive = false
+	opts.modelTimeout = serveModelTimeout
+	srv := a.newServer(opts)
+	srv.AllowExecute = *allowExecute
+	srv.Token = *token
+	srv.MaxConcurrent = *maxConcurrent
+
+	a.err.Info("Listening on http://%s (execute %s)\n", ln.Addr(), map[bool]string{true: "enabled", false: "disabled"}[*allowExecute])
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if err := serveHTTP(ctx, &http.Server{Handler: srv.Handler(), ReadHeaderTimeout: 10 * time.Second}, ln); err != nil {
+		a.err.Error("Error: %v\n", err)
+		return ExitError
+	}
+	a.err.Info("Server stopped\n")
+	return ExitOK
+}
+
+// matchOptions reports whether args are options of the subcommand, so that prompts like
+// "serve this directory over http" are still generated
+func (a *App) matchOptions(args []string) bool {
+	return len(args) == 0 || strings.HasPrefix(args[0], "-")
+}
+
+// newServer creates the HTTP API backed by the same generation, analysis and execution as the CLI
+func (a *App) newServer(opts *options) *server.Server {
+	return &server.Server{
+		Backend: &serveBackend{app: a, opts: opts},
+		Model:   opts.model,
+		Logger:  log.New(a.Stderr, "", log.LstdFlags),
+	}
+}
+
+// serveHTTP serves on ln until ctx is done, then shuts down gracefully waiting for running requests
+func serveHTTP(ctx context.Context, srv *http.Server, ln net.Listener) error {
+	errc := make(chan error, 1)
+	go func() {
+		errc <- srv.Serve(ln)
+	}()
+
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		return err
+	}
+	if err := <-errc; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// serveBackend implements server.Backend with the CLI's options
+type serveBackend struct {
+	app  *App
+	opts *options
+}
+
+// withModel returns a copy of the options using model
+func (b *serveBackend) withModel(model string) *options {
+	o := *b.opts
+	o.model = model
+	o.continueSession = false
+	return &o
+}
+
+func (b *serveBackend) Generate(model, prompt string) (*pipeline.Result, error) {
+	return b.app.generate(b.withModel(model), prompt, prompt, nil)
+}
+
+func (b *serveBackend) Explain(model, command string) (*pipeline.Explanation, error) {
+	return pipeline.Explain(b.app.newClient(b.withModel(model)), model, command)
+}
+
+// Execute runs the command without a terminal, capturing its output, and records it in the audit log
+func (b *serveBackend) Execute(result *pipeline.Result) (*executor.ExecResult, error) {
+	return b.app.executeWith(b.opts, b.app.captureExecutor(b.opts), result)
+}
+
+// captureExecutor creates an executor for commands run on behalf of a remote client:
+// there is no terminal, the output is captured and a default timeout applies
+func (a *App) captureExecutor(opts *options) executor.CommandExecutor {
+	if opts.dryRun {
+		return executor.NoopExecutor{}
+	}
+	if a.NewExecutor != nil {
+		return a.NewExecutor(io.Discard, io.Discard)
+	}
+	timeout := opts.execTimeout
+	if timeout == 0 {
+		timeout = serveExecTimeout
+	}
+
+	if opts.remote != nil {
+		exec := opts.remote.NewExecutor()
+		exec.Stdin = nil
+		exec.Stdout = nil
+		exec.Stderr = nil
+		exec.ForwardSignals = false
+		exec.CaptureLimit = serveCaptureLimit
+		exec.Timeout = timeout
+		return exec
+	}
+	exec := executor.NewShellExecutor()
+	exec.Shell = &opts.sh
+	if opts.container != nil {
+		exec.Wrapper = opts.container.Wrapper()
+	}
+	if opts.box != nil {
+		exec.Wrapper = opts.box.Wrapper()
+	}
+	exec.Stdin = nil
+	exec.Stdout = nil
+	exec.Stderr = nil
+	exec.ForwardSignals = false
+	exec.PTY = false
+	exec.CaptureLimit = serveCaptureLimit
+	exec.Timeout = timeout
+	return exec
+}
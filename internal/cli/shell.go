@@ -0,0 +1,84 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/LubyRuffy/aic/pkg/completion"
+	"github.com/LubyRuffy/aic/pkg/shellinit"
+)
+
+// runShellInit prints the shell integration script
+func (a *App) runShellInit(_ *options, args []string) int {
+	if len(args) != 1 {
+		a.err.Warning("Usage: aic shell-init <%s>\n", strings.Join(shellinit.Shells(), "|"))
+		return ExitError
+	}
+	script, err := shellinit.Script(args[0])
+	if err != nil {
+		a.err.Error("Error: %v\n", err)
+		return ExitError
+	}
+	fmt.Fprint(a.Stdout, script)
+	return ExitOK
+}
+
+// runCompletion prints the shell completion script
+func (a *App) runCompletion(_ *options, args []string) int {
+	if len(args) != 1 {
+		a.err.Warning("Usage: aic completion <%s>\n", strings.Join(completion.Shells(), "|"))
+		return ExitError
+	}
+	script, err := completion.Script(args[0], a.completionSpec())
+	if err != nil {
+		a.err.Error("Error: %v\n", err)
+		return ExitError
+	}
+	fmt.Fprint(a.Stdout, script)
+	return ExitOK
+}
+
+// runComplete prints the candidates for dynamic completion, errors are silently ignored
+func (a *App) runComplete(opts *options, args []string) int {
+	if len(args) != 1 {
+		return ExitOK
+	}
+
+	var values []string
+	switch args[0] {
+	case completion.KindModels:
+		values, _ = a.newClient(opts).ListModels()
+	case completion.KindProfiles:
+		values = opts.cfg.ProfileNames()
+	}
+	for _, v := range values {
+		fmt.Fprintln(a.Stdout, v)
+	}
+	return ExitOK
+}
+
+// completionSpec describes the command line for the completion scripts
+func (a *App) completionSpec() completion.Spec {
+	spec := completion.Spec{Shells: shellinit.Shells()}
+	for _, cmd := range commands() {
+		if !cmd.hidden {
+			spec.Subcommands = append(spec.Subcommands, cmd.name)
+		}
+	}
+
+	a.flagSet(&options{}).VisitAll(func(f *flag.Flag) {
+		cf := completion.Flag{Name: f.Name, Usage: f.Usage, HasValue: true}
+		if b, ok := f.Value.(interface{ IsBoolFlag() bool }); ok && b.IsBoolFlag() {
+			cf.HasValue = false
+		}
+		switch f.Name {
+		case "model":
+			cf.Complete = completion.KindModels
+		case "profile":
+			cf.Complete = completion.KindProfiles
+		}
+		spec.Flags = append(spec.Flags, cf)
+	})
+	return spec
+}
@@ -0,0 +1,45 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/LubyRuffy/aic/pkg/safety"
+)
+
+// enforcePrivileges checks commands escalating privileges with sudo, doas or su before they run.
+// With -no-sudo they are never executed, with -allow-sudo or -yes they are executed as is,
+// otherwise they need confirmation on the terminal.
+// With -no-sudo, commands running a program that cannot be determined are refused as well since it may be sudo
+func (a *App) enforcePrivileges(opts *options, command string) error {
+	program := safety.Escalation(command)
+	reason := fmt.Sprintf("the command escalates privileges with %s", program)
+	if undetermined := safety.Undetermined(command); program == "" && opts.noSudo && undetermined != "" {
+		program = safety.UnknownProgram
+		reason = fmt.Sprintf("the command runs a program that cannot be determined (%s) and may escalate privileges", undetermined)
+	}
+	if program == "" || opts.allowSudo {
+		return nil
+	}
+	if opts.dryRun {
+		a.err.Warning("Privileges: %s\n", reason)
+		return nil
+	}
+
+	if opts.noSudo {
+		a.err.Warning("%s\n", command)
+		return fmt.Errorf("not executed: %s and -no-sudo is set, review the command above and run it yourself if it is intended", reason)
+	}
+	if opts.yes {
+		return nil
+	}
+	a.err.Warning("%s\n", command)
+	a.err.Warning("This command runs with elevated privileges (%s)\n", program)
+	if !a.interactive {
+		return fmt.Errorf("not executed: %s and cannot be confirmed without a terminal, use -allow-sudo to execute it anyway", reason)
+	}
+	if !a.confirm("Execute it with elevated privileges? [y/N] ") {
+		return errors.New("command not executed")
+	}
+	return nil
+}
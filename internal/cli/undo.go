@@ -0,0 +1,162 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+
+	"github.com/LubyRuffy/aic/pkg/executor"
+	"github.com/LubyRuffy/aic/pkg/history"
+	"github.com/LubyRuffy/aic/pkg/pipeline"
+	"github.com/LubyRuffy/aic/pkg/safety"
+	"github.com/LubyRuffy/aic/pkg/snapshot"
+)
+
+// snapshotID matches the IDs generated by history.NewID
+var snapshotID = regexp.MustCompile(`^\d{8}-\d{6}-[0-9a-f]{4}$`)
+
+// runUndo runs `aic undo [id]`, restoring the files saved before the last command or the snapshot id
+func (a *App) runUndo(opts *options, args []string) int {
+	store, err := a.newSnapshotStore(opts)
+	if err != nil {
+		a.err.Error("Error: %v\n", err)
+		return ExitError
+	}
+	var snap *snapshot.Snapshot
+	if len(args) == 0 {
+		snap, err = store.Latest()
+	} else {
+		snap, err = store.Load(args[0])
+	}
+	if err != nil {
+		if errors.Is(err, snapshot.ErrNoSnapshot) {
+			a.err.Error("No snapshot to restore, run commands with -snapshot to save one\n")
+		} else {
+			a.err.Error("Error: %v\n", err)
+		}
+		return ExitError
+	}
+
+	a.err.Warning("Snapshot %s taken %s before: %s\n", snap.ID, snap.Time.Format("2006-01-02 15:04:05"), snap.Command)
+	for _, f := range snap.Files {
+		if f.Kind == snapshot.KindMissing {
+			a.err.Warning("  remove  %s\n", f.Path)
+		} else {
+			a.err.Warning("  restore %s\n", f.Path)
+		}
+	}
+	if !opts.yes {
+		if !a.interactive {
+			a.err.Error("Refusing to restore files without a terminal, use -yes to restore them anyway\n")
+			return ExitError
+		}
+		if !a.confirm("Restore these files? [y/N] ") {
+			a.err.Warning("Nothing restored\n")
+			return ExitError
+		}
+	}
+
+	if err := store.Restore(snap); err != nil {
+		a.err.Error("Error restoring snapshot %s: %v\n", snap.ID, err)
+		return ExitError
+	}
+	if err := store.Delete(snap.ID); err != nil {
+		a.err.Warning("Failed to delete snapshot: %v\n", err)
+	}
+	a.out.Success("Restored %d paths from snapshot %s\n", len(snap.Files), snap.ID)
+	return ExitOK
+}
+
+// matchUndo reports whether args are meant for the undo subcommand rather than a prompt
+func (a *App) matchUndo(args []string) bool {
+	return len(args) == 0 || (len(args) == 1 && snapshotID.MatchString(args[0]))
+}
+
+// newSnapshotStore creates the snapshot store with the limits from the config file
+func (a *App) newSnapshotStore(opts *options) (*snapshot.Store, error) {
+	dir, err := a.configDir()
+	if err != nil {
+		return nil, err
+	}
+	store := snapshot.New(filepath.Join(dir, snapshot.DirName))
+
+	cfg := opts.cfg.Snapshot
+	if cfg.MaxFileMB > 0 {
+		store.MaxFileSize = cfg.MaxFileMB << 20
+	}
+	if cfg.MaxTotalMB > 0 {
+		store.MaxTotalSize = cfg.MaxTotalMB << 20
+	}
+	if cfg.Keep > 0 {
+		store.Keep = cfg.Keep
+	}
+	return store, nil
+}
+
+// takeSnapshot saves the files in the current directory the command of result deletes or modifies,
+// it returns nil when snapshots are disabled or the command does not touch any files.
+// Commands run on a -host or in a -container modify files aic cannot copy, so they are not saved
+func (a *App) takeSnapshot(opts *options, result *pipeline.Result) (*snapshot.Snapshot, error) {
+	if !(opts.snapshot || opts.cfg.Snapshot.Enabled) || opts.dryRun || opts.remote != nil || opts.container != nil {
+		return nil, nil
+	}
+	paths := safety.AffectedPaths(result.Command)
+	if len(paths) == 0 {
+		return nil, nil
+	}
+
+	store, err := a.newSnapshotStore(opts)
+	if err != nil {
+		return nil, err
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		return nil, fmt.Errorf("error getting working directory: %v", err)
+	}
+	snap, err := store.Take(history.NewID(time.Now()), result.Command, cwd, paths)
+	if err != nil {
+		return nil, fmt.Errorf("error saving snapshot: %v", err)
+	}
+	if snap == nil {
+		return nil, nil
+	}
+	for _, s := range snap.Skipped {
+		a.err.Warning("Not saved in the snapshot: %s (%s)\n", s.Path, s.Reason)
+	}
+	if len(snap.Files) == 0 {
+		return nil, nil
+	}
+	if opts.verbose {
+		a.err.Info("Saved snapshot %s of %d paths, restore them with aic undo\n", snap.ID, len(snap.Files))
+	}
+	return snap, nil
+}
+
+// recordSnapshot records the command a snapshot was taken for in the history,
+// failures are reported but do not change the exit code as the command already ran
+func (a *App) recordSnapshot(result *pipeline.Result, snap *snapshot.Snapshot, execResult *executor.ExecResult) {
+	dir, err := a.configDir()
+	if err != nil {
+		a.err.Warning("Failed to write history: %v\n", err)
+		return
+	}
+	step := history.Step{Command: result.Command}
+	if execResult != nil {
+		step.ExitCode = execResult.ExitCode
+	}
+	entry := &history.Entry{
+		ID:       snap.ID,
+		Time:     snap.Time,
+		Kind:     history.KindCommand,
+		Prompt:   result.Prompt,
+		Model:    result.Model,
+		Steps:    []history.Step{step},
+		Snapshot: snap.ID,
+	}
+	if err := history.Append(filepath.Join(dir, history.FileName), entry); err != nil {
+		a.err.Warning("Failed to write history: %v\n", err)
+	}
+}
@@ -0,0 +1,58 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/LubyRuffy/aic/pkg/injection"
+)
+
+// Action 是模型在agent模式下的一次回复：要执行的下一条命令，或者最终的回答
+type Action struct {
+	Command string `json:"command"`
+	Reason  string `json:"reason"`
+	Answer  string `json:"answer"`
+}
+
+// BudgetExhausted 是步数用完后要求模型直接回答的提示词
+const BudgetExhausted = `The step budget is exhausted, no more commands can be run. Respond now with {"answer": "..."} based on what you found so far.`
+
+// ParseAction 解析模型返回的JSON，必须包含command或answer
+func ParseAction(response string) (*Action, error) {
+	start := strings.Index(response, "{")
+	end := strings.LastIndex(response, "}")
+	if start < 0 || end < start {
+		return nil, fmt.Errorf("no JSON object in response %q", response)
+	}
+
+	var a Action
+	if err := json.Unmarshal([]byte(response[start:end+1]), &a); err != nil {
+		return nil, fmt.Errorf("invalid JSON in response: %v", err)
+	}
+	a.Command = strings.TrimSpace(a.Command)
+	a.Answer = strings.TrimSpace(a.Answer)
+	if a.Command == "" && a.Answer == "" {
+		return nil, fmt.Errorf("response has neither a command nor an answer")
+	}
+	return &a, nil
+}
+
+// Observation 生成把命令的执行结果反馈给模型的消息
+func Observation(command string, exitCode int, output string) string {
+	output = strings.TrimRight(output, "\n")
+	if output == "" {
+		output = "(no output)"
+	}
+	return fmt.Sprintf("Command: %s\nExit code: %d\nOutput (possibly truncated):\n%s", command, exitCode, injection.Wrap("command output", output))
+}
+
+// Rejected 生成告诉模型命令被拒绝执行的消息
+func Rejected(command, reason string) string {
+	return fmt.Sprintf("Command rejected, it was not run: %s\nReason: %s\nOnly read-only commands are allowed, choose another command or answer.", command, reason)
+}
+
+// Invalid 生成告诉模型回复格式错误的消息
+func Invalid(err error) string {
+	return fmt.Sprintf(`Your response could not be used: %v. Respond with a JSON object {"command": "...", "reason": "..."} or {"answer": "..."}.`, err)
+}
@@ -0,0 +1,40 @@
+package agent
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestParseAction(t *testing.T) {
+	a, err := ParseAction("```json\n{\"command\": \" lsof -i :8080 \", \"reason\": \"find the owner\"}\n```")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Command != "lsof -i :8080" || a.Reason != "find the owner" || a.Answer != "" {
+		t.Errorf("Unexpected action: %+v", a)
+	}
+
+	a, err = ParseAction(`{"answer": "nginx (pid 42) owns port 8080"}`)
+	if err != nil || a.Answer != "nginx (pid 42) owns port 8080" {
+		t.Errorf("ParseAction() = %+v, %v", a, err)
+	}
+
+	for _, response := range []string{"lsof -i :8080", `{"reason": "thinking"}`, `{"command": 1}`} {
+		if _, err := ParseAction(response); err == nil {
+			t.Errorf("ParseAction(%q) error = nil", response)
+		}
+	}
+}
+
+func TestMessages(t *testing.T) {
+	if got := Observation("ls", 0, ""); !strings.Contains(got, "Exit code: 0") || !strings.Contains(got, "(no output)") {
+		t.Errorf("Observation() = %q", got)
+	}
+	if got := Rejected("rm x", "deletes files"); !strings.Contains(got, "rm x") || !strings.Contains(got, "deletes files") {
+		t.Errorf("Rejected() = %q", got)
+	}
+	if got := Invalid(errors.New("bad")); !strings.Contains(got, "bad") {
+		t.Errorf("Invalid() = %q", got)
+	}
+}
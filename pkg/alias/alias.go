@@ -0,0 +1,251 @@
+package alias
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// FileName 是配置目录下保存命令别名的文件名称
+const FileName = "aliases.json"
+
+// Alias 是以名称保存的命令，命令中可以使用 {{1}}、{{2}} 等位置参数
+type Alias struct {
+	Name    string `json:"name"`
+	Command string `json:"command"`
+	// Shell 是命令生成时使用的shell
+	Shell   string    `json:"shell,omitempty"`
+	Created time.Time `json:"created"`
+}
+
+// Library 是一组命令别名
+type Library struct {
+	Aliases map[string]*Alias `json:"aliases"`
+}
+
+// 别名名称只能包含字母、数字、点、下划线和连字符
+var nameRe = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// placeholderRe 匹配命令中的位置参数
+var placeholderRe = regexp.MustCompile(`\{\{\s*(\d+)\s*\}\}`)
+
+// ValidateName 检查别名名称是否合法
+func ValidateName(name string) error {
+	if !nameRe.MatchString(name) {
+		return fmt.Errorf("invalid alias name %q, use letters, digits, '.', '_' and '-'", name)
+	}
+	return nil
+}
+
+// Load 从path读取别名，文件不存在时返回空的别名库
+func Load(path string) (*Library, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return &Library{Aliases: make(map[string]*Alias)}, nil
+		}
+		return nil, fmt.Errorf("error reading aliases: %v", err)
+	}
+	return parse(data)
+}
+
+// Save 将别名库写入path，必要时创建目录
+func (l *Library) Save(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return fmt.Errorf("error creating alias directory: %v", err)
+	}
+	data, err := json.MarshalIndent(l, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error serializing aliases: %v", err)
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0o600); err != nil {
+		return fmt.Errorf("error writing aliases: %v", err)
+	}
+	return nil
+}
+
+// Names 返回按名称排序的别名列表
+func (l *Library) Names() []string {
+	names := make([]string, 0, len(l.Aliases))
+	for name := range l.Aliases {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Add 添加别名，同名的别名已存在时返回错误
+func (l *Library) Add(a *Alias) error {
+	if err := ValidateName(a.Name); err != nil {
+		return err
+	}
+	if _, ok := l.Aliases[a.Name]; ok {
+		return fmt.Errorf("alias %q already exists", a.Name)
+	}
+	if err := Validate(a.Command); err != nil {
+		return fmt.Errorf("alias %q: %v", a.Name, err)
+	}
+	l.Aliases[a.Name] = a
+	return nil
+}
+
+// Export 将别名库以JSON格式写入w
+func (l *Library) Export(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(l)
+}
+
+// Import 从r读取导出的别名并合并到别名库中
+// 已存在的同名别名不会被覆盖，命令不同的同名别名作为冲突返回
+func (l *Library) Import(r io.Reader) (added int, conflicts []string, err error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return 0, nil, fmt.Errorf("error reading aliases: %v", err)
+	}
+	other, err := parse(data)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	for _, name := range other.Names() {
+		a := other.Aliases[name]
+		if err := Validate(a.Command); err != nil {
+			return 0, nil, fmt.Errorf("alias %q: %v", name, err)
+		}
+		if existing, ok := l.Aliases[name]; ok {
+			if existing.Command != a.Command {
+				conflicts = append(conflicts, name)
+			}
+			continue
+		}
+		l.Aliases[name] = a
+		added++
+	}
+	return added, conflicts, nil
+}
+
+// parse 解析别名库，并检查名称是否合法
+func parse(data []byte) (*Library, error) {
+	var l Library
+	if err := json.Unmarshal(data, &l); err != nil {
+		return nil, fmt.Errorf("error parsing aliases: %v", err)
+	}
+	if l.Aliases == nil {
+		l.Aliases = make(map[string]*Alias)
+	}
+	for name, a := range l.Aliases {
+		if err := ValidateName(name); err != nil {
+			return nil, err
+		}
+		a.Name = name
+	}
+	return &l, nil
+}
+
+// Params 返回命令需要的位置参数的个数，即最大的参数序号
+func Params(command string) int {
+	n := 0
+	for _, m := range placeholderRe.FindAllStringSubmatch(command, -1) {
+		if i, err := strconv.Atoi(m[1]); err == nil && i > n {
+			n = i
+		}
+	}
+	return n
+}
+
+// Validate 检查命令中的位置参数是否都在引号、反引号和 $(...) 之外
+// 参数替换时会按shell的规则加上引号，在已有的引号或命令替换中再加一层引号无法保证参数只被当作数据
+func Validate(command string) error {
+	for _, loc := range placeholderRe.FindAllStringIndex(command, -1) {
+		if context := quoteContext(command[:loc[0]]); context != "" {
+			return fmt.Errorf("placeholder %s is inside %s, remove them around it as arguments are quoted automatically", command[loc[0]:loc[1]], context)
+		}
+	}
+	return nil
+}
+
+// quoteContext 返回命令前缀s结束时所在的引号或命令替换，不在其中时返回空字符串
+func quoteContext(s string) string {
+	var stack []string
+	top := func() string {
+		if len(stack) == 0 {
+			return ""
+		}
+		return stack[len(stack)-1]
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch top() {
+		case "single quotes":
+			if c == '\'' {
+				stack = stack[:len(stack)-1]
+			}
+			continue
+		case "double quotes":
+			switch {
+			case c == '\\':
+				i++
+			case c == '"':
+				stack = stack[:len(stack)-1]
+			case c == '`':
+				stack = append(stack, "backticks")
+			case c == '$' && i+1 < len(s) && s[i+1] == '(':
+				stack = append(stack, "$(...)")
+				i++
+			}
+			continue
+		}
+		switch {
+		case c == '\\':
+			i++
+		case c == '\'':
+			stack = append(stack, "single quotes")
+		case c == '"':
+			stack = append(stack, "double quotes")
+		case c == '`':
+			if top() == "backticks" {
+				stack = stack[:len(stack)-1]
+			} else {
+				stack = append(stack, "backticks")
+			}
+		case c == '$' && i+1 < len(s) && s[i+1] == '(':
+			stack = append(stack, "$(...)")
+			i++
+		case c == '(' && top() == "$(...)":
+			// 命令替换中的括号和命令替换一起配对
+			stack = append(stack, "$(...)")
+		case c == ')' && top() == "$(...)":
+			stack = stack[:len(stack)-1]
+		}
+	}
+	return top()
+}
+
+// Expand 将命令中的位置参数替换为经过quote转义的args，位置参数在引号或命令替换中时返回错误
+func Expand(command string, args []string, quote func(string) string) (string, error) {
+	if err := Validate(command); err != nil {
+		return "", err
+	}
+	if n := Params(command); len(args) != n {
+		return "", fmt.Errorf("command takes %d argument(s), got %d", n, len(args))
+	}
+
+	var err error
+	expanded := placeholderRe.ReplaceAllStringFunc(command, func(m string) string {
+		i, _ := strconv.Atoi(placeholderRe.FindStringSubmatch(m)[1])
+		if i < 1 {
+			err = fmt.Errorf("invalid placeholder %s, arguments start at {{1}}", m)
+			return m
+		}
+		return quote(args[i-1])
+	})
+	return expanded, err
+}
@@ -0,0 +1,111 @@
+package alias
+
+import (
+	"bytes"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/LubyRuffy/aic/pkg/shell"
+)
+
+func TestExpand(t *testing.T) {
+	bash, _ := shell.Lookup("bash")
+	tests := []struct {
+		command string
+		args    []string
+		want    string
+		wantErr bool
+	}{
+		{"du -sh * | sort -h", nil, "du -sh * | sort -h", false},
+		{"du -sh {{1}} | head -n {{2}}", []string{"/var/log", "5"}, "du -sh '/var/log' | head -n '5'", false},
+		{"grep {{ 1 }} {{1}}.log", []string{"x"}, "grep 'x' 'x'.log", false},
+		{"echo {{1}}", []string{"$(rm -rf ~); 'quoted'"}, `echo '$(rm -rf ~); '\''quoted'\'''`, false},
+		{"echo {{2}}", []string{"a"}, "", true},
+		{"echo {{1}}", []string{"a", "b"}, "", true},
+		{"echo {{0}}", nil, "", true},
+		{`grep -r "{{1}}" .`, []string{"$(touch /tmp/pwned)"}, "", true},
+		{"grep -r '{{1}}' .", []string{"x"}, "", true},
+		{"echo `cat {{1}}`", []string{"x"}, "", true},
+		{"echo $(cat {{1}})", []string{"x"}, "", true},
+		{`echo "$(cat {{1}})"`, []string{"x"}, "", true},
+		{`echo "a" {{1}} 'b' $(date) ` + "`id`" + ` \" {{2}}`, []string{"x", "y"}, `echo "a" 'x' 'b' $(date) ` + "`id`" + ` \" 'y'`, false},
+		{"(cd {{1}} && ls)", []string{"x"}, "(cd 'x' && ls)", false},
+	}
+	for _, tt := range tests {
+		got, err := Expand(tt.command, tt.args, bash.Quote)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("Expand(%q, %q) error = %v, wantErr %v", tt.command, tt.args, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && got != tt.want {
+			t.Errorf("Expand(%q, %q) = %q, want %q", tt.command, tt.args, got, tt.want)
+		}
+	}
+}
+
+func TestLibrary(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sub", FileName)
+	lib, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := lib.Add(&Alias{Name: "disk-hogs", Command: "du -sh * | sort -h"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := lib.Add(&Alias{Name: "disk-hogs", Command: "other"}); err == nil {
+		t.Error("Expected error adding a duplicate alias")
+	}
+	if err := lib.Add(&Alias{Name: "../evil", Command: "ls"}); err == nil {
+		t.Error("Expected error for an invalid name")
+	}
+	if err := lib.Add(&Alias{Name: "find", Command: "grep -r '{{1}}' ."}); err == nil {
+		t.Error("Expected error for a placeholder inside quotes")
+	}
+	if err := lib.Save(path); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := loaded.Names(); !reflect.DeepEqual(got, []string{"disk-hogs"}) {
+		t.Errorf("Names() = %v", got)
+	}
+}
+
+func TestExportImport(t *testing.T) {
+	src := &Library{Aliases: map[string]*Alias{
+		"a": {Name: "a", Command: "ls"},
+		"b": {Name: "b", Command: "pwd"},
+		"c": {Name: "c", Command: "date"},
+	}}
+	var buf bytes.Buffer
+	if err := src.Export(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	dst := &Library{Aliases: map[string]*Alias{
+		"a": {Name: "a", Command: "ls"},
+		"b": {Name: "b", Command: "whoami"},
+	}}
+	added, conflicts, err := dst.Import(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if added != 1 || !reflect.DeepEqual(conflicts, []string{"b"}) {
+		t.Errorf("Import() = %d, %v", added, conflicts)
+	}
+	if dst.Aliases["b"].Command != "whoami" || dst.Aliases["c"].Command != "date" {
+		t.Errorf("Unexpected aliases after import: %v", dst.Names())
+	}
+
+	if _, _, err := dst.Import(strings.NewReader(`{"aliases": {"bad name": {"command": "ls"}}}`)); err == nil {
+		t.Error("Expected error importing an invalid name")
+	}
+	if _, _, err := dst.Import(strings.NewReader(`{"aliases": {"find": {"command": "grep -r \\"{{1}}\\" ."}}}`)); err == nil {
+		t.Error("Expected error importing a placeholder inside quotes")
+	}
+}
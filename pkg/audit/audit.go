@@ -0,0 +1,228 @@
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/user"
+	"path/filepath"
+	"time"
+
+	"github.com/LubyRuffy/aic/pkg/safety"
+)
+
+// 审计日志的输出方式
+const (
+	SinkFile   = "file"
+	SinkSyslog = "syslog"
+)
+
+// FileName 是配置目录下默认的审计日志文件名称
+const FileName = "audit.jsonl"
+
+// Entry 是审计日志中的一条记录，对应一次实际执行的命令
+type Entry struct {
+	Time       time.Time    `json:"time"`
+	User       string       `json:"user"`
+	Host       string       `json:"host"`
+	Cwd        string       `json:"cwd"`
+	Prompt     string       `json:"prompt"`
+	Model      string       `json:"model"`
+	ServerURL  string       `json:"server_url"`
+	Command    string       `json:"command"`
+	Risk       safety.Level `json:"risk"`
+	ExitCode   int          `json:"exit_code"`
+	DurationMs int64        `json:"duration_ms"`
+	// Target 是执行命令的远程目标，在本机执行时为空
+	Target string `json:"target,omitempty"`
+	// Error 是命令没有启动的原因，此时 ExitCode 为 -1
+	Error string `json:"error,omitempty"`
+
+	// PrevHash 和 Hash 组成哈希链，用于检测日志是否被篡改，只在文件日志中使用
+	PrevHash string `json:"prev_hash,omitempty"`
+	Hash     string `json:"hash,omitempty"`
+}
+
+// NewEntry 创建一条填充了当前用户、主机和工作目录的记录
+func NewEntry() *Entry {
+	e := &Entry{Time: time.Now().UTC()}
+	if u, err := user.Current(); err == nil {
+		e.User = u.Username
+	}
+	e.Host, _ = os.Hostname()
+	e.Cwd, _ = os.Getwd()
+	return e
+}
+
+// Sink 是审计日志的输出位置
+type Sink interface {
+	Write(e *Entry) error
+	Close() error
+}
+
+// Open 根据sink类型创建审计日志，path 只对文件日志有效
+func Open(sink, path string) (Sink, error) {
+	switch sink {
+	case "", SinkFile:
+		return &FileSink{Path: path}, nil
+	case SinkSyslog:
+		return newSyslogSink()
+	default:
+		return nil, fmt.Errorf("unsupported audit sink %q, use %s or %s", sink, SinkFile, SinkSyslog)
+	}
+}
+
+// FileSink 是以JSON Lines格式追加写入的文件审计日志
+// 每条记录都包含前一条记录的哈希，形成可以校验的哈希链
+type FileSink struct {
+	Path string
+}
+
+// Write 把记录追加到日志文件的末尾
+func (s *FileSink) Write(e *Entry) error {
+	if err := os.MkdirAll(filepath.Dir(s.Path), 0o700); err != nil {
+		return fmt.Errorf("error creating audit log directory: %v", err)
+	}
+
+	f, err := os.OpenFile(s.Path, os.O_RDWR|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return fmt.Errorf("error opening audit log: %v", err)
+	}
+	defer f.Close()
+
+	// 加锁保证读取最后一条记录和追加写入之间不会有其他进程写入
+	if err := lockFile(f); err != nil {
+		return fmt.Errorf("error locking audit log: %v", err)
+	}
+	defer unlockFile(f)
+
+	last, err := lastLine(f)
+	if err != nil {
+		return fmt.Errorf("error reading audit log: %v", err)
+	}
+	e.PrevHash = ""
+	if len(last) > 0 {
+		var prev Entry
+		if err := json.Unmarshal(last, &prev); err != nil {
+			return fmt.Errorf("error parsing last audit entry: %v", err)
+		}
+		e.PrevHash = prev.Hash
+	}
+
+	if e.Hash, err = hashEntry(e); err != nil {
+		return err
+	}
+	data, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("error serializing audit entry: %v", err)
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("error writing audit log: %v", err)
+	}
+	return nil
+}
+
+// Close 实现 Sink 接口，文件在每次写入后都会关闭
+func (s *FileSink) Close() error {
+	return nil
+}
+
+// hashEntry 计算不包含Hash字段的记录的SHA-256
+func hashEntry(e *Entry) (string, error) {
+	c := *e
+	c.Hash = ""
+	data, err := json.Marshal(&c)
+	if err != nil {
+		return "", fmt.Errorf("error serializing audit entry: %v", err)
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// lastLine 返回文件中最后一个非空行
+func lastLine(f *os.File) ([]byte, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	const chunk = 4096
+	size := info.Size()
+	var tail []byte
+	for offset := size; offset > 0; {
+		n := int64(chunk)
+		if offset < n {
+			n = offset
+		}
+		offset -= n
+		buf := make([]byte, n)
+		if _, err := f.ReadAt(buf, offset); err != nil && !errors.Is(err, io.EOF) {
+			return nil, err
+		}
+		tail = append(buf, tail...)
+
+		trimmed := bytes.TrimRight(tail, "\n")
+		if i := bytes.LastIndexByte(trimmed, '\n'); i >= 0 {
+			return trimmed[i+1:], nil
+		}
+		if offset == 0 {
+			return trimmed, nil
+		}
+	}
+	return nil, nil
+}
+
+// VerifyError 表示审计日志的哈希链在某一行被破坏
+type VerifyError struct {
+	Line   int
+	Reason string
+}
+
+// Error 实现 error 接口
+func (e *VerifyError) Error() string {
+	return fmt.Sprintf("audit log tampered at line %d: %s", e.Line, e.Reason)
+}
+
+// Verify 校验审计日志的哈希链，返回校验通过的记录数
+// 任何一条记录被修改、删除或插入都会导致校验失败
+func Verify(r io.Reader) (int, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	prevHash := ""
+	count := 0
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+
+		var e Entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return count, &VerifyError{Line: line, Reason: "invalid JSON"}
+		}
+		if e.PrevHash != prevHash {
+			return count, &VerifyError{Line: line, Reason: "previous hash does not match, entries were removed or reordered"}
+		}
+		hash, err := hashEntry(&e)
+		if err != nil {
+			return count, err
+		}
+		if hash != e.Hash {
+			return count, &VerifyError{Line: line, Reason: "hash does not match, the entry was modified"}
+		}
+		prevHash = e.Hash
+		count++
+	}
+	if err := scanner.Err(); err != nil {
+		return count, fmt.Errorf("error reading audit log: %v", err)
+	}
+	return count, nil
+}
@@ -0,0 +1,106 @@
+package audit
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/LubyRuffy/aic/pkg/safety"
+)
+
+func writeEntries(t *testing.T, path string, commands ...string) {
+	t.Helper()
+	s := &FileSink{Path: path}
+	for _, cmd := range commands {
+		e := NewEntry()
+		e.Command = cmd
+		e.Risk = safety.RiskLow
+		if err := s.Write(e); err != nil {
+			t.Fatalf("Write() error = %v", err)
+		}
+	}
+}
+
+func TestFileSinkChain(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sub", FileName)
+	writeEntries(t, path, "ls", "pwd", "date")
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Count(string(data), "\n"); lines != 3 {
+		t.Fatalf("got %d lines, want 3", lines)
+	}
+
+	count, err := Verify(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+	if count != 3 {
+		t.Errorf("Verify() = %d, want 3", count)
+	}
+}
+
+func TestVerifyDetectsTampering(t *testing.T) {
+	path := filepath.Join(t.TempDir(), FileName)
+	writeEntries(t, path, "ls", "pwd", "date")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.SplitAfter(string(data), "\n")
+
+	tests := []struct {
+		name     string
+		log      string
+		wantLine int
+	}{
+		{"modified", strings.Replace(string(data), `"command":"pwd"`, `"command":"rm -rf /"`, 1), 2},
+		{"removed", lines[0] + lines[2], 2},
+		{"reordered", lines[1] + lines[0] + lines[2], 1},
+		{"invalid", lines[0] + "garbage\n", 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Verify(strings.NewReader(tt.log))
+			var verr *VerifyError
+			if !errors.As(err, &verr) {
+				t.Fatalf("Verify() error = %v, want VerifyError", err)
+			}
+			if verr.Line != tt.wantLine {
+				t.Errorf("line = %d, want %d", verr.Line, tt.wantLine)
+			}
+		})
+	}
+}
+
+func TestLastLine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "log")
+	long := strings.Repeat("x", 10000)
+	if err := os.WriteFile(path, []byte("first\n"+long+"\n\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	got, err := lastLine(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != long {
+		t.Errorf("lastLine() returned %d bytes, want %d", len(got), len(long))
+	}
+}
+
+func TestOpenUnsupported(t *testing.T) {
+	if _, err := Open("kafka", ""); err == nil {
+		t.Error("Open() error = nil, want error")
+	}
+}
@@ -0,0 +1,36 @@
+//go:build !windows && !plan9
+
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/syslog"
+)
+
+// SyslogSink 把审计记录写入系统日志（在使用systemd的系统上会进入journald）
+type SyslogSink struct {
+	w *syslog.Writer
+}
+
+func newSyslogSink() (Sink, error) {
+	w, err := syslog.New(syslog.LOG_NOTICE|syslog.LOG_AUTH, "aic")
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to syslog: %v", err)
+	}
+	return &SyslogSink{w: w}, nil
+}
+
+// Write 把记录以JSON格式写入系统日志
+func (s *SyslogSink) Write(e *Entry) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("error serializing audit entry: %v", err)
+	}
+	return s.w.Notice(string(data))
+}
+
+// Close 关闭与系统日志的连接
+func (s *SyslogSink) Close() error {
+	return s.w.Close()
+}
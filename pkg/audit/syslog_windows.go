@@ -0,0 +1,9 @@
+//go:build windows
+
+package audit
+
+import "errors"
+
+func newSyslogSink() (Sink, error) {
+	return nil, errors.New("the syslog audit sink is not supported on windows")
+}
@@ -0,0 +1,237 @@
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/LubyRuffy/aic/pkg/sysinfo"
+)
+
+// FileName 是配置目录下缓存文件的名称
+const FileName = "cache.json"
+
+// 缓存的默认限制
+const (
+	DefaultTTL        = 7 * 24 * time.Hour
+	DefaultMaxEntries = 500
+)
+
+// Entry 是一条缓存的模型响应
+type Entry struct {
+	Model    string    `json:"model"`
+	Prompt   string    `json:"prompt"`
+	Response string    `json:"response"`
+	Created  time.Time `json:"created"`
+	LastUsed time.Time `json:"last_used"`
+	Hits     int       `json:"hits"`
+}
+
+// file 是缓存文件的内容
+type file struct {
+	Entries map[string]*Entry `json:"entries"`
+	Hits    int               `json:"hits"`
+	Misses  int               `json:"misses"`
+}
+
+// Stats 是缓存的统计信息
+type Stats struct {
+	Entries int
+	Expired int
+	Hits    int
+	Misses  int
+	Size    int64
+}
+
+// Cache 是保存在本地文件中的提示词到模型响应的缓存
+type Cache struct {
+	Path string
+	// TTL 是缓存条目的有效期
+	TTL time.Duration
+	// MaxEntries 是缓存条目的最大数量，超出时淘汰最久未使用的条目
+	MaxEntries int
+
+	now func() time.Time
+}
+
+// New 创建使用默认限制的缓存
+func New(path string) *Cache {
+	return &Cache{Path: path, TTL: DefaultTTL, MaxEntries: DefaultMaxEntries, now: time.Now}
+}
+
+// NormalizePrompt 规范化提示词，只忽略多余的空白
+// 大小写和标点可能是命令中的字面值，比如 Makefile 和 makefile、ERROR 和 error，不能忽略
+func NormalizePrompt(prompt string) string {
+	return strings.Join(strings.Fields(prompt), " ")
+}
+
+// Fingerprint 返回与生成的命令相关的环境信息的哈希：操作系统、shell和当前目录的类别、权限，以及远程目标
+func Fingerprint(info *sysinfo.SystemInfo) string {
+	env := info.OS + "\n" + info.Shell + "\n" + CwdClass(info.CurrentDir, info.HomeDir) + "\n" + info.Privileges()
+	if info.Host != "" {
+		env += "\n" + info.Host
+	}
+	sum := sha256.Sum256([]byte(env))
+	return hex.EncodeToString(sum[:])
+}
+
+// CwdClass 返回当前目录的类别，同一类别的目录下生成的命令通常是相同的
+func CwdClass(cwd, home string) string {
+	cwd = filepath.Clean(cwd)
+	switch {
+	case cwd == filepath.Dir(cwd):
+		return "root"
+	case home != "" && cwd == filepath.Clean(home):
+		return "home"
+	case cwd == filepath.Clean(os.TempDir()):
+		return "temp"
+	case home != "" && strings.HasPrefix(cwd, filepath.Clean(home)+string(filepath.Separator)):
+		return "home-subdir"
+	default:
+		return "other"
+	}
+}
+
+// Key 返回提示词、模型和环境指纹对应的缓存键
+func Key(prompt, model, fingerprint string) string {
+	sum := sha256.Sum256([]byte(NormalizePrompt(prompt) + "\x00" + model + "\x00" + fingerprint))
+	return hex.EncodeToString(sum[:])
+}
+
+// Get 返回key对应的未过期的响应，并更新命中统计
+func (c *Cache) Get(key string) (string, bool, error) {
+	f, err := c.load()
+	if err != nil {
+		return "", false, err
+	}
+
+	now := c.now()
+	e, ok := f.Entries[key]
+	if !ok || c.expired(e, now) {
+		f.Misses++
+		return "", false, c.save(f)
+	}
+	e.LastUsed = now
+	e.Hits++
+	f.Hits++
+	return e.Response, true, c.save(f)
+}
+
+// Put 保存key对应的响应，并清理过期和超出数量限制的条目
+func (c *Cache) Put(key, model, prompt, response string) error {
+	f, err := c.load()
+	if err != nil {
+		return err
+	}
+
+	now := c.now()
+	f.Entries[key] = &Entry{Model: model, Prompt: prompt, Response: response, Created: now, LastUsed: now}
+	c.prune(f, now)
+	return c.save(f)
+}
+
+// Clear 删除所有缓存条目和统计信息
+func (c *Cache) Clear() error {
+	if err := os.Remove(c.Path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("error clearing cache: %v", err)
+	}
+	return nil
+}
+
+// Stats 返回缓存的统计信息
+func (c *Cache) Stats() (*Stats, error) {
+	f, err := c.load()
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Stats{Entries: len(f.Entries), Hits: f.Hits, Misses: f.Misses}
+	now := c.now()
+	for _, e := range f.Entries {
+		if c.expired(e, now) {
+			s.Expired++
+		}
+	}
+	if info, err := os.Stat(c.Path); err == nil {
+		s.Size = info.Size()
+	}
+	return s, nil
+}
+
+// expired 判断条目是否已经过期
+func (c *Cache) expired(e *Entry, now time.Time) bool {
+	return c.TTL > 0 && now.Sub(e.Created) > c.TTL
+}
+
+// prune 删除过期条目，并在超出数量限制时淘汰最久未使用的条目
+func (c *Cache) prune(f *file, now time.Time) {
+	keys := make([]string, 0, len(f.Entries))
+	for key, e := range f.Entries {
+		if c.expired(e, now) {
+			delete(f.Entries, key)
+			continue
+		}
+		keys = append(keys, key)
+	}
+	if c.MaxEntries <= 0 || len(keys) <= c.MaxEntries {
+		return
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		return f.Entries[keys[i]].LastUsed.Before(f.Entries[keys[j]].LastUsed)
+	})
+	for _, key := range keys[:len(keys)-c.MaxEntries] {
+		delete(f.Entries, key)
+	}
+}
+
+// load 读取缓存文件，文件不存在或已损坏时返回空缓存
+func (c *Cache) load() (*file, error) {
+	f := &file{Entries: make(map[string]*Entry)}
+	data, err := os.ReadFile(c.Path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return f, nil
+		}
+		return nil, fmt.Errorf("error reading cache: %v", err)
+	}
+	if err := json.Unmarshal(data, f); err != nil || f.Entries == nil {
+		return &file{Entries: make(map[string]*Entry)}, nil
+	}
+	return f, nil
+}
+
+// save 通过临时文件原子地写入缓存文件
+func (c *Cache) save(f *file) error {
+	if err := os.MkdirAll(filepath.Dir(c.Path), 0o700); err != nil {
+		return fmt.Errorf("error creating cache directory: %v", err)
+	}
+	data, err := json.Marshal(f)
+	if err != nil {
+		return fmt.Errorf("error serializing cache: %v", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(c.Path), ".cache-*")
+	if err != nil {
+		return fmt.Errorf("error writing cache: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("error writing cache: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("error writing cache: %v", err)
+	}
+	if err := os.Rename(tmp.Name(), c.Path); err != nil {
+		return fmt.Errorf("error writing cache: %v", err)
+	}
+	return nil
+}
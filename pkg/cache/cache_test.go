@@ -0,0 +1,135 @@
+package cache
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/LubyRuffy/aic/pkg/sysinfo"
+)
+
+// newTestCache creates a cache with a controllable clock
+func newTestCache(t *testing.T) (*Cache, *time.Time) {
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	c := New(filepath.Join(t.TempDir(), FileName))
+	c.now = func() time.Time { return now }
+	return c, &now
+}
+
+func TestNormalizePrompt(t *testing.T) {
+	tests := map[string]string{
+		"Show disk usage":         "Show disk usage",
+		"  show   disk\tusage?  ": "show disk usage?",
+		"find Makefile":           "find Makefile",
+		" 显示磁盘使用情况。\n":            "显示磁盘使用情况。",
+	}
+	for in, want := range tests {
+		if got := NormalizePrompt(in); got != want {
+			t.Errorf("NormalizePrompt(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestKey(t *testing.T) {
+	fp := Fingerprint(&sysinfo.SystemInfo{OS: "linux", Shell: "bash", CurrentDir: "/home/u/src", HomeDir: "/home/u"})
+	if Key("show  disk usage", "m", fp) != Key(" show disk usage\n", "m", fp) {
+		t.Error("Expected normalised prompts to have the same key")
+	}
+	if Key("show disk usage", "m", fp) == Key("show disk usage", "other", fp) {
+		t.Error("Expected different models to have different keys")
+	}
+
+	same := Fingerprint(&sysinfo.SystemInfo{OS: "linux", Shell: "bash", CurrentDir: "/home/u/other", HomeDir: "/home/u"})
+	if fp != same {
+		t.Error("Expected directories of the same class to have the same fingerprint")
+	}
+	for _, info := range []*sysinfo.SystemInfo{
+		{OS: "darwin", Shell: "bash", CurrentDir: "/home/u/src", HomeDir: "/home/u"},
+		{OS: "linux", Shell: "fish", CurrentDir: "/home/u/src", HomeDir: "/home/u"},
+		{OS: "linux", Shell: "bash", CurrentDir: "/", HomeDir: "/home/u"},
+		{OS: "linux", Shell: "bash", CurrentDir: "/home/u/src", HomeDir: "/home/u", IsRoot: true},
+	} {
+		if Fingerprint(info) == fp {
+			t.Errorf("Expected %+v to have a different fingerprint", info)
+		}
+	}
+}
+
+func TestCwdClass(t *testing.T) {
+	tests := []struct {
+		cwd, want string
+	}{
+		{"/", "root"},
+		{"/home/u", "home"},
+		{"/home/u/", "home"},
+		{"/home/u/src", "home-subdir"},
+		{"/home/user2", "other"},
+		{"/var/log", "other"},
+	}
+	for _, tt := range tests {
+		if got := CwdClass(tt.cwd, "/home/u"); got != tt.want {
+			t.Errorf("CwdClass(%q) = %q, want %q", tt.cwd, got, tt.want)
+		}
+	}
+}
+
+func TestGetPut(t *testing.T) {
+	c, now := newTestCache(t)
+
+	if _, ok, err := c.Get("k"); err != nil || ok {
+		t.Fatalf("Get() on empty cache = %v, %v", ok, err)
+	}
+	if err := c.Put("k", "m", "show disk usage", "df -h"); err != nil {
+		t.Fatal(err)
+	}
+	got, ok, err := c.Get("k")
+	if err != nil || !ok || got != "df -h" {
+		t.Fatalf("Get() = %q, %v, %v", got, ok, err)
+	}
+
+	*now = now.Add(c.TTL + time.Second)
+	if _, ok, _ := c.Get("k"); ok {
+		t.Error("Expected expired entry to be missed")
+	}
+
+	stats, err := c.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Entries != 1 || stats.Expired != 1 || stats.Hits != 1 || stats.Misses != 2 || stats.Size == 0 {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+
+	if err := c.Clear(); err != nil {
+		t.Fatal(err)
+	}
+	if stats, _ := c.Stats(); stats.Entries != 0 || stats.Hits != 0 {
+		t.Errorf("Expected empty cache after Clear, got %+v", stats)
+	}
+}
+
+func TestMaxEntries(t *testing.T) {
+	c, now := newTestCache(t)
+	c.MaxEntries = 2
+
+	for _, key := range []string{"a", "b"} {
+		if err := c.Put(key, "m", key, key); err != nil {
+			t.Fatal(err)
+		}
+		*now = now.Add(time.Minute)
+	}
+	// Using a makes b the least recently used entry
+	if _, ok, _ := c.Get("a"); !ok {
+		t.Fatal("Expected a to be cached")
+	}
+	*now = now.Add(time.Minute)
+	if err := c.Put("c", "m", "c", "c"); err != nil {
+		t.Fatal(err)
+	}
+
+	for key, want := range map[string]bool{"a": true, "b": false, "c": true} {
+		if _, ok, _ := c.Get(key); ok != want {
+			t.Errorf("Get(%q) cached = %v, want %v", key, ok, want)
+		}
+	}
+}
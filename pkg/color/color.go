@@ -2,6 +2,8 @@ package color
 
 import (
 	"fmt"
+	"io"
+
 	"github.com/fatih/color"
 )
 
@@ -24,3 +26,43 @@ func Warning(format string, a ...interface{}) {
 func Error(format string, a ...interface{}) {
 	fmt.Print(color.RedString(format, a...))
 }
+
+// Printer prints colored messages to an arbitrary writer
+type Printer struct {
+	w io.Writer
+	// NoColor disables colors, e.g. when w is not a terminal
+	NoColor bool
+}
+
+// NewPrinter creates a printer writing to w
+func NewPrinter(w io.Writer) *Printer {
+	return &Printer{w: w}
+}
+
+// Success prints success message in green
+func (p *Printer) Success(format string, a ...interface{}) {
+	p.print(color.FgGreen, format, a...)
+}
+
+// Info prints info message in blue
+func (p *Printer) Info(format string, a ...interface{}) {
+	p.print(color.FgBlue, format, a...)
+}
+
+// Warning prints warning message in yellow
+func (p *Printer) Warning(format string, a ...interface{}) {
+	p.print(color.FgYellow, format, a...)
+}
+
+// Error prints error message in red
+func (p *Printer) Error(format string, a ...interface{}) {
+	p.print(color.FgRed, format, a...)
+}
+
+func (p *Printer) print(attr color.Attribute, format string, a ...interface{}) {
+	c := color.New(attr)
+	if p.NoColor {
+		c.DisableColor()
+	}
+	_, _ = c.Fprintf(p.w, format, a...)
+}
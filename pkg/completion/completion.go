@@ -0,0 +1,184 @@
+package completion
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+// 动态补全的类型，对应 aic __complete <kind>
+const (
+	KindModels   = "models"
+	KindProfiles = "profiles"
+)
+
+// Flag 描述一个需要补全的命令行参数
+type Flag struct {
+	Name     string
+	Usage    string
+	HasValue bool
+	// Complete 是参数值的动态补全类型，为空时不补全参数值
+	Complete string
+}
+
+// Spec 描述aic命令行的结构，用于生成补全脚本
+type Spec struct {
+	Flags []Flag
+	// Subcommands 是子命令列表
+	Subcommands []string
+	// Shells 是 shell-init 和 completion 子命令接受的shell名称
+	Shells []string
+}
+
+var templates = map[string]*template.Template{
+	"bash":       template.Must(template.New("bash").Funcs(funcs).Parse(bashTemplate)),
+	"zsh":        template.Must(template.New("zsh").Funcs(funcs).Parse(zshTemplate)),
+	"fish":       template.Must(template.New("fish").Funcs(funcs).Parse(fishTemplate)),
+	"powershell": template.Must(template.New("powershell").Funcs(funcs).Parse(powershellTemplate)),
+}
+
+var funcs = template.FuncMap{
+	"join": strings.Join,
+	"zshEscape": func(s string) string {
+		return strings.NewReplacer("'", `'\''`, "[", `\[`, "]", `\]`, ":", `\:`).Replace(s)
+	},
+	"singleQuote": func(s string) string {
+		return strings.ReplaceAll(s, "'", "''")
+	},
+	"fishQuote": func(s string) string {
+		return strings.NewReplacer(`\`, `\\`, "'", `\'`).Replace(s)
+	},
+}
+
+// Shells 返回支持生成补全脚本的shell名称列表
+func Shells() []string {
+	names := []string{"pwsh"}
+	for name := range templates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Script 返回指定shell的补全脚本
+func Script(shell string, spec Spec) (string, error) {
+	name := strings.ToLower(shell)
+	if name == "pwsh" {
+		name = "powershell"
+	}
+	tmpl, ok := templates[name]
+	if !ok {
+		return "", fmt.Errorf("unsupported shell %q, supported shells: %s", shell, strings.Join(Shells(), ", "))
+	}
+
+	var b strings.Builder
+	if err := tmpl.Execute(&b, spec); err != nil {
+		return "", fmt.Errorf("error generating completion for %s: %v", shell, err)
+	}
+	return b.String(), nil
+}
+
+const bashTemplate = `# aic completion for bash
+_aic() {
+  local cur="${COMP_WORDS[COMP_CWORD]}"
+  local prev="${COMP_WORDS[COMP_CWORD-1]}"
+  COMPREPLY=()
+
+  case "$prev" in
+{{- range .Flags}}{{if .HasValue}}
+    -{{.Name}}|--{{.Name}})
+{{- if .Complete}}
+      local IFS=$'\n'
+      COMPREPLY=($(compgen -W "$(aic __complete {{.Complete}} 2>/dev/null)" -- "$cur"))
+      declare -F __ltrim_colon_completions >/dev/null && __ltrim_colon_completions "$cur"
+{{- end}}
+      return ;;
+{{- end}}{{end}}
+    shell-init|completion)
+      COMPREPLY=($(compgen -W "{{join .Shells " "}}" -- "$cur"))
+      return ;;
+  esac
+
+  if [[ "$cur" == -* ]]; then
+    COMPREPLY=($(compgen -W "{{range .Flags}}-{{.Name}} {{end}}" -- "$cur"))
+    return
+  fi
+
+  if [[ $COMP_CWORD -eq 1 ]]; then
+    COMPREPLY=($(compgen -W "{{join .Subcommands " "}}" -- "$cur"))
+  fi
+}
+complete -o default -F _aic aic
+`
+
+const zshTemplate = `#compdef aic
+# aic completion for zsh
+
+_aic_models() {
+  local -a models
+  models=(${(f)"$(aic __complete models 2>/dev/null)"})
+  compadd -a models
+}
+
+_aic_profiles() {
+  local -a profiles
+  profiles=(${(f)"$(aic __complete profiles 2>/dev/null)"})
+  compadd -a profiles
+}
+
+_aic_args() {
+  if (( CURRENT == 1 )); then
+    compadd {{join .Subcommands " "}}
+    return
+  fi
+  case "$words[1]" in
+    shell-init|completion) compadd {{join .Shells " "}} ;;
+  esac
+}
+
+_aic() {
+  _arguments \
+{{- range .Flags}}
+    '-{{.Name}}[{{zshEscape .Usage}}]{{if .HasValue}}:{{.Name}}:{{if eq .Complete "models"}}_aic_models{{else if eq .Complete "profiles"}}_aic_profiles{{else}} {{end}}{{end}}' \
+{{- end}}
+    '*:: :_aic_args'
+}
+
+compdef _aic aic
+`
+
+const fishTemplate = `# aic completion for fish
+complete -c aic -f
+{{- range .Flags}}
+complete -c aic -o {{.Name}} -d '{{fishQuote .Usage}}'{{if .HasValue}} -x{{if .Complete}} -a '(aic __complete {{.Complete}} 2>/dev/null)'{{end}}{{end}}
+{{- end}}
+complete -c aic -n '__fish_use_subcommand' -a '{{join .Subcommands " "}}'
+complete -c aic -n '__fish_seen_subcommand_from shell-init completion' -a '{{join .Shells " "}}'
+`
+
+const powershellTemplate = `# aic completion for PowerShell
+Register-ArgumentCompleter -Native -CommandName aic -ScriptBlock {
+    param($wordToComplete, $commandAst, $cursorPosition)
+    $elements = @($commandAst.CommandElements | ForEach-Object { $_.ToString() })
+    $prev = if ($wordToComplete) { $elements[-2] } else { $elements[-1] }
+
+    $candidates = switch -Regex ($prev) {
+{{- range .Flags}}{{if .HasValue}}
+        '^--?{{.Name}}$' { {{if .Complete}}@(aic __complete {{.Complete}} 2>$null){{else}}@(){{end}}; break }
+{{- end}}{{end}}
+        '^(shell-init|completion)$' { @({{range $i, $s := .Shells}}{{if $i}}, {{end}}'{{$s}}'{{end}}); break }
+        default {
+            if ($wordToComplete -like '-*') {
+                @({{range $i, $f := .Flags}}{{if $i}}, {{end}}'-{{$f.Name}}'{{end}})
+            } elseif ($elements.Count -le 2) {
+                @({{range $i, $s := .Subcommands}}{{if $i}}, {{end}}'{{$s}}'{{end}})
+            }
+        }
+    }
+
+    $candidates | Where-Object { $_ -like "$wordToComplete*" } | ForEach-Object {
+        [System.Management.Automation.CompletionResult]::new($_, $_, 'ParameterValue', $_)
+    }
+}
+`
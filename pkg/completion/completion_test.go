@@ -0,0 +1,63 @@
+package completion
+
+import (
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+var testSpec = Spec{
+	Flags: []Flag{
+		{Name: "model", Usage: "Ollama model name to use", HasValue: true, Complete: KindModels},
+		{Name: "profile", Usage: "Profile from the config file to use", HasValue: true, Complete: KindProfiles},
+		{Name: "verbose", Usage: "Enable verbose mode [debug]"},
+	},
+	Subcommands: []string{"shell-init", "completion"},
+	Shells:      []string{"bash", "zsh"},
+}
+
+func TestScript(t *testing.T) {
+	for _, shell := range Shells() {
+		t.Run(shell, func(t *testing.T) {
+			script, err := Script(shell, testSpec)
+			if err != nil {
+				t.Fatalf("Script(%s) error = %v", shell, err)
+			}
+			for _, want := range []string{"model", "verbose", "__complete models", "__complete profiles", "shell-init"} {
+				if !strings.Contains(script, want) {
+					t.Errorf("Expected %s script to contain %q", shell, want)
+				}
+			}
+		})
+	}
+
+	if _, err := Script("tcsh", testSpec); err == nil {
+		t.Error("Expected error for unsupported shell, got nil")
+	}
+}
+
+func TestBashCompletion(t *testing.T) {
+	bash, err := exec.LookPath("bash")
+	if err != nil {
+		t.Skip("bash not available")
+	}
+
+	script, err := Script("bash", testSpec)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 模拟补全 "aic -ver"
+	cmd := exec.Command(bash, "-c", script+`
+COMP_WORDS=(aic -ver)
+COMP_CWORD=1
+_aic
+echo "${COMPREPLY[@]}"`)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("bash error = %v, output: %s", err, out)
+	}
+	if strings.TrimSpace(string(out)) != "-verbose" {
+		t.Errorf("Expected -verbose, got %q", out)
+	}
+}
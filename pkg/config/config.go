@@ -0,0 +1,136 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// FileName 是配置目录下配置文件的名称
+const FileName = "config.json"
+
+// Config 是aic的用户配置文件
+type Config struct {
+	Model     string             `json:"model,omitempty"`
+	OllamaURL string             `json:"ollama_url,omitempty"`
+	Profiles  map[string]Profile `json:"profiles,omitempty"`
+	Audit     Audit              `json:"audit,omitempty"`
+	Cache     Cache              `json:"cache,omitempty"`
+	Sandbox   Sandbox            `json:"sandbox,omitempty"`
+	Snapshot  Snapshot           `json:"snapshot,omitempty"`
+}
+
+// Audit 是审计日志的配置，默认写入配置目录下的 audit.jsonl
+type Audit struct {
+	// Disabled 为true时不记录审计日志
+	Disabled bool `json:"disabled,omitempty"`
+	// Path 是文件审计日志的路径
+	Path string `json:"path,omitempty"`
+	// Sink 是审计日志的输出方式：file（默认）或 syslog
+	Sink string `json:"sink,omitempty"`
+}
+
+// Cache 是提示词缓存的配置，未设置的字段使用 cache 包中的默认值
+type Cache struct {
+	// Disabled 为true时不使用缓存
+	Disabled bool `json:"disabled,omitempty"`
+	// TTL 是缓存条目的有效期，如 "24h"
+	TTL string `json:"ttl,omitempty"`
+	// MaxEntries 是缓存条目的最大数量
+	MaxEntries int `json:"max_entries,omitempty"`
+}
+
+// Sandbox 是 --sandbox 的资源限制，未设置的字段使用 sandbox 包中的默认值
+type Sandbox struct {
+	// CPUTime 是命令可以使用的CPU时间，如 "30s"
+	CPUTime string `json:"cpu_time,omitempty"`
+	// MemoryMB 是命令可以使用的虚拟内存，单位为MB
+	MemoryMB int64 `json:"memory_mb,omitempty"`
+}
+
+// Snapshot 是执行前保存被修改文件的快照配置，未设置的字段使用 snapshot 包中的默认值
+type Snapshot struct {
+	// Enabled 为true时总是保存快照，等同于 -snapshot
+	Enabled bool `json:"enabled,omitempty"`
+	// MaxFileMB 是单个文件的最大大小，单位为MB
+	MaxFileMB int64 `json:"max_file_mb,omitempty"`
+	// MaxTotalMB 是一个快照的最大总大小，单位为MB
+	MaxTotalMB int64 `json:"max_total_mb,omitempty"`
+	// Keep 是保留的快照数量
+	Keep int `json:"keep,omitempty"`
+}
+
+// Profile 是一组可以通过 -profile 参数切换的模型和服务地址配置
+type Profile struct {
+	Model     string `json:"model,omitempty"`
+	OllamaURL string `json:"ollama_url,omitempty"`
+}
+
+// Dir 返回aic保存配置和状态文件的目录
+func Dir() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("error getting user config directory: %v", err)
+	}
+	return filepath.Join(dir, "aic"), nil
+}
+
+// DefaultPath 返回配置文件的默认路径
+func DefaultPath() (string, error) {
+	dir, err := Dir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, FileName), nil
+}
+
+// Load 从path读取配置，文件不存在时返回空配置
+func Load(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return &Config{}, nil
+		}
+		return nil, fmt.Errorf("error reading config: %v", err)
+	}
+
+	var c Config
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("error parsing config %s: %v", path, err)
+	}
+	return &c, nil
+}
+
+// ProfileNames 返回按名称排序的profile列表
+func (c *Config) ProfileNames() []string {
+	names := make([]string, 0, len(c.Profiles))
+	for name := range c.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Profile 返回名称为name的profile，name为空时返回配置文件顶层的默认值
+func (c *Config) Profile(name string) (Profile, error) {
+	defaults := Profile{Model: c.Model, OllamaURL: c.OllamaURL}
+	if name == "" {
+		return defaults, nil
+	}
+
+	p, ok := c.Profiles[name]
+	if !ok {
+		return Profile{}, fmt.Errorf("profile %q not found in config", name)
+	}
+	// profile中未设置的字段继承顶层的默认值
+	if p.Model == "" {
+		p.Model = defaults.Model
+	}
+	if p.OllamaURL == "" {
+		p.OllamaURL = defaults.OllamaURL
+	}
+	return p, nil
+}
@@ -0,0 +1,63 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+
+	// 配置文件不存在时返回空配置
+	c, err := Load(filepath.Join(dir, "missing.json"))
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if len(c.Profiles) != 0 {
+		t.Errorf("Expected empty config, got %+v", c)
+	}
+
+	path := filepath.Join(dir, "config.json")
+	data := `{
+  "model": "qwen2.5-coder",
+  "profiles": {
+    "remote": {"ollama_url": "http://gpu-box:11434"},
+    "fast": {"model": "qwen2.5-coder:1.5b"}
+  }
+}`
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err = Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if got := c.ProfileNames(); !reflect.DeepEqual(got, []string{"fast", "remote"}) {
+		t.Errorf("ProfileNames() = %v", got)
+	}
+
+	p, err := c.Profile("remote")
+	if err != nil {
+		t.Fatalf("Profile() error = %v", err)
+	}
+	if p.Model != "qwen2.5-coder" || p.OllamaURL != "http://gpu-box:11434" {
+		t.Errorf("Expected profile to inherit defaults, got %+v", p)
+	}
+
+	if _, err := c.Profile("missing"); err == nil {
+		t.Error("Expected error for missing profile, got nil")
+	}
+}
+
+func TestLoadInvalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte("{invalid"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(path); err == nil {
+		t.Error("Expected parse error, got nil")
+	}
+}
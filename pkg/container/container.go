@@ -0,0 +1,111 @@
+package container
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/LubyRuffy/aic/pkg/shell"
+	"github.com/LubyRuffy/aic/pkg/sysinfo"
+)
+
+// Runtimes 是支持的容器命令行工具，没有指定时按顺序查找
+var Runtimes = []string{"docker", "podman"}
+
+// Container 是通过 docker exec 或 podman exec 执行命令的容器
+type Container struct {
+	// Runtime 是容器命令行工具的名称
+	Runtime string
+	// Name 是容器的名称或ID
+	Name string
+
+	path string
+	info *sysinfo.SystemInfo
+}
+
+// New 解析 [runtime:]name 格式的目标，没有指定 runtime 时使用 PATH 中第一个可用的工具
+func New(target string) (*Container, error) {
+	runtime, name := "", target
+	if i := strings.Index(target, ":"); i >= 0 {
+		runtime, name = target[:i], target[i+1:]
+	}
+	if name == "" {
+		return nil, fmt.Errorf("invalid container %q: missing container name", target)
+	}
+
+	candidates := Runtimes
+	if runtime != "" {
+		if !contains(Runtimes, runtime) {
+			return nil, fmt.Errorf("unsupported container runtime %q, supported runtimes: %s", runtime, strings.Join(Runtimes, ", "))
+		}
+		candidates = []string{runtime}
+	}
+	for _, r := range candidates {
+		if path, err := exec.LookPath(r); err == nil {
+			return &Container{Runtime: r, Name: name, path: path}, nil
+		}
+	}
+	return nil, fmt.Errorf("%s not found in PATH", strings.Join(candidates, " or "))
+}
+
+// Target 返回告诉模型和记录在审计日志中的目标名称
+func (c *Container) Target() string {
+	return c.Runtime + " container " + c.Name
+}
+
+// Wrapper 返回在容器中运行shell的命令前缀，用于 executor.ShellExecutor 的 Wrapper
+func (c *Container) Wrapper() []string {
+	return []string{c.path, "exec", "-i", c.Name}
+}
+
+// SystemInfo 在容器中执行 sysinfo.ProbeScript 收集系统信息，结果会被缓存
+func (c *Container) SystemInfo() (*sysinfo.SystemInfo, error) {
+	if c.info != nil {
+		return c.info, nil
+	}
+
+	// #nosec G204 -- the runtime is looked up from a fixed list
+	cmd := exec.Command(c.path, append(c.Wrapper()[1:], "sh", "-s")...)
+	cmd.Stdin = strings.NewReader(sysinfo.ProbeScript)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("error collecting system information from %s: %s", c.Target(), msg)
+		}
+		return nil, fmt.Errorf("error collecting system information from %s: %v", c.Target(), err)
+	}
+	info := sysinfo.ParseProbe(string(out))
+	if info.OS == "" {
+		return nil, fmt.Errorf("error collecting system information from %s: unsupported system", c.Target())
+	}
+	info.Host = c.Target()
+	c.info = info
+	return info, nil
+}
+
+// Shell 返回在容器中执行命令使用的shell，即容器的默认shell，无法识别时使用sh
+func (c *Container) Shell() (shell.Shell, error) {
+	info, err := c.SystemInfo()
+	if err != nil {
+		return shell.Shell{}, err
+	}
+	s, ok := shell.Lookup(info.Shell)
+	if !ok {
+		s, _ = shell.Lookup("sh")
+	}
+	// 使用容器内PATH中的shell，而不是本机的路径
+	s.Path = ""
+	return s, nil
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,107 @@
+package container
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/LubyRuffy/aic/pkg/executor"
+)
+
+// fakeRuntime is a docker/podman replacement running `exec -i web ...` locally and logging its arguments
+const fakeRuntime = `#!/bin/sh
+echo "$(basename "$0") $*" >> "$FAKE_RUNTIME_LOG"
+[ "$1" = exec ] || exit 2
+shift
+[ "$1" = -i ] && shift
+if [ "$1" != web ]; then
+	echo "Error response from daemon: No such container: $1" >&2
+	exit 1
+fi
+shift
+exec "$@"
+`
+
+// installFakeRuntimes puts fake runtimes first in PATH and returns the path of their log
+func installFakeRuntimes(t *testing.T, names ...string) string {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake runtime is a shell script")
+	}
+	dir := t.TempDir()
+	for _, name := range names {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(fakeRuntime), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	log := filepath.Join(dir, "log")
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	t.Setenv("FAKE_RUNTIME_LOG", log)
+	return log
+}
+
+func TestNew(t *testing.T) {
+	installFakeRuntimes(t, "docker", "podman")
+
+	c, err := New("web")
+	if err != nil || c.Runtime != "docker" || c.Name != "web" || c.Target() != "docker container web" {
+		t.Errorf("Unexpected container %+v, %v", c, err)
+	}
+	if c, err := New("podman:web"); err != nil || c.Runtime != "podman" || !strings.HasSuffix(c.Wrapper()[0], "podman") {
+		t.Errorf("Unexpected container %+v, %v", c, err)
+	}
+	for _, target := range []string{"", "docker:", "lxc:web"} {
+		if _, err := New(target); err == nil {
+			t.Errorf("New(%q) expected an error", target)
+		}
+	}
+}
+
+func TestSystemInfo(t *testing.T) {
+	log := installFakeRuntimes(t, "docker")
+
+	c, err := New("web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := c.SystemInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.OS != runtime.GOOS || info.Host != "docker container web" || info.CurrentDir == "" {
+		t.Errorf("Unexpected system info: %+v", info)
+	}
+	if data, _ := os.ReadFile(log); string(data) != "docker exec -i web sh -s\n" {
+		t.Errorf("Unexpected runtime invocation: %q", data)
+	}
+
+	// Errors of the runtime are reported
+	c, _ = New("missing")
+	if _, err := c.SystemInfo(); err == nil || !strings.Contains(err.Error(), "No such container: missing") {
+		t.Errorf("Expected the runtime error, got %v", err)
+	}
+}
+
+func TestExecute(t *testing.T) {
+	log := installFakeRuntimes(t, "docker")
+	c, err := New("web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sh, err := c.Shell()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exec := &executor.ShellExecutor{Shell: &sh, Wrapper: c.Wrapper(), Stderr: &bytes.Buffer{}, CaptureLimit: 64}
+	result, err := exec.Execute("echo inside; exit 3")
+	if result == nil || result.ExitCode != 3 || result.Stdout != "inside\n" {
+		t.Errorf("Unexpected result %+v, %v", result, err)
+	}
+	if data, _ := os.ReadFile(log); !strings.HasSuffix(string(data), "docker exec -i web "+sh.Executable+" -c echo inside; exit 3\n") {
+		t.Errorf("Unexpected runtime invocation: %q", data)
+	}
+}
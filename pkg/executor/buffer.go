@@ -0,0 +1,114 @@
+package executor
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// HeadTailBuffer 是有容量上限的 io.Writer，只保留写入内容的开头和结尾部分
+// 适合在不占用大量内存的情况下记录大输出命令（比如cat一个很大的日志）的输出
+type HeadTailBuffer struct {
+	mu   sync.Mutex
+	head []byte
+	// tail 是保存结尾内容的环形缓冲区
+	tail     []byte
+	tailPos  int
+	tailFull bool
+	headSize int
+	total    int64
+}
+
+// NewHeadTailBuffer 创建最多保留limit个字节的缓冲区，开头和结尾各占一半
+func NewHeadTailBuffer(limit int) *HeadTailBuffer {
+	if limit < 0 {
+		limit = 0
+	}
+	headSize := limit / 2
+	return &HeadTailBuffer{
+		headSize: headSize,
+		head:     make([]byte, 0, headSize),
+		tail:     make([]byte, limit-headSize),
+	}
+}
+
+// Write 实现 io.Writer，总是报告全部写入成功
+func (b *HeadTailBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	n := len(p)
+	b.total += int64(n)
+
+	if remain := b.headSize - len(b.head); remain > 0 {
+		if remain > len(p) {
+			remain = len(p)
+		}
+		b.head = append(b.head, p[:remain]...)
+		p = p[remain:]
+	}
+
+	size := len(b.tail)
+	if size == 0 || len(p) == 0 {
+		return n, nil
+	}
+	if len(p) >= size {
+		copy(b.tail, p[len(p)-size:])
+		b.tailPos = 0
+		b.tailFull = true
+		return n, nil
+	}
+	copied := copy(b.tail[b.tailPos:], p)
+	if copied < len(p) {
+		copy(b.tail, p[copied:])
+		b.tailFull = true
+	}
+	b.tailPos = (b.tailPos + len(p)) % size
+	if b.tailPos == 0 {
+		b.tailFull = true
+	}
+	return n, nil
+}
+
+// Len 返回写入的总字节数，包括被丢弃的部分
+func (b *HeadTailBuffer) Len() int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.total
+}
+
+// Truncated 表示是否有内容因为超出容量被丢弃
+func (b *HeadTailBuffer) Truncated() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.total > int64(len(b.head)+b.tailLen())
+}
+
+// String 返回保留的内容，被丢弃的部分用一行标记代替
+func (b *HeadTailBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var tail []byte
+	if b.tailFull {
+		tail = append(append(tail, b.tail[b.tailPos:]...), b.tail[:b.tailPos]...)
+	} else {
+		tail = b.tail[:b.tailPos]
+	}
+
+	var s strings.Builder
+	s.Write(b.head)
+	if omitted := b.total - int64(len(b.head)+len(tail)); omitted > 0 {
+		fmt.Fprintf(&s, "\n... (%d bytes omitted) ...\n", omitted)
+	}
+	s.Write(tail)
+	// 截断处可能把多字节字符切开
+	return strings.ToValidUTF8(s.String(), "")
+}
+
+func (b *HeadTailBuffer) tailLen() int {
+	if b.tailFull {
+		return len(b.tail)
+	}
+	return b.tailPos
+}
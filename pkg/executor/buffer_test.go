@@ -0,0 +1,65 @@
+package executor
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestHeadTailBuffer(t *testing.T) {
+	b := NewHeadTailBuffer(10)
+	b.Write([]byte("hello"))
+	if b.String() != "hello" || b.Truncated() {
+		t.Errorf("Expected hello without truncation, got %q", b.String())
+	}
+
+	b.Write([]byte(" abcd"))
+	if b.String() != "hello abcd" || b.Truncated() {
+		t.Errorf("Expected hello abcd without truncation, got %q", b.String())
+	}
+
+	b.Write([]byte("!"))
+	if b.String() != "hello\n... (1 bytes omitted) ...\nabcd!" || !b.Truncated() {
+		t.Errorf("Expected the middle to be omitted, got %q", b.String())
+	}
+}
+
+func TestHeadTailBufferTruncation(t *testing.T) {
+	b := NewHeadTailBuffer(8)
+	for i := 0; i < 100; i++ {
+		b.Write([]byte("0123456789"))
+	}
+
+	if !b.Truncated() {
+		t.Fatal("Expected buffer to be truncated")
+	}
+	if b.Len() != 1000 {
+		t.Errorf("Expected total length 1000, got %d", b.Len())
+	}
+	got := b.String()
+	if !strings.HasPrefix(got, "0123") || !strings.HasSuffix(got, "6789") {
+		t.Errorf("Expected head and tail to be kept, got %q", got)
+	}
+	if !strings.Contains(got, "(992 bytes omitted)") {
+		t.Errorf("Expected omission marker, got %q", got)
+	}
+}
+
+func TestHeadTailBufferWrap(t *testing.T) {
+	b := NewHeadTailBuffer(8)
+	b.Write([]byte("abcd"))
+	// 逐字节写入，让尾部的环形缓冲区多次回绕
+	for _, c := range "efghijklmnop" {
+		b.Write([]byte(string(c)))
+	}
+	if got := b.String(); !strings.HasPrefix(got, "abcd") || !strings.HasSuffix(got, "mnop") {
+		t.Errorf("Unexpected content %q", got)
+	}
+
+	b = NewHeadTailBuffer(0)
+	if n, err := b.Write([]byte("data")); n != 4 || err != nil {
+		t.Errorf("Write() = %d, %v", n, err)
+	}
+	if b.String() != "\n... (4 bytes omitted) ...\n" {
+		t.Errorf("Unexpected content %q", b.String())
+	}
+}
@@ -5,55 +5,230 @@ import (
 	"io"
 	"os"
 	"os/exec"
-	"runtime"
+	"os/signal"
+	"time"
+
+	"github.com/LubyRuffy/aic/pkg/shell"
+	"golang.org/x/term"
 )
 
+// ExitCodeTimeout 是命令执行超时时使用的退出码，与timeout(1)一致
+const ExitCodeTimeout = 124
+
+// waitDelay 是命令结束后等待输出管道关闭的最长时间
+const waitDelay = 2 * time.Second
+
 // CommandExecutor 是命令执行器的接口
 type CommandExecutor interface {
-	Execute(command string) error
+	Execute(command string) (*ExecResult, error)
+}
+
+// ExecResult 是命令执行的结果
+type ExecResult struct {
+	// ExitCode 是命令的退出码，被信号终止时与shell一致为128+信号值
+	ExitCode int
+	// Duration 是命令的执行时长
+	Duration time.Duration
+	// Signal 是终止命令的信号名称，正常退出时为空
+	Signal string
+	// TimedOut 表示命令因为超时被终止
+	TimedOut bool
+	// Stdout 和 Stderr 是捕获的输出，只在设置了 CaptureLimit 时有值
+	// 超出上限时只保留开头和结尾部分，中间用一行标记代替
+	Stdout string
+	Stderr string
+}
+
+// ExitError 表示命令执行后以非零状态退出
+type ExitError struct {
+	Result *ExecResult
+	Err    error
+}
+
+// Error 实现 error 接口
+func (e *ExitError) Error() string {
+	switch {
+	case e.Result.TimedOut:
+		return fmt.Sprintf("command timed out after %s", e.Result.Duration.Round(time.Millisecond))
+	case e.Result.Signal != "":
+		return fmt.Sprintf("command terminated by signal %s", e.Result.Signal)
+	default:
+		return fmt.Sprintf("command exited with code %d", e.Result.ExitCode)
+	}
+}
+
+// Unwrap 返回底层的错误
+func (e *ExitError) Unwrap() error {
+	return e.Err
 }
 
 // ShellExecutor 是基于shell的命令执行器
 type ShellExecutor struct {
+	Stdin  io.Reader
 	Stdout io.Writer
 	Stderr io.Writer
+	// Timeout 是命令的最长执行时间，超时后整个进程组会被终止，为0时不限制
+	Timeout time.Duration
+	// ForwardSignals 表示是否把收到的SIGINT/SIGTERM转发给命令的进程组
+	ForwardSignals bool
+	// CaptureLimit 是每个输出流最多捕获的字节数，输出仍然会实时写到 Stdout 和 Stderr，为0时不捕获
+	CaptureLimit int
+	// Shell 是执行命令使用的shell，为空时自动检测
+	Shell *shell.Shell
+	// Wrapper 是运行shell的包装程序及其参数，例如 docker exec -i <容器>，为空时直接运行shell
+	Wrapper []string
+	// PTY 表示在 Stdin 和 Stdout 都是终端时，是否在伪终端中运行命令（仅Unix）
+	// 这样top、less以及带颜色输出的命令能和直接在终端中运行时表现一致，此时stderr会合并到stdout
+	PTY bool
 }
 
 // NewShellExecutor 创建一个新的shell命令执行器
 func NewShellExecutor() *ShellExecutor {
 	return &ShellExecutor{
-		Stdout: os.Stdout,
-		Stderr: os.Stderr,
+		Stdin:          os.Stdin,
+		Stdout:         os.Stdout,
+		Stderr:         os.Stderr,
+		ForwardSignals: true,
 	}
 }
 
 // Execute 执行shell命令
-func (e *ShellExecutor) Execute(command string) error {
-	var cmd *exec.Cmd
-
-	switch runtime.GOOS {
-	case "windows":
-		// 在Windows上检查是否是PowerShell
-		if os.Getenv("PSModulePath") != "" {
-			cmd = exec.Command("powershell", "-Command", command)
-		} else {
-			cmd = exec.Command("cmd", "/C", command)
-		}
-	default:
-		// 对于Unix系统（Linux和macOS），使用默认的shell
-		shell := os.Getenv("SHELL")
-		if shell == "" {
-			shell = "/bin/sh"
-		}
-		cmd = exec.Command(shell, "-c", command)
+// 命令以非零状态退出时返回 *ExitError，同时返回执行结果
+func (e *ShellExecutor) Execute(command string) (*ExecResult, error) {
+	sh := shell.Detect()
+	if e.Shell != nil {
+		sh = *e.Shell
 	}
+	name, args := sh.Command(command)
+	if len(e.Wrapper) > 0 {
+		args = append(append(append([]string{}, e.Wrapper[1:]...), name), args...)
+		name = e.Wrapper[0]
+	}
+	// #nosec G204 -- executing the generated command is the purpose of aic
+	cmd := exec.Command(name, args...)
 
 	cmd.Stdout = e.Stdout
 	cmd.Stderr = e.Stderr
+	var stdout, stderr *HeadTailBuffer
+	if e.CaptureLimit > 0 {
+		stdout = NewHeadTailBuffer(e.CaptureLimit)
+		stderr = NewHeadTailBuffer(e.CaptureLimit)
+		cmd.Stdout = teeWriter(e.Stdout, stdout)
+		cmd.Stderr = teeWriter(e.Stderr, stderr)
+	}
+	cmd.WaitDelay = waitDelay
+
+	var result *ExecResult
+	var err error
+	if tty, ok := e.terminal(); ok {
+		result, err = runPTY(cmd, tty, cmd.Stdout, e.Timeout, e.ForwardSignals)
+	} else {
+		cmd.Stdin = e.Stdin
+		// 共享终端输入时命令需要留在前台进程组中，否则读取终端时会被SIGTTIN暂停
+		if !isTerminal(e.Stdin) {
+			setProcessGroup(cmd)
+		}
+		result, err = run(cmd, e.Timeout, e.ForwardSignals)
+	}
+	if result != nil && e.CaptureLimit > 0 {
+		result.Stdout = stdout.String()
+		result.Stderr = stderr.String()
+	}
+	return result, err
+}
 
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("error executing command: %v", err)
+// terminal 返回需要使用伪终端时的输入终端
+func (e *ShellExecutor) terminal() (*os.File, bool) {
+	if !e.PTY || !ptySupported || !isTerminal(e.Stdin) || !isTerminal(e.Stdout) {
+		return nil, false
 	}
+	return e.Stdin.(*os.File), true
+}
+
+// isTerminal 判断v是否是终端
+func isTerminal(v interface{}) bool {
+	f, ok := v.(*os.File)
+	return ok && term.IsTerminal(int(f.Fd()))
+}
+
+// teeWriter 把输出同时写到w和capture，w为空时只写到capture
+func teeWriter(w io.Writer, capture io.Writer) io.Writer {
+	if w == nil {
+		return capture
+	}
+	return io.MultiWriter(w, capture)
+}
+
+// run 启动cmd并等待其结束，期间转发信号并处理超时
+func run(cmd *exec.Cmd, timeout time.Duration, forwardSignals bool) (*ExecResult, error) {
+	start := time.Now()
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("error executing command: %v", err)
+	}
+	return wait(cmd, start, timeout, forwardSignals)
+}
+
+// wait 等待已经启动的cmd结束，期间转发信号并处理超时
+func wait(cmd *exec.Cmd, start time.Time, timeout time.Duration, forwardSignals bool) (*ExecResult, error) {
+	var sigCh chan os.Signal
+	if forwardSignals {
+		sigCh = make(chan os.Signal, 1)
+		signal.Notify(sigCh, forwardedSignals...)
+		defer signal.Stop(sigCh)
+	}
+
+	var timeoutCh <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		timeoutCh = timer.C
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+
+	timedOut := false
+	for {
+		select {
+		case sig := <-sigCh:
+			signalProcessGroup(cmd, sig)
+		case <-timeoutCh:
+			timedOut = true
+			killProcessGroup(cmd)
+			timeoutCh = nil
+		case err := <-done:
+			return newResult(cmd, time.Since(start), timedOut, err)
+		}
+	}
+}
+
+// newResult 根据进程的退出状态生成执行结果
+func newResult(cmd *exec.Cmd, duration time.Duration, timedOut bool, waitErr error) (*ExecResult, error) {
+	result := &ExecResult{Duration: duration, TimedOut: timedOut}
+
+	state := cmd.ProcessState
+	if state == nil {
+		return result, fmt.Errorf("error executing command: %v", waitErr)
+	}
+	result.ExitCode = state.ExitCode()
+	if name, num := exitSignal(state); name != "" {
+		result.Signal = name
+		result.ExitCode = 128 + num
+	}
+
+	// 命令成功退出时，即使输出管道没有在 WaitDelay 内关闭也视为成功
+	if result.ExitCode == 0 && !timedOut {
+		return result, nil
+	}
+	return result, &ExitError{Result: result, Err: waitErr}
+}
+
+// NoopExecutor 是不执行任何命令的执行器，用于 --dry-run
+type NoopExecutor struct{}
 
-	return nil
+// Execute 不执行命令，直接返回成功
+func (NoopExecutor) Execute(_ string) (*ExecResult, error) {
+	return &ExecResult{}, nil
 }
@@ -2,10 +2,14 @@ package executor
 
 import (
 	"bytes"
+	"errors"
 	"os"
 	"runtime"
 	"strings"
 	"testing"
+	"time"
+
+	"github.com/LubyRuffy/aic/pkg/shell"
 )
 
 func TestNewShellExecutor(t *testing.T) {
@@ -150,10 +154,117 @@ func TestExecute(t *testing.T) {
 			tc.setup()
 
 			// 执行命令
-			err := exec.Execute(tc.command)
+			_, err := exec.Execute(tc.command)
 
 			// 检查结果
 			tc.check(t, stdout.String(), stderr.String(), err)
 		})
 	}
-}
\ No newline at end of file
+}
+
+func TestExecuteExitCode(t *testing.T) {
+	exec := &ShellExecutor{Stdout: &bytes.Buffer{}, Stderr: &bytes.Buffer{}}
+
+	result, err := exec.Execute("exit 3")
+	var exitErr *ExitError
+	if !errors.As(err, &exitErr) {
+		t.Fatalf("Expected *ExitError, got %v", err)
+	}
+	if result.ExitCode != 3 || exitErr.Result.ExitCode != 3 {
+		t.Errorf("Expected exit code 3, got %d", result.ExitCode)
+	}
+	if err.Error() != "command exited with code 3" {
+		t.Errorf("Unexpected error message: %s", err.Error())
+	}
+
+	result, err = exec.Execute("echo ok")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if result.ExitCode != 0 || result.Duration <= 0 {
+		t.Errorf("Unexpected result: %+v", result)
+	}
+}
+
+func TestExecuteTimeout(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("process groups are only supported on Unix")
+	}
+
+	var stdout bytes.Buffer
+	exec := &ShellExecutor{Stdout: &stdout, Stderr: &bytes.Buffer{}, Timeout: 200 * time.Millisecond}
+
+	// 子进程中的sleep也必须被终止，否则输出管道不会关闭
+	start := time.Now()
+	result, err := exec.Execute("sleep 10 | cat; echo done")
+	if time.Since(start) > 5*time.Second {
+		t.Fatalf("Expected the process group to be killed after the timeout")
+	}
+
+	var exitErr *ExitError
+	if !errors.As(err, &exitErr) {
+		t.Fatalf("Expected *ExitError, got %v", err)
+	}
+	if !result.TimedOut || result.Signal != "killed" {
+		t.Errorf("Expected timed out result killed by signal, got %+v", result)
+	}
+	if strings.Contains(stdout.String(), "done") {
+		t.Errorf("Expected the command to be interrupted, got %q", stdout.String())
+	}
+}
+
+func TestExecuteSignal(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("signals are only supported on Unix")
+	}
+
+	exec := &ShellExecutor{Stdout: &bytes.Buffer{}, Stderr: &bytes.Buffer{}}
+	result, err := exec.Execute("kill -TERM $$")
+	if err == nil {
+		t.Fatal("Expected error, got nil")
+	}
+	if result.Signal != "terminated" || result.ExitCode != 128+15 {
+		t.Errorf("Expected SIGTERM with exit code 143, got %+v", result)
+	}
+}
+
+func TestExecuteCapture(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses a Unix shell command")
+	}
+
+	var stdout bytes.Buffer
+	exec := &ShellExecutor{Stdout: &stdout, Stderr: &bytes.Buffer{}, CaptureLimit: 16}
+	result, err := exec.Execute("seq 1 1000; echo oops >&2")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	// 终端上仍然能看到完整的输出
+	if !strings.Contains(stdout.String(), "\n500\n") {
+		t.Error("Expected full output to be streamed")
+	}
+	if !strings.HasPrefix(result.Stdout, "1\n2\n3\n") || !strings.HasSuffix(result.Stdout, "\n1000\n") {
+		t.Errorf("Expected head and tail of the output, got %q", result.Stdout)
+	}
+	if !strings.Contains(result.Stdout, "bytes omitted") {
+		t.Errorf("Expected omission marker, got %q", result.Stdout)
+	}
+	if result.Stderr != "oops\n" {
+		t.Errorf("Expected stderr to be captured, got %q", result.Stderr)
+	}
+}
+
+func TestExecuteWrapper(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses a Unix shell command")
+	}
+
+	// env 作为包装程序，设置的环境变量在shell中可见
+	sh, _ := shell.Lookup("sh")
+	exec := &ShellExecutor{Shell: &sh, Wrapper: []string{"env", "WRAPPED=yes"}, Stderr: &bytes.Buffer{}, CaptureLimit: 64}
+	result, err := exec.Execute("echo $WRAPPED")
+	if err != nil || result.Stdout != "yes\n" {
+		t.Errorf("Unexpected result %+v, %v", result, err)
+	}
+}
@@ -0,0 +1,47 @@
+//go:build !windows
+
+package executor
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// forwardedSignals 是需要转发给命令进程组的信号
+var forwardedSignals = []os.Signal{syscall.SIGINT, syscall.SIGTERM}
+
+// setProcessGroup 让命令运行在独立的进程组中，便于整体发送信号
+func setProcessGroup(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Setpgid = true
+}
+
+// signalProcessGroup 向命令所在的进程组发送信号
+func signalProcessGroup(cmd *exec.Cmd, sig os.Signal) {
+	if s, ok := sig.(syscall.Signal); ok && cmd.Process != nil {
+		_ = syscall.Kill(-cmd.Process.Pid, s)
+	}
+}
+
+// killProcessGroup 终止命令所在的整个进程组
+// 共享终端输入的命令没有独立的进程组，这时只能终止命令本身
+func killProcessGroup(cmd *exec.Cmd) {
+	if cmd.Process == nil {
+		return
+	}
+	if err := syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL); err != nil {
+		_ = cmd.Process.Kill()
+	}
+}
+
+// exitSignal 返回终止进程的信号名称和信号值
+func exitSignal(state *os.ProcessState) (string, int) {
+	ws, ok := state.Sys().(syscall.WaitStatus)
+	if !ok || !ws.Signaled() {
+		return "", 0
+	}
+	return ws.Signal().String(), int(ws.Signal())
+}
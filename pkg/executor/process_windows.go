@@ -0,0 +1,34 @@
+//go:build windows
+
+package executor
+
+import (
+	"os"
+	"os/exec"
+	"strconv"
+)
+
+// forwardedSignals 为空，Windows控制台会把Ctrl+C直接发给所有关联的进程
+var forwardedSignals []os.Signal
+
+// setProcessGroup 在Windows上不需要额外设置
+func setProcessGroup(_ *exec.Cmd) {}
+
+// signalProcessGroup 在Windows上不支持向进程发送信号
+func signalProcessGroup(_ *exec.Cmd, _ os.Signal) {}
+
+// killProcessGroup 终止命令及其所有子进程
+func killProcessGroup(cmd *exec.Cmd) {
+	if cmd.Process == nil {
+		return
+	}
+	// #nosec G204 -- the pid comes from the started process
+	if err := exec.Command("taskkill", "/T", "/F", "/PID", strconv.Itoa(cmd.Process.Pid)).Run(); err != nil {
+		_ = cmd.Process.Kill()
+	}
+}
+
+// exitSignal 在Windows上进程不会被信号终止
+func exitSignal(_ *os.ProcessState) (string, int) {
+	return "", 0
+}
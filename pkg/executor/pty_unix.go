@@ -0,0 +1,119 @@
+//go:build !windows
+
+package executor
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/creack/pty"
+	"golang.org/x/sys/unix"
+	"golang.org/x/term"
+)
+
+// ptySupported 表示当前平台是否支持伪终端
+const ptySupported = true
+
+// pollInterval 是检查终端输入时的轮询间隔
+const pollInterval = 100
+
+// runPTY 在伪终端中运行cmd，把tty设置为原始模式，并同步窗口大小
+func runPTY(cmd *exec.Cmd, tty *os.File, stdout io.Writer, timeout time.Duration, forwardSignals bool) (*ExecResult, error) {
+	start := time.Now()
+	// 标准输入输出全部连接到伪终端，由下面的复制协程转发
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = nil, nil, nil
+	// pty.Start 会让命令成为新会话的首进程，因此整个进程组可以通过pid发送信号
+	ptmx, err := pty.Start(cmd)
+	if err != nil {
+		return nil, fmt.Errorf("error executing command: %v", err)
+	}
+	defer ptmx.Close()
+
+	done := make(chan struct{})
+
+	// 同步窗口大小
+	_ = pty.InheritSize(tty, ptmx)
+	winch := make(chan os.Signal, 1)
+	signal.Notify(winch, syscall.SIGWINCH)
+	defer signal.Stop(winch)
+	go func() {
+		for {
+			select {
+			case <-winch:
+				_ = pty.InheritSize(tty, ptmx)
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	// 原始模式下按键（包括Ctrl+C）会直接交给伪终端处理
+	if state, err := term.MakeRaw(int(tty.Fd())); err == nil {
+		defer func() { _ = term.Restore(int(tty.Fd()), state) }()
+	}
+
+	input := make(chan struct{})
+	go func(fd int) {
+		copyInput(ptmx, fd, done)
+		close(input)
+	}(int(tty.Fd()))
+	defer func() {
+		close(done)
+		<-input
+	}()
+
+	output := make(chan struct{})
+	go func() {
+		// 命令结束后读取伪终端会返回EIO
+		_, _ = io.Copy(stdout, ptmx)
+		close(output)
+	}()
+
+	result, err := wait(cmd, start, timeout, forwardSignals)
+	select {
+	case <-output:
+	case <-time.After(waitDelay):
+	}
+	return result, err
+}
+
+// copyInput 把终端的输入复制到伪终端，直到done被关闭
+// 使用poll而不是阻塞读取，避免命令结束后继续抢占用户的下一次输入
+func copyInput(dst io.Writer, fd int, done <-chan struct{}) {
+	fds := []unix.PollFd{{Fd: int32(fd), Events: unix.POLLIN}}
+	buf := make([]byte, 4096)
+	for {
+		select {
+		case <-done:
+			return
+		default:
+		}
+
+		n, err := unix.Poll(fds, pollInterval)
+		if err != nil {
+			if errors.Is(err, unix.EINTR) {
+				continue
+			}
+			return
+		}
+		if n == 0 {
+			continue
+		}
+
+		nr, err := unix.Read(fd, buf)
+		if nr > 0 {
+			if _, err := dst.Write(buf[:nr]); err != nil {
+				return
+			}
+		}
+		if err != nil || nr == 0 {
+			return
+		}
+	}
+}
@@ -0,0 +1,89 @@
+//go:build !windows
+
+package executor
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/creack/pty"
+)
+
+func TestExecutePTY(t *testing.T) {
+	// 用一对伪终端模拟用户的终端
+	ptmx, tty, err := pty.Open()
+	if err != nil {
+		t.Skipf("pty not available: %v", err)
+	}
+	defer ptmx.Close()
+	defer tty.Close()
+	if err := pty.Setsize(tty, &pty.Winsize{Rows: 40, Cols: 120}); err != nil {
+		t.Fatal(err)
+	}
+
+	exec := &ShellExecutor{Stdin: tty, Stdout: tty, Stderr: tty, PTY: true, CaptureLimit: 1024}
+
+	lines := make(chan string, 10)
+	go func() {
+		scanner := bufio.NewScanner(ptmx)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+	}()
+
+	result, err := exec.Execute("test -t 0 && test -t 1 && echo is-a-tty; stty size")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if !strings.Contains(result.Stdout, "is-a-tty") {
+		t.Errorf("Expected the command to run in a terminal, got %q", result.Stdout)
+	}
+	// 窗口大小需要同步到命令的伪终端
+	if !strings.Contains(result.Stdout, "40 120") {
+		t.Errorf("Expected window size 40 120, got %q", result.Stdout)
+	}
+
+	select {
+	case line := <-lines:
+		if !strings.Contains(line, "is-a-tty") {
+			t.Errorf("Expected output on the terminal, got %q", line)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("Expected output to be streamed to the terminal")
+	}
+}
+
+func TestExecuteWithoutPTY(t *testing.T) {
+	var stdout bytes.Buffer
+	exec := &ShellExecutor{Stdin: strings.NewReader("piped input\n"), Stdout: &stdout, Stderr: &bytes.Buffer{}, PTY: true}
+
+	// 不是终端时回退到普通管道，并把输入传给命令
+	if _, err := exec.Execute("test -t 0 || cat"); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if stdout.String() != "piped input\n" {
+		t.Errorf("Expected stdin to be passed through, got %q", stdout.String())
+	}
+}
+
+func TestExecuteTimeoutTerminalInput(t *testing.T) {
+	_, tty, err := pty.Open()
+	if err != nil {
+		t.Skipf("pty not available: %v", err)
+	}
+	defer tty.Close()
+
+	// 共享终端输入而不使用伪终端时，命令留在aic的进程组中，超时后也必须被终止
+	exec := &ShellExecutor{Stdin: tty, Stdout: &bytes.Buffer{}, Stderr: &bytes.Buffer{}, Timeout: 200 * time.Millisecond}
+	start := time.Now()
+	result, err := exec.Execute("sleep 5")
+	if time.Since(start) > 3*time.Second {
+		t.Fatalf("Expected the command to be killed after the timeout, took %s", time.Since(start))
+	}
+	if err == nil || !result.TimedOut || result.ExitCode == 0 {
+		t.Errorf("Expected a failed timed out result, got %+v, %v", result, err)
+	}
+}
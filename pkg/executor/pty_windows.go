@@ -0,0 +1,19 @@
+//go:build windows
+
+package executor
+
+import (
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"time"
+)
+
+// ptySupported 表示当前平台是否支持伪终端
+const ptySupported = false
+
+// runPTY 在Windows上不支持，调用方会回退到普通管道
+func runPTY(_ *exec.Cmd, _ *os.File, _ io.Writer, _ time.Duration, _ bool) (*ExecResult, error) {
+	return nil, errors.New("pty is not supported on windows")
+}
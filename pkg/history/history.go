@@ -0,0 +1,123 @@
+package history
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/LubyRuffy/aic/pkg/ollama"
+)
+
+// FileName 是配置目录下历史记录文件的名称
+const FileName = "history.jsonl"
+
+// 历史记录的类型
+const (
+	KindAgent = "agent"
+	// KindCommand 是保存了快照的命令，可以通过 aic undo 撤销
+	KindCommand = "command"
+)
+
+// Step 是agent模式中执行或被拒绝的一条命令
+type Step struct {
+	Command  string `json:"command"`
+	Reason   string `json:"reason,omitempty"`
+	ExitCode int    `json:"exit_code"`
+	Output   string `json:"output,omitempty"`
+	// Rejected 是命令被拒绝执行的原因
+	Rejected string `json:"rejected,omitempty"`
+}
+
+// Entry 是一条历史记录
+type Entry struct {
+	ID     string    `json:"id"`
+	Time   time.Time `json:"time"`
+	Kind   string    `json:"kind"`
+	Prompt string    `json:"prompt"`
+	Model  string    `json:"model"`
+	Steps  []Step    `json:"steps,omitempty"`
+	Answer string    `json:"answer,omitempty"`
+	// Error 是记录未能正常完成的原因
+	Error string `json:"error,omitempty"`
+	// Transcript 是与模型的完整对话，不包含系统提示词
+	Transcript []ollama.Message `json:"transcript,omitempty"`
+	// Snapshot 是执行前保存的快照ID
+	Snapshot string `json:"snapshot,omitempty"`
+}
+
+// NewID 生成按时间排序的记录ID
+func NewID(t time.Time) string {
+	b := make([]byte, 2)
+	_, _ = rand.Read(b)
+	return t.Format("20060102-150405") + "-" + hex.EncodeToString(b)
+}
+
+// Append 把记录追加到path，ID和时间为空时自动生成
+func Append(path string, e *Entry) error {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	if e.ID == "" {
+		e.ID = NewID(e.Time)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return fmt.Errorf("error creating history directory: %v", err)
+	}
+	data, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("error serializing history: %v", err)
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return fmt.Errorf("error opening history: %v", err)
+	}
+	defer f.Close()
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("error writing history: %v", err)
+	}
+	return nil
+}
+
+// Load 读取path中的所有记录，文件不存在时返回空列表，无法解析的行会被跳过
+func Load(path string) ([]*Entry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error reading history: %v", err)
+	}
+	defer f.Close()
+
+	var entries []*Entry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var e Entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			continue
+		}
+		entries = append(entries, &e)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading history: %v", err)
+	}
+	return entries, nil
+}
+
+// Find 返回ID为id的记录
+func Find(entries []*Entry, id string) (*Entry, bool) {
+	for _, e := range entries {
+		if e.ID == id {
+			return e, true
+		}
+	}
+	return nil, false
+}
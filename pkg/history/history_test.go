@@ -0,0 +1,57 @@
+package history
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/LubyRuffy/aic/pkg/ollama"
+)
+
+func TestAppendLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sub", FileName)
+	if entries, err := Load(path); err != nil || len(entries) != 0 {
+		t.Fatalf("Load() of missing file = %v, %v", entries, err)
+	}
+
+	first := &Entry{Kind: KindAgent, Prompt: "who owns port 8080", Steps: []Step{{Command: "lsof -i :8080", Output: "nginx 42"}}, Answer: "nginx"}
+	if err := Append(path, first); err != nil {
+		t.Fatal(err)
+	}
+	if first.ID == "" || first.Time.IsZero() {
+		t.Errorf("Expected ID and time to be set, got %+v", first)
+	}
+	second := &Entry{Kind: KindAgent, Prompt: "disk", Transcript: []ollama.Message{{Role: ollama.RoleUser, Content: "disk"}}}
+	if err := Append(path, second); err != nil {
+		t.Fatal(err)
+	}
+
+	// Broken lines are skipped
+	f, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	f.WriteString("garbage\n")
+	f.Close()
+
+	entries, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("Load() returned %d entries, want 2", len(entries))
+	}
+	got, ok := Find(entries, first.ID)
+	if !ok || got.Answer != "nginx" || got.Steps[0].Output != "nginx 42" {
+		t.Errorf("Find() = %+v, %v", got, ok)
+	}
+	if _, ok := Find(entries, "missing"); ok {
+		t.Error("Find() of missing ID = true")
+	}
+}
+
+func TestNewID(t *testing.T) {
+	id := NewID(time.Date(2025, 3, 1, 12, 30, 0, 0, time.UTC))
+	if !strings.HasPrefix(id, "20250301-123000-") || len(id) != len("20250301-123000-abcd") {
+		t.Errorf("NewID() = %q", id)
+	}
+}
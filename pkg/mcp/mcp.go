@@ -0,0 +1,224 @@
+package mcp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// ProtocolVersion 是默认使用的MCP协议版本
+const ProtocolVersion = "2024-11-05"
+
+// supportedVersions 是支持的协议版本，客户端请求其中的版本时使用相同的版本
+var supportedVersions = map[string]bool{
+	"2024-11-05": true,
+	"2025-03-26": true,
+	"2025-06-18": true,
+}
+
+// JSON-RPC 错误码
+const (
+	CodeParseError     = -32700
+	CodeInvalidRequest = -32600
+	CodeMethodNotFound = -32601
+	CodeInvalidParams  = -32602
+	CodeInternalError  = -32603
+)
+
+// Tool 是服务端提供给客户端调用的工具
+type Tool struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description"`
+	InputSchema map[string]interface{} `json:"inputSchema"`
+	// Handler 处理工具调用，返回值会被序列化为JSON文本，返回错误时结果标记为 isError
+	Handler func(args json.RawMessage) (interface{}, error) `json:"-"`
+}
+
+// Server 是基于stdio的MCP服务端，每行一条JSON-RPC消息
+type Server struct {
+	Name    string
+	Version string
+
+	tools []*Tool
+	mu    sync.Mutex
+}
+
+// AddTool 注册工具
+func (s *Server) AddTool(t *Tool) {
+	s.tools = append(s.tools, t)
+}
+
+// Request 是JSON-RPC请求或通知，通知没有ID
+type Request struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+// Response 是JSON-RPC响应
+type Response struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  interface{}     `json:"result,omitempty"`
+	Error   *Error          `json:"error,omitempty"`
+}
+
+// Error 是JSON-RPC错误
+type Error struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// Content 是工具调用结果中的一段内容
+type Content struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+// CallToolResult 是 tools/call 的结果
+type CallToolResult struct {
+	Content []Content `json:"content"`
+	IsError bool      `json:"isError,omitempty"`
+}
+
+// Serve 从r读取请求并把响应写到w，直到r结束
+func (s *Server) Serve(r io.Reader, w io.Writer) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		if resp := s.handle(line); resp != nil {
+			if err := s.write(w, resp); err != nil {
+				return err
+			}
+		}
+	}
+	return scanner.Err()
+}
+
+// write 把一条响应写成一行
+func (s *Server) write(w io.Writer, resp *Response) error {
+	data, err := json.Marshal(resp)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
+
+// handle 处理一条消息，通知不需要响应时返回nil
+func (s *Server) handle(line []byte) *Response {
+	var req Request
+	if err := json.Unmarshal(line, &req); err != nil {
+		return errorResponse(json.RawMessage("null"), CodeParseError, "parse error: "+err.Error())
+	}
+	if req.JSONRPC != "2.0" || req.Method == "" {
+		id := req.ID
+		if id == nil {
+			id = json.RawMessage("null")
+		}
+		return errorResponse(id, CodeInvalidRequest, "invalid request")
+	}
+
+	result, rpcErr := s.dispatch(&req)
+	if req.ID == nil {
+		// 通知没有响应
+		return nil
+	}
+	if rpcErr != nil {
+		return &Response{JSONRPC: "2.0", ID: req.ID, Error: rpcErr}
+	}
+	return &Response{JSONRPC: "2.0", ID: req.ID, Result: result}
+}
+
+// dispatch 调用请求的方法
+func (s *Server) dispatch(req *Request) (interface{}, *Error) {
+	switch req.Method {
+	case "initialize":
+		var params struct {
+			ProtocolVersion string `json:"protocolVersion"`
+		}
+		_ = json.Unmarshal(req.Params, &params)
+		version := ProtocolVersion
+		if supportedVersions[params.ProtocolVersion] {
+			version = params.ProtocolVersion
+		}
+		return map[string]interface{}{
+			"protocolVersion": version,
+			"capabilities":    map[string]interface{}{"tools": map[string]interface{}{"listChanged": false}},
+			"serverInfo":      map[string]interface{}{"name": s.Name, "version": s.Version},
+		}, nil
+	case "notifications/initialized", "notifications/cancelled":
+		return nil, nil
+	case "ping":
+		return struct{}{}, nil
+	case "tools/list":
+		tools := s.tools
+		if tools == nil {
+			tools = []*Tool{}
+		}
+		return map[string]interface{}{"tools": tools}, nil
+	case "tools/call":
+		return s.callTool(req.Params)
+	default:
+		return nil, &Error{Code: CodeMethodNotFound, Message: "method not found: " + req.Method}
+	}
+}
+
+// callTool 调用工具，工具本身的错误作为 isError 结果返回，而不是协议错误
+func (s *Server) callTool(raw json.RawMessage) (interface{}, *Error) {
+	var params struct {
+		Name      string          `json:"name"`
+		Arguments json.RawMessage `json:"arguments"`
+	}
+	if err := json.Unmarshal(raw, &params); err != nil || params.Name == "" {
+		return nil, &Error{Code: CodeInvalidParams, Message: "invalid params: name is required"}
+	}
+
+	var tool *Tool
+	for _, t := range s.tools {
+		if t.Name == params.Name {
+			tool = t
+		}
+	}
+	if tool == nil {
+		return nil, &Error{Code: CodeInvalidParams, Message: "unknown tool: " + params.Name}
+	}
+	if len(params.Arguments) == 0 || string(params.Arguments) == "null" {
+		params.Arguments = json.RawMessage("{}")
+	}
+
+	result, err := tool.Handler(params.Arguments)
+	if err != nil {
+		return &CallToolResult{Content: []Content{{Type: "text", Text: err.Error()}}, IsError: true}, nil
+	}
+	text, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return nil, &Error{Code: CodeInternalError, Message: fmt.Sprintf("error serializing result: %v", err)}
+	}
+	return &CallToolResult{Content: []Content{{Type: "text", Text: string(text)}}}, nil
+}
+
+func errorResponse(id json.RawMessage, code int, message string) *Response {
+	return &Response{JSONRPC: "2.0", ID: id, Error: &Error{Code: code, Message: message}}
+}
+
+// DecodeArgs 解析工具参数，不允许未定义的参数
+func DecodeArgs(raw json.RawMessage, v interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return errors.New("invalid arguments: " + err.Error())
+	}
+	return nil
+}
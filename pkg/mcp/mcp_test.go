@@ -0,0 +1,137 @@
+package mcp
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// script runs the server with the client messages and returns the decoded responses
+func script(t *testing.T, s *Server, messages ...string) []map[string]interface{} {
+	t.Helper()
+	var out strings.Builder
+	if err := s.Serve(strings.NewReader(strings.Join(messages, "\n")+"\n"), &out); err != nil {
+		t.Fatalf("Serve() error = %v", err)
+	}
+
+	var responses []map[string]interface{}
+	scanner := bufio.NewScanner(strings.NewReader(out.String()))
+	for scanner.Scan() {
+		var v map[string]interface{}
+		if err := json.Unmarshal(scanner.Bytes(), &v); err != nil {
+			t.Fatalf("Invalid response line %q: %v", scanner.Text(), err)
+		}
+		if v["jsonrpc"] != "2.0" {
+			t.Errorf("Expected jsonrpc 2.0, got %v", v)
+		}
+		responses = append(responses, v)
+	}
+	return responses
+}
+
+func newTestServer() *Server {
+	s := &Server{Name: "aic", Version: "test"}
+	s.AddTool(&Tool{
+		Name:        "echo",
+		Description: "Echoes the text",
+		InputSchema: map[string]interface{}{"type": "object", "properties": map[string]interface{}{"text": map[string]interface{}{"type": "string"}}},
+		Handler: func(raw json.RawMessage) (interface{}, error) {
+			var args struct {
+				Text string `json:"text"`
+			}
+			if err := DecodeArgs(raw, &args); err != nil {
+				return nil, err
+			}
+			if args.Text == "" {
+				return nil, errors.New("text is required")
+			}
+			return map[string]string{"text": args.Text}, nil
+		},
+	})
+	return s
+}
+
+func TestHandshake(t *testing.T) {
+	responses := script(t, newTestServer(),
+		`{"jsonrpc": "2.0", "id": 1, "method": "initialize", "params": {"protocolVersion": "2025-03-26", "capabilities": {}, "clientInfo": {"name": "test", "version": "1"}}}`,
+		`{"jsonrpc": "2.0", "method": "notifications/initialized"}`,
+		`{"jsonrpc": "2.0", "id": "two", "method": "ping"}`,
+		`{"jsonrpc": "2.0", "id": 3, "method": "initialize", "params": {"protocolVersion": "1999-01-01"}}`,
+	)
+	if len(responses) != 3 {
+		t.Fatalf("Expected 3 responses (no response to notifications), got %d: %v", len(responses), responses)
+	}
+
+	init := responses[0]["result"].(map[string]interface{})
+	if responses[0]["id"] != 1.0 || init["protocolVersion"] != "2025-03-26" {
+		t.Errorf("Unexpected initialize response: %v", responses[0])
+	}
+	if init["serverInfo"].(map[string]interface{})["name"] != "aic" || init["capabilities"].(map[string]interface{})["tools"] == nil {
+		t.Errorf("Unexpected server info or capabilities: %v", init)
+	}
+	if responses[1]["id"] != "two" || responses[1]["result"] == nil {
+		t.Errorf("Unexpected ping response: %v", responses[1])
+	}
+	if responses[2]["result"].(map[string]interface{})["protocolVersion"] != ProtocolVersion {
+		t.Errorf("Expected the default version for an unsupported version, got %v", responses[2])
+	}
+}
+
+func TestTools(t *testing.T) {
+	responses := script(t, newTestServer(),
+		`{"jsonrpc": "2.0", "id": 1, "method": "tools/list"}`,
+		`{"jsonrpc": "2.0", "id": 2, "method": "tools/call", "params": {"name": "echo", "arguments": {"text": "hi"}}}`,
+		`{"jsonrpc": "2.0", "id": 3, "method": "tools/call", "params": {"name": "echo", "arguments": {}}}`,
+		`{"jsonrpc": "2.0", "id": 4, "method": "tools/call", "params": {"name": "echo", "arguments": {"bogus": 1}}}`,
+		`{"jsonrpc": "2.0", "id": 5, "method": "tools/call", "params": {"name": "missing"}}`,
+	)
+	if len(responses) != 5 {
+		t.Fatalf("Expected 5 responses, got %d", len(responses))
+	}
+
+	tools := responses[0]["result"].(map[string]interface{})["tools"].([]interface{})
+	tool := tools[0].(map[string]interface{})
+	if len(tools) != 1 || tool["name"] != "echo" || tool["inputSchema"] == nil || tool["description"] == "" {
+		t.Errorf("Unexpected tools: %v", tools)
+	}
+
+	result := responses[1]["result"].(map[string]interface{})
+	content := result["content"].([]interface{})[0].(map[string]interface{})
+	if content["type"] != "text" || !strings.Contains(content["text"].(string), `"text": "hi"`) || result["isError"] != nil {
+		t.Errorf("Unexpected call result: %v", result)
+	}
+
+	// Tool errors are results with isError, not protocol errors
+	for _, r := range responses[2:4] {
+		result := r["result"].(map[string]interface{})
+		if result["isError"] != true {
+			t.Errorf("Expected isError result, got %v", r)
+		}
+	}
+	if e := responses[4]["error"].(map[string]interface{}); e["code"] != float64(CodeInvalidParams) {
+		t.Errorf("Expected invalid params for an unknown tool, got %v", responses[4])
+	}
+}
+
+func TestProtocolErrors(t *testing.T) {
+	responses := script(t, newTestServer(),
+		`not json`,
+		`{"jsonrpc": "1.0", "id": 1, "method": "ping"}`,
+		`{"jsonrpc": "2.0", "id": 2, "method": "resources/list"}`,
+		`{"jsonrpc": "2.0", "method": "unknown/notification"}`,
+	)
+	if len(responses) != 3 {
+		t.Fatalf("Expected 3 responses, got %d: %v", len(responses), responses)
+	}
+	for i, code := range []int{CodeParseError, CodeInvalidRequest, CodeMethodNotFound} {
+		e, ok := responses[i]["error"].(map[string]interface{})
+		if !ok || e["code"] != float64(code) {
+			t.Errorf("Response %d: expected error code %d, got %v", i, code, responses[i])
+		}
+	}
+	if _, ok := responses[0]["id"]; !ok || responses[0]["id"] != nil {
+		t.Errorf("Expected null id for a parse error, got %v", responses[0])
+	}
+}
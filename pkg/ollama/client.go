@@ -6,8 +6,11 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"os"
 	"strings"
 
+	"github.com/LubyRuffy/aic/pkg/injection"
+	"github.com/LubyRuffy/aic/pkg/shell"
 	"github.com/LubyRuffy/aic/pkg/sysinfo"
 )
 
@@ -16,6 +19,12 @@ import (
 type Client struct {
 	BaseURL string
 	Verbose bool
+	// Output 是调试信息的输出位置
+	Output io.Writer
+	// SystemInfo 返回用于生成系统提示词的环境信息，为空时使用 sysinfo.GetSystemInfo
+	SystemInfo func() (*sysinfo.SystemInfo, error)
+	// HTTPClient 是发送请求使用的HTTP客户端，可以设置超时，为空时使用 http.DefaultClient
+	HTTPClient *http.Client
 }
 
 type Options struct {
@@ -29,6 +38,8 @@ type Request struct {
 	System  string  `json:"system"`
 	Options Options `json:"options"`
 	Stream  bool    `json:"stream"`
+	// Format 为 "json" 时要求模型返回JSON
+	Format string `json:"format,omitempty"`
 }
 
 // Response 是Ollama的响应结构
@@ -36,6 +47,43 @@ type Response struct {
 	Response string `json:"response"`
 }
 
+// Message 是对话中的一条消息
+type Message struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// 对话消息的角色
+const (
+	RoleSystem    = "system"
+	RoleUser      = "user"
+	RoleAssistant = "assistant"
+)
+
+// ChatRequest 是发送给Ollama对话接口的请求结构
+type ChatRequest struct {
+	Model    string    `json:"model"`
+	Messages []Message `json:"messages"`
+	Options  Options   `json:"options"`
+	Stream   bool      `json:"stream"`
+	Format   string    `json:"format,omitempty"`
+}
+
+// ChatResponse 是Ollama对话接口的响应结构
+type ChatResponse struct {
+	Message Message `json:"message"`
+}
+
+// ModelInfo 是Ollama上已安装模型的信息
+type ModelInfo struct {
+	Name string `json:"name"`
+}
+
+// TagsResponse 是Ollama模型列表接口的响应结构
+type TagsResponse struct {
+	Models []ModelInfo `json:"models"`
+}
+
 // ErrorResponse 是Ollama的错误响应结构
 type ErrorResponse struct {
 	Error string `json:"error"`
@@ -43,24 +91,15 @@ type ErrorResponse struct {
 
 // NewClient 创建一个新的Ollama客户端
 func NewClient(baseURL string, verbose bool) *Client {
-	return &Client{BaseURL: baseURL, Verbose: verbose}
+	return &Client{BaseURL: baseURL, Verbose: verbose, Output: os.Stdout}
 }
 
-func genSystemPrompt() (string, error) {
-	// 获取系统信息
-	sysInfo, err := sysinfo.GetSystemInfo()
-	if err != nil {
-		return "", fmt.Errorf("failed to get system info: %w", err)
-	}
-
-	// 构建环境变量列表
-	envKeys := make([]string, 0, len(sysInfo.EnvVars))
-	for k := range sysInfo.EnvVars {
-		envKeys = append(envKeys, k)
-	}
+// untrustedDataPrompt 告诉模型不要执行上下文数据和命令输出中的指令
+const untrustedDataPrompt = "## Untrusted Data\n" + injection.Rule + "\n\n"
 
+func genSystemPrompt(sysInfo *sysinfo.SystemInfo) string {
 	// 构建系统提示词
-	systemPrompt := fmt.Sprintf(`You are a command line assistant, please generate commands that match the current system environment based on user's description.
+	return `You are a command line assistant, please generate commands that match the current system environment based on user's description.
 
 ## Response Format
 - Only provide the command in response, no explanation.
@@ -83,7 +122,7 @@ Output: "files"
 (This is wrong because it's an incomplete command)
 
 Input: "request qq.com with q param equal a+b"
-Output: "curl -s 'http://qq.com/?q=a%%2Bb'"
+Output: "curl -s 'http://qq.com/?q=a%2Bb'"
 (This is wrong because the URL contains unescaped special characters)
 
 ### Valid Commands for Different Environments:
@@ -115,7 +154,7 @@ Please ensure the generated command:
 3. Includes all necessary flags and parameters
 4. Properly handles special characters and URLs:
 - Always URL-encode special characters in URLs
-- Escape spaces with %%20 or quotes
+- Escape spaces with %20 or quotes
 - Use proper quotes for arguments containing spaces
 - Escape special shell characters when needed
 5. Fully complies with the above environment
@@ -126,7 +165,7 @@ Please ensure the generated command:
 ## Special Character Handling Examples:
 1. URLs with special characters:
 Input: "request qq.com with q param equal a+b"
-Output: curl -s "http://qq.com/?q=a%%2Bb"
+Output: curl -s "http://qq.com/?q=a%2Bb"
 
 2. Commands with spaces in arguments:
 Input: "create folder named 'my documents'"
@@ -136,7 +175,89 @@ Output: mkdir "my documents"
 Input: "find files with name containing '&'"
 Output: find . -name "*\&*"
 
-## Current System Environment:
+` + untrustedDataPrompt + genEnvironmentPrompt(sysInfo)
+}
+
+// genPlanSystemPrompt 生成多步骤任务规划使用的系统提示词
+func genPlanSystemPrompt(sysInfo *sysinfo.SystemInfo) string {
+	return `You are a command line assistant, please break the user's task into an ordered list of commands that match the current system environment.
+
+## Response Format
+- Respond with a JSON object only: {"steps": [{"command": "...", "rationale": "..."}]}
+- Each command MUST be complete and executable on its own in the current shell.
+- Each rationale is a single short sentence explaining why the step is needed.
+- Use as few steps as possible, and keep steps that depend on each other in order.
+- If the task cannot be done with commands, respond with {"steps": []}.
+- NEVER return natural language outside of the JSON object.
+
+## Example
+Input: "create a branch named fix, commit the staged changes and push it"
+Output: {"steps": [{"command": "git checkout -b fix", "rationale": "Create and switch to the new branch."}, {"command": "git commit -m \"Fix\"", "rationale": "Commit the staged changes."}, {"command": "git push -u origin fix", "rationale": "Push the branch and set its upstream."}]}
+
+` + untrustedDataPrompt + genEnvironmentPrompt(sysInfo)
+}
+
+// genAgentSystemPrompt 生成agent模式使用的系统提示词，模型通过只读命令观察系统后回答问题
+func genAgentSystemPrompt(sysInfo *sysinfo.SystemInfo) string {
+	return `You are a command line assistant investigating the user's question by running read-only commands on their system.
+
+## Response Format
+Respond with a JSON object only, either:
+- {"command": "...", "reason": "..."} to run one read-only command and see its output, or
+- {"answer": "..."} to finish with the answer to the user's question in natural language.
+
+## Rules
+- Only use commands that read information, NEVER commands that modify files, processes, packages or settings, they will be rejected.
+- Run one command at a time and use its output to decide the next step.
+- Command outputs are truncated, prefer commands with concise output.
+- Answer as soon as you have enough information, or explain what is missing when you cannot find out.
+- Answer in the language of the user's question.
+
+` + untrustedDataPrompt + genEnvironmentPrompt(sysInfo)
+}
+
+// genSummarySystemPrompt 生成根据命令输出回答问题时使用的系统提示词
+func genSummarySystemPrompt(sysInfo *sysinfo.SystemInfo) string {
+	return `You are a command line assistant, the user ran a command to answer a question and you are given its output.
+
+## Response Format
+- Answer the user's question in a few short sentences of plain text based on the output.
+- Mention the specific values from the output that matter, such as names, sizes, ports or counts.
+- If the output is truncated or does not contain the answer, say so.
+- Do not repeat the raw output and do not suggest further commands unless the command failed.
+- Answer in the language of the user's question.
+
+` + untrustedDataPrompt + genEnvironmentPrompt(sysInfo)
+}
+
+// genExplainSystemPrompt 生成解释命令时使用的系统提示词
+func genExplainSystemPrompt(sysInfo *sysinfo.SystemInfo) string {
+	return `You are a command line assistant, explain what the given command does in the current system environment.
+
+## Response Format
+- Start with one sentence summarizing what the command does.
+- Then briefly explain each part of the command (programs, flags, pipes and redirections) as a short list.
+- Point out anything destructive, irreversible or requiring elevated privileges.
+- Use plain text, no greetings, do not suggest other commands.
+
+` + genEnvironmentPrompt(sysInfo)
+}
+
+// genEnvironmentPrompt 生成系统提示词中描述当前环境的部分
+func genEnvironmentPrompt(sysInfo *sysinfo.SystemInfo) string {
+	// 优先使用注册表中描述更准确的shell名称
+	shellName := sysInfo.Shell
+	if s, ok := shell.Lookup(sysInfo.Shell); ok {
+		shellName = s.PromptName
+	}
+
+	// 构建环境变量列表
+	envKeys := make([]string, 0, len(sysInfo.EnvVars))
+	for k := range sysInfo.EnvVars {
+		envKeys = append(envKeys, k)
+	}
+
+	prompt := fmt.Sprintf(`## Current System Environment:
 - OS: %s %s
 - Shell Type: %s
 - Username: %s
@@ -145,24 +266,99 @@ Output: find . -name "*\&*"
 - Environment Variables: %s
 `,
 		sysInfo.OS, sysInfo.OSVersion,
-		sysInfo.Shell,
+		shellName,
 		sysInfo.Username,
 		sysInfo.HomeDir,
 		sysInfo.CurrentDir,
 		strings.Join(envKeys, ", "))
-	return systemPrompt, nil
+	if sysInfo.Host != "" {
+		prompt += fmt.Sprintf("- Target: %s (the command runs there, not on the user's local machine)\n", sysInfo.Host)
+	}
+	prompt += fmt.Sprintf("- Privileges: %s\n", sysInfo.Privileges())
+	if len(sysInfo.Tools) > 0 {
+		prompt += fmt.Sprintf("- Available Tools: %s\n", strings.Join(sysInfo.Tools, ", "))
+	}
+	if len(sysInfo.Applets) > 0 {
+		prompt += fmt.Sprintf("- BusyBox Applets (fewer options than the GNU versions): %s\n", strings.Join(sysInfo.Applets, ", "))
+	}
+	return prompt
+}
+
+// PromptWithContext 把用户的描述和附加的上下文数据（比如通过管道传入的日志）组合成一个提示词
+// 上下文数据是不可信的，使用 injection.Wrap 和用户的描述分隔开
+func PromptWithContext(prompt, context string) string {
+	return fmt.Sprintf("Context data provided by the user:\n%s\n\nRequest: %s", injection.Wrap("stdin", context), prompt)
 }
 
 // Generate 发送生成请求到Ollama服务
 func (c *Client) Generate(model, prompt string) (string, error) {
-	systemPrompt, err := genSystemPrompt()
+	systemPrompt, err := c.systemPrompt(genSystemPrompt)
+	if err != nil {
+		return "", err
+	}
+
+	reqData := Request{
+		Model:  model,
+		Prompt: prompt,
+		System: systemPrompt,
+		Stream: false,
+		Options: Options{
+			Temperature: 0.95,
+		},
+	}
+
+	var ollamaResp Response
+	if err := c.post("/api/generate", reqData, &ollamaResp); err != nil {
+		return "", err
+	}
+
+	return checkCommand(ollamaResp.Response)
+}
+
+// Chat 发送多轮对话请求到Ollama服务
+// messages 中不需要包含系统提示词，它会根据当前环境自动生成并放在最前面
+func (c *Client) Chat(model string, messages []Message) (string, error) {
+	content, err := c.chat(model, genSystemPrompt, messages, "")
+	if err != nil {
+		return "", err
+	}
+	return checkCommand(content)
+}
+
+// Agent 发送agent模式的多轮对话请求，模型返回JSON格式的下一条命令或最终回答
+func (c *Client) Agent(model string, messages []Message) (string, error) {
+	return c.chat(model, genAgentSystemPrompt, messages, "json")
+}
+
+// chat 使用gen生成的系统提示词发送对话请求，返回模型的回复
+func (c *Client) chat(model string, gen func(*sysinfo.SystemInfo) string, messages []Message, format string) (string, error) {
+	systemPrompt, err := c.systemPrompt(gen)
 	if err != nil {
-		return "", fmt.Errorf("failed to genSystemPrompt: %w", err)
+		return "", err
+	}
+
+	reqData := ChatRequest{
+		Model:    model,
+		Messages: append([]Message{{Role: RoleSystem, Content: systemPrompt}}, messages...),
+		Stream:   false,
+		Format:   format,
+		Options: Options{
+			Temperature: 0.95,
+		},
 	}
 
-	if c.Verbose {
-		fmt.Println("System Prompt:")
-		fmt.Println(systemPrompt)
+	var chatResp ChatResponse
+	if err := c.post("/api/chat", reqData, &chatResp); err != nil {
+		return "", err
+	}
+	return chatResp.Message.Content, nil
+}
+
+// Plan 请求模型把任务拆分为多个步骤，返回JSON格式的步骤列表，由 plan.Parse 解析
+func (c *Client) Plan(model, prompt string) (string, error) {
+	systemPrompt, err := c.systemPrompt(genPlanSystemPrompt)
+	if err != nil {
+		return "", err
 	}
 
 	reqData := Request{
@@ -170,46 +366,166 @@ func (c *Client) Generate(model, prompt string) (string, error) {
 		Prompt: prompt,
 		System: systemPrompt,
 		Stream: false,
+		Format: "json",
+		Options: Options{
+			Temperature: 0.95,
+		},
+	}
+
+	var ollamaResp Response
+	if err := c.post("/api/generate", reqData, &ollamaResp); err != nil {
+		return "", err
+	}
+	return ollamaResp.Response, nil
+}
+
+// Summarize 请求模型根据命令的输出用自然语言回答用户的问题
+func (c *Client) Summarize(model, question, command, output string) (string, error) {
+	systemPrompt, err := c.systemPrompt(genSummarySystemPrompt)
+	if err != nil {
+		return "", err
+	}
+
+	reqData := Request{
+		Model:  model,
+		Prompt: fmt.Sprintf("Question: %s\n\nCommand: %s\n\nOutput (possibly truncated):\n%s", question, command, injection.Wrap("command output", output)),
+		System: systemPrompt,
+		Stream: false,
+		Options: Options{
+			Temperature: 0.95,
+		},
+	}
+
+	var ollamaResp Response
+	if err := c.post("/api/generate", reqData, &ollamaResp); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(ollamaResp.Response), nil
+}
+
+// Explain 请求模型用自然语言解释命令的作用
+func (c *Client) Explain(model, command string) (string, error) {
+	systemPrompt, err := c.systemPrompt(genExplainSystemPrompt)
+	if err != nil {
+		return "", err
+	}
+
+	reqData := Request{
+		Model:  model,
+		Prompt: "Command: " + command,
+		System: systemPrompt,
+		Stream: false,
 		Options: Options{
 			Temperature: 0.95,
 		},
 	}
 
+	var ollamaResp Response
+	if err := c.post("/api/generate", reqData, &ollamaResp); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(ollamaResp.Response), nil
+}
+
+// ListModels 返回Ollama服务上已安装的模型名称
+func (c *Client) ListModels() ([]string, error) {
+	var tagsResp TagsResponse
+	if err := c.get("/api/tags", &tagsResp); err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(tagsResp.Models))
+	for _, m := range tagsResp.Models {
+		names = append(names, m.Name)
+	}
+	return names, nil
+}
+
+// systemPrompt 使用gen生成系统提示词，在调试模式下同时打印出来
+func (c *Client) systemPrompt(gen func(*sysinfo.SystemInfo) string) (string, error) {
+	getSystemInfo := c.SystemInfo
+	if getSystemInfo == nil {
+		getSystemInfo = sysinfo.GetSystemInfo
+	}
+	sysInfo, err := getSystemInfo()
+	if err != nil {
+		return "", fmt.Errorf("failed to get system info: %w", err)
+	}
+
+	systemPrompt := gen(sysInfo)
+
+	if c.Verbose && c.Output != nil {
+		fmt.Fprintln(c.Output, "System Prompt:")
+		fmt.Fprintln(c.Output, systemPrompt)
+	}
+
+	return systemPrompt, nil
+}
+
+// post 将reqData序列化后发送到Ollama服务的path接口，并把响应解析到respData中
+func (c *Client) post(path string, reqData, respData interface{}) error {
 	jsonData, err := json.Marshal(reqData)
 	if err != nil {
-		return "", fmt.Errorf("failed to serialize request data: %w", err)
+		return fmt.Errorf("failed to serialize request data: %w", err)
+	}
+
+	resp, err := c.httpClient().Post(c.BaseURL+path, "application/json", bytes.NewBuffer(jsonData))
+	if err != nil {
+		return fmt.Errorf("failed to connect to Ollama service: %w", err)
 	}
+	defer resp.Body.Close()
+
+	return decodeResponse(resp, respData)
+}
 
-	resp, err := http.Post(c.BaseURL+"/api/generate", "application/json", bytes.NewBuffer(jsonData))
+// get 请求Ollama服务的path接口，并把响应解析到respData中
+func (c *Client) get(path string, respData interface{}) error {
+	resp, err := c.httpClient().Get(c.BaseURL + path)
 	if err != nil {
-		return "", fmt.Errorf("failed to connect to Ollama service: %w", err)
+		return fmt.Errorf("failed to connect to Ollama service: %w", err)
 	}
 	defer resp.Body.Close()
 
+	return decodeResponse(resp, respData)
+}
+
+// httpClient 返回发送请求使用的HTTP客户端
+func (c *Client) httpClient() *http.Client {
+	if c.HTTPClient != nil {
+		return c.HTTPClient
+	}
+	return http.DefaultClient
+}
+
+// decodeResponse 检查Ollama服务的响应状态，并把响应体解析到respData中
+func decodeResponse(resp *http.Response, respData interface{}) error {
 	// 检查HTTP状态码
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
 		var errResp ErrorResponse
 		if err := json.Unmarshal(body, &errResp); err == nil && errResp.Error != "" {
-			return "", fmt.Errorf("ollama service error: %s", errResp.Error)
+			return fmt.Errorf("ollama service error: %s", errResp.Error)
 		}
-		return "", fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
 	}
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return "", fmt.Errorf("failed to read response data: %w", err)
+		return fmt.Errorf("failed to read response data: %w", err)
 	}
 
-	var ollamaResp Response
-	if err := json.Unmarshal(body, &ollamaResp); err != nil {
-		return "", fmt.Errorf("failed to parse response data: %w \n %s", err, body)
+	if err := json.Unmarshal(body, respData); err != nil {
+		return fmt.Errorf("failed to parse response data: %w \n %s", err, body)
 	}
 
-	// 检查是否为无法生成命令的错误标记
-	if ollamaResp.Response == "<err_cannot_generate_command>" {
+	return nil
+}
+
+// checkCommand 检查模型返回的内容是否为无法生成命令的错误标记
+func checkCommand(response string) (string, error) {
+	if response == "<err_cannot_generate_command>" {
 		return "", fmt.Errorf("unable to generate command based on your description, please try to be more specific")
 	}
 
-	return ollamaResp.Response, nil
+	return response, nil
 }
@@ -6,6 +6,8 @@ import (
 	"net/http/httptest"
 	"strings"
 	"testing"
+
+	"github.com/LubyRuffy/aic/pkg/sysinfo"
 )
 
 func TestNewClient(t *testing.T) {
@@ -129,3 +131,139 @@ func TestGenerateNetworkError(t *testing.T) {
 		t.Errorf("Expected network error, got: %v", err)
 	}
 }
+
+func TestChat(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/chat" {
+			t.Errorf("Expected /api/chat path, got %s", r.URL.Path)
+		}
+
+		var req ChatRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Fatalf("Error decoding request body: %v", err)
+		}
+
+		// 系统提示词应当被放在最前面，后面是调用方传入的消息
+		if len(req.Messages) != 3 {
+			t.Fatalf("Expected 3 messages, got %d", len(req.Messages))
+		}
+		if req.Messages[0].Role != RoleSystem {
+			t.Errorf("Expected first message role %s, got %s", RoleSystem, req.Messages[0].Role)
+		}
+		if req.Messages[2].Content != "also sort by size" {
+			t.Errorf("Expected last message to be the follow-up, got %s", req.Messages[2].Content)
+		}
+
+		json.NewEncoder(w).Encode(ChatResponse{Message: Message{Role: RoleAssistant, Content: "ls -lS"}})
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, false)
+	response, err := client.Chat("test-model", []Message{
+		{Role: RoleUser, Content: "list files"},
+		{Role: RoleUser, Content: "also sort by size"},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if response != "ls -lS" {
+		t.Errorf("Expected response ls -lS, got %s", response)
+	}
+}
+
+func TestChatError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "model not found"})
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, false)
+	_, err := client.Chat("test-model", []Message{{Role: RoleUser, Content: "hi"}})
+	if err == nil || !strings.Contains(err.Error(), "ollama service error: model not found") {
+		t.Errorf("Expected model not found error, got %v", err)
+	}
+}
+
+func TestListModels(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" || r.URL.Path != "/api/tags" {
+			t.Errorf("Expected GET /api/tags, got %s %s", r.Method, r.URL.Path)
+		}
+		json.NewEncoder(w).Encode(TagsResponse{Models: []ModelInfo{{Name: "qwen2.5-coder:latest"}, {Name: "llama3:8b"}}})
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, false)
+	models, err := client.ListModels()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(models) != 2 || models[0] != "qwen2.5-coder:latest" || models[1] != "llama3:8b" {
+		t.Errorf("Unexpected models: %v", models)
+	}
+}
+
+func TestGenerateSystemInfo(t *testing.T) {
+	var system string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req Request
+		json.NewDecoder(r.Body).Decode(&req)
+		system = req.System
+		json.NewEncoder(w).Encode(Response{Response: "ls"})
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, false)
+	client.SystemInfo = func() (*sysinfo.SystemInfo, error) {
+		return &sysinfo.SystemInfo{OS: "linux", OSVersion: "Ubuntu 24.04", Shell: "fish", Username: "ops"}, nil
+	}
+	if _, err := client.Generate("test-model", "list files"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for _, want := range []string{"OS: linux Ubuntu 24.04", "Shell Type: fish (not POSIX compatible)", "Username: ops"} {
+		if !strings.Contains(system, want) {
+			t.Errorf("Expected system prompt to contain %q", want)
+		}
+	}
+}
+
+func TestPlanAndAgent(t *testing.T) {
+	var system, format string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/generate":
+			var req Request
+			json.NewDecoder(r.Body).Decode(&req)
+			system, format = req.System, req.Format
+			json.NewEncoder(w).Encode(Response{Response: `{"steps": []}`})
+		case "/api/chat":
+			var req ChatRequest
+			json.NewDecoder(r.Body).Decode(&req)
+			system, format = req.Messages[0].Content, req.Format
+			json.NewEncoder(w).Encode(ChatResponse{Message: Message{Role: RoleAssistant, Content: `{"answer": "nginx"}`}})
+		}
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, false)
+	client.SystemInfo = func() (*sysinfo.SystemInfo, error) {
+		return &sysinfo.SystemInfo{OS: "linux", Shell: "bash"}, nil
+	}
+
+	response, err := client.Plan("test-model", "push a branch")
+	if err != nil || response != `{"steps": []}` {
+		t.Fatalf("Plan() = %q, %v", response, err)
+	}
+	if format != "json" || !strings.Contains(system, `{"steps": [{"command"`) || !strings.Contains(system, "Shell Type: bash") {
+		t.Errorf("Unexpected plan request: format %q, system %s", format, system)
+	}
+
+	response, err = client.Agent("test-model", []Message{{Role: RoleUser, Content: "who owns port 80"}})
+	if err != nil || response != `{"answer": "nginx"}` {
+		t.Fatalf("Agent() = %q, %v", response, err)
+	}
+	if format != "json" || !strings.Contains(system, "read-only commands") || !strings.Contains(system, "OS: linux") {
+		t.Errorf("Unexpected agent request: format %q, system %s", format, system)
+	}
+}
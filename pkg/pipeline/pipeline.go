@@ -0,0 +1,88 @@
+package pipeline
+
+import (
+	"time"
+
+	"github.com/LubyRuffy/aic/pkg/safety"
+)
+
+// Generator 根据用户的描述生成命令，ollama.Client 实现了这个接口
+type Generator interface {
+	Generate(model, prompt string) (string, error)
+}
+
+// Explainer 用自然语言解释命令，ollama.Client 实现了这个接口
+type Explainer interface {
+	Explain(model, command string) (string, error)
+}
+
+// Result 是一次命令生成的结果，CLI的 --output json 等机器可读的输出都使用这个结构
+type Result struct {
+	Prompt      string       `json:"prompt"`
+	Command     string       `json:"command"`
+	Model       string       `json:"model"`
+	Risk        safety.Level `json:"risk"`
+	Explanation string       `json:"explanation"`
+	DurationMs  int64        `json:"duration_ms"`
+	// Cached 为true时命令来自本地缓存，没有调用模型
+	Cached bool `json:"cached,omitempty"`
+	// Injection 是命令疑似受到不可信数据中提示词注入影响的原因，没有发现时为空
+	Injection []string `json:"injection,omitempty"`
+
+	// Report 是完整的安全分析结果
+	Report *safety.Report `json:"-"`
+}
+
+// Generate 调用g生成命令，并对结果进行清理和安全分析
+func Generate(g Generator, model, prompt string) (*Result, error) {
+	start := time.Now()
+	response, err := g.Generate(model, prompt)
+	if err != nil {
+		return nil, err
+	}
+	return NewResult(prompt, model, response, time.Since(start)), nil
+}
+
+// NewResult 清理模型返回的response并进行安全分析
+func NewResult(prompt, model, response string, duration time.Duration) *Result {
+	command := safety.Sanitize(response)
+	report := safety.Analyze(command)
+	return &Result{
+		Prompt:      prompt,
+		Command:     command,
+		Model:       model,
+		Risk:        report.Risk,
+		Explanation: report.Explanation(),
+		DurationMs:  duration.Milliseconds(),
+		Report:      report,
+	}
+}
+
+// Explanation 是对一条命令的解释，包含模型的说明和静态安全分析的结果
+type Explanation struct {
+	Command string `json:"command"`
+	Model   string `json:"model"`
+	// Description 是模型对命令作用的说明
+	Description string       `json:"description"`
+	Risk        safety.Level `json:"risk"`
+	Explanation string       `json:"explanation"`
+	DurationMs  int64        `json:"duration_ms"`
+}
+
+// Explain 调用e解释命令，并附上安全分析的结果
+func Explain(e Explainer, model, command string) (*Explanation, error) {
+	start := time.Now()
+	description, err := e.Explain(model, command)
+	if err != nil {
+		return nil, err
+	}
+	report := safety.Analyze(command)
+	return &Explanation{
+		Command:     command,
+		Model:       model,
+		Description: description,
+		Risk:        report.Risk,
+		Explanation: report.Explanation(),
+		DurationMs:  time.Since(start).Milliseconds(),
+	}, nil
+}
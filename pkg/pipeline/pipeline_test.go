@@ -0,0 +1,69 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/LubyRuffy/aic/pkg/safety"
+)
+
+type fakeGenerator struct {
+	response string
+	err      error
+}
+
+func (g fakeGenerator) Generate(_, _ string) (string, error) {
+	return g.response, g.err
+}
+
+func TestGenerate(t *testing.T) {
+	result, err := Generate(fakeGenerator{response: "```bash\nrm -rf ./build\n```"}, "test-model", "clean the build")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if result.Command != "rm -rf ./build" {
+		t.Errorf("Expected sanitized command, got %q", result.Command)
+	}
+	if result.Risk != safety.RiskMedium || !strings.Contains(result.Explanation, "deletes files recursively") {
+		t.Errorf("Unexpected analysis: %s %s", result.Risk, result.Explanation)
+	}
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{`"prompt":"clean the build"`, `"command":`, `"model":"test-model"`, `"risk":"medium"`, `"explanation":`, `"duration_ms":`} {
+		if !strings.Contains(string(data), key) {
+			t.Errorf("Expected JSON to contain %s, got %s", key, data)
+		}
+	}
+
+	if _, err := Generate(fakeGenerator{err: errors.New("boom")}, "m", "p"); err == nil {
+		t.Error("Expected error, got nil")
+	}
+}
+
+type fakeExplainer struct {
+	description string
+	err         error
+}
+
+func (e fakeExplainer) Explain(_, _ string) (string, error) {
+	return e.description, e.err
+}
+
+func TestExplain(t *testing.T) {
+	e, err := Explain(fakeExplainer{description: "Deletes the build directory."}, "test-model", "rm -rf ./build")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if e.Command != "rm -rf ./build" || e.Description != "Deletes the build directory." || e.Risk != safety.RiskMedium {
+		t.Errorf("Unexpected explanation: %+v", e)
+	}
+
+	if _, err := Explain(fakeExplainer{err: errors.New("offline")}, "test-model", "ls"); err == nil {
+		t.Error("Expected error")
+	}
+}
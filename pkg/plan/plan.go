@@ -0,0 +1,94 @@
+package plan
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/LubyRuffy/aic/pkg/injection"
+	"github.com/LubyRuffy/aic/pkg/safety"
+)
+
+// Step 是计划中的一个步骤
+type Step struct {
+	Command     string       `json:"command"`
+	Rationale   string       `json:"rationale"`
+	Risk        safety.Level `json:"risk"`
+	Explanation string       `json:"explanation"`
+	// Injection 是步骤疑似受到不可信数据中提示词注入影响的原因，没有发现时为空
+	Injection []string `json:"injection,omitempty"`
+
+	// Report 是命令的完整安全分析结果
+	Report *safety.Report `json:"-"`
+}
+
+// Plan 是模型为一个任务生成的有序步骤列表，--output json 使用这个结构
+type Plan struct {
+	Prompt     string  `json:"prompt"`
+	Model      string  `json:"model"`
+	Steps      []*Step `json:"steps"`
+	DurationMs int64   `json:"duration_ms"`
+}
+
+// ErrEmptyPlan 表示模型无法把任务拆分为命令
+var ErrEmptyPlan = errors.New("unable to plan commands for your description, please try to be more specific")
+
+// Parse 解析模型返回的JSON步骤列表，并对每个命令进行清理和安全分析
+func Parse(response string) ([]*Step, error) {
+	// 去掉模型可能添加的markdown代码块或说明文字
+	start := strings.Index(response, "{")
+	end := strings.LastIndex(response, "}")
+	if start < 0 || end < start {
+		return nil, fmt.Errorf("failed to parse plan: no JSON object in response %q", response)
+	}
+
+	var parsed struct {
+		Steps []*Step `json:"steps"`
+	}
+	if err := json.Unmarshal([]byte(response[start:end+1]), &parsed); err != nil {
+		return nil, fmt.Errorf("failed to parse plan: %v", err)
+	}
+
+	steps := make([]*Step, 0, len(parsed.Steps))
+	for _, s := range parsed.Steps {
+		if s == nil {
+			continue
+		}
+		command := safety.Sanitize(s.Command)
+		if command == "" {
+			continue
+		}
+		steps = append(steps, NewStep(command, strings.TrimSpace(s.Rationale)))
+	}
+	if len(steps) == 0 {
+		return nil, ErrEmptyPlan
+	}
+	return steps, nil
+}
+
+// NewStep 创建一个经过安全分析的步骤
+func NewStep(command, rationale string) *Step {
+	report := safety.Analyze(command)
+	return &Step{
+		Command:     command,
+		Rationale:   rationale,
+		Risk:        report.Risk,
+		Explanation: report.Explanation(),
+		Report:      report,
+	}
+}
+
+// FixPrompt 生成请求模型修复失败步骤的提示词，模型应当返回一条替换的命令
+func FixPrompt(task string, step *Step, exitCode int, output string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "While working on the task %q, this step failed with exit code %d:\n%s\n\n", task, exitCode, step.Command)
+	if step.Rationale != "" {
+		fmt.Fprintf(&b, "The step was meant to: %s\n\n", step.Rationale)
+	}
+	if output = strings.TrimRight(output, "\n"); output != "" {
+		fmt.Fprintf(&b, "Its output (possibly truncated) was:\n%s\n\n", injection.Wrap("command output", output))
+	}
+	b.WriteString("Provide a single corrected command that achieves the step.")
+	return b.String()
+}
@@ -0,0 +1,55 @@
+package plan
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/LubyRuffy/aic/pkg/safety"
+)
+
+func TestParse(t *testing.T) {
+	response := "```json\n" + `{"steps": [
+		{"command": "git checkout -b fix", "rationale": " Create the branch. "},
+		{"command": "", "rationale": "empty commands are dropped"},
+		{"command": "` + "`git push -u origin fix`" + `", "rationale": "Push it."},
+		{"command": "rm -rf /", "rationale": "Oops."}
+	]}` + "\n```"
+
+	steps, err := Parse(response)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if len(steps) != 3 {
+		t.Fatalf("Parse() returned %d steps, want 3", len(steps))
+	}
+	if steps[0].Command != "git checkout -b fix" || steps[0].Rationale != "Create the branch." {
+		t.Errorf("Unexpected first step: %+v", steps[0])
+	}
+	if steps[1].Command != "git push -u origin fix" {
+		t.Errorf("Expected sanitised command, got %q", steps[1].Command)
+	}
+	if steps[2].Risk != safety.RiskHigh {
+		t.Errorf("Expected high risk for the last step, got %s", steps[2].Risk)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	if _, err := Parse(`{"steps": []}`); !errors.Is(err, ErrEmptyPlan) {
+		t.Errorf("Parse() of empty plan error = %v, want ErrEmptyPlan", err)
+	}
+	for _, response := range []string{"git status", `{"steps": "git status"}`} {
+		if _, err := Parse(response); err == nil || errors.Is(err, ErrEmptyPlan) {
+			t.Errorf("Parse(%q) error = %v, want parse error", response, err)
+		}
+	}
+}
+
+func TestFixPrompt(t *testing.T) {
+	prompt := FixPrompt("push the branch", NewStep("git push", "Push it."), 128, "fatal: no upstream\n")
+	for _, want := range []string{`"push the branch"`, "exit code 128", "git push", "Push it.", "fatal: no upstream\n</untrusted-data"} {
+		if !strings.Contains(prompt, want) {
+			t.Errorf("FixPrompt() = %q, missing %q", prompt, want)
+		}
+	}
+}
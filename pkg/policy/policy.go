@@ -0,0 +1,462 @@
+package policy
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/LubyRuffy/aic/pkg/safety"
+	"gopkg.in/yaml.v3"
+)
+
+// 规则的动作
+const (
+	ActionAllow   = "allow"
+	ActionConfirm = "confirm"
+	ActionDeny    = "deny"
+)
+
+// DefaultPath 返回整台机器的策略文件路径，Windows上位于 %ProgramData%\aic 下
+func DefaultPath() string {
+	if runtime.GOOS == "windows" {
+		dir := os.Getenv("ProgramData")
+		if dir == "" {
+			dir = `C:\ProgramData`
+		}
+		return filepath.Join(dir, "aic", "policy.yaml")
+	}
+	return "/etc/aic/policy.yaml"
+}
+
+// Patterns 是一组 path.Match 格式的模式，YAML中可以写成单个字符串或列表
+type Patterns []string
+
+// UnmarshalYAML 同时接受字符串和字符串列表
+func (p *Patterns) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		*p = Patterns{value.Value}
+		return nil
+	}
+	var list []string
+	if err := value.Decode(&list); err != nil {
+		return err
+	}
+	*p = list
+	return nil
+}
+
+// match 判断candidates中是否有任意一个匹配任意一个模式
+func (p Patterns) match(candidates []string) bool {
+	for _, pattern := range p {
+		for _, c := range candidates {
+			if ok, _ := path.Match(pattern, c); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// matchPaths 和 match 相同，但路径中含有通配符时，只要通配符可能展开为匹配模式的路径就算匹配，
+// 避免用 /et?/passwd 这样的写法绕过 /etc 的规则
+func (p Patterns) matchPaths(candidates []string) bool {
+	if p.match(candidates) {
+		return true
+	}
+	for _, pattern := range p {
+		for _, c := range candidates {
+			if strings.ContainsAny(c, globChars) && globsOverlap(pattern, c) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// globChars 是shell展开路径时使用的字符，包括花括号展开
+const globChars = "*?[{"
+
+// globsOverlap 逐段比较两个可能含有通配符的路径，判断是否可能匹配同一个路径
+// 两段都含有通配符时无法精确判断，按可能匹配处理
+func globsOverlap(a, b string) bool {
+	as, bs := strings.Split(a, "/"), strings.Split(b, "/")
+	if len(as) != len(bs) {
+		return false
+	}
+	for i := range as {
+		x, y := as[i], bs[i]
+		if strings.ContainsAny(x, globChars) && strings.ContainsAny(y, globChars) {
+			continue
+		}
+		if ok, _ := path.Match(x, y); ok {
+			continue
+		}
+		if ok, _ := path.Match(y, x); ok {
+			continue
+		}
+		if strings.Contains(y, "{") || strings.Contains(x, "{") {
+			continue
+		}
+		return false
+	}
+	return true
+}
+
+// Rule 是一条策略规则，设置的所有条件都满足时命中，同一条件中的多个模式满足一个即可
+type Rule struct {
+	Name string `yaml:"name"`
+	// Action 是命中时的动作：deny 或 confirm
+	Action string `yaml:"action"`
+	// Message 是命中时告诉用户的原因
+	Message string `yaml:"message"`
+
+	// Binary 匹配程序名称，包括sudo等包装程序
+	Binary Patterns `yaml:"binary"`
+	// Subcommand 匹配子命令，即第一个不是选项的参数
+	Subcommand Patterns `yaml:"subcommand"`
+	// Flags 匹配选项，--context prod 和 --context=prod 都可以用 --context=prod 匹配，-rf 可以用 -f 匹配
+	Flags Patterns `yaml:"flags"`
+	// Args 匹配任意参数
+	Args Patterns `yaml:"args"`
+	// Paths 匹配参数和重定向中的路径，相对路径基于工作目录，匹配目录时也匹配其中的所有文件
+	Paths Patterns `yaml:"paths"`
+}
+
+// Policy 是整台机器的命令策略，用户配置无法覆盖
+type Policy struct {
+	// Path 是策略文件的路径，用于提示用户
+	Path  string `yaml:"-"`
+	Rules []Rule `yaml:"rules"`
+	Audit Audit  `yaml:"audit"`
+}
+
+// Audit 是整台机器的审计日志设置，覆盖用户的配置和 -audit-log
+type Audit struct {
+	// Required 为true时总是记录审计日志，用户配置中的 disabled 无效
+	Required bool `yaml:"required"`
+	// Path 是文件审计日志的路径
+	Path string `yaml:"path"`
+	// Sink 是审计日志的输出方式：file 或 syslog
+	Sink string `yaml:"sink"`
+}
+
+// Load 读取path中的策略，文件不存在时返回nil
+func Load(path string) (*Policy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error reading policy: %v", err)
+	}
+	p, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing policy %s: %v", path, err)
+	}
+	p.Path = path
+	return p, nil
+}
+
+// Parse 解析YAML或JSON格式的策略，未知的字段和无效的规则都是错误，避免拼写错误导致策略没有生效
+func Parse(data []byte) (*Policy, error) {
+	var p Policy
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&p); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	for i, r := range p.Rules {
+		if err := r.validate(); err != nil {
+			return nil, fmt.Errorf("rule %d (%s): %v", i+1, r.Name, err)
+		}
+	}
+	switch p.Audit.Sink {
+	case "", "file", "syslog":
+	default:
+		return nil, fmt.Errorf("audit: unsupported sink %q, use file or syslog", p.Audit.Sink)
+	}
+	return &p, nil
+}
+
+func (r *Rule) validate() error {
+	if r.Action != ActionDeny && r.Action != ActionConfirm {
+		return fmt.Errorf("unsupported action %q, use deny or confirm", r.Action)
+	}
+	all := [][]string{r.Binary, r.Subcommand, r.Flags, r.Args, r.Paths}
+	empty := true
+	for _, patterns := range all {
+		for _, pattern := range patterns {
+			empty = false
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("invalid pattern %q", pattern)
+			}
+		}
+	}
+	if empty {
+		return errors.New("at least one of binary, subcommand, flags, args or paths is required")
+	}
+	return nil
+}
+
+// Decision 是策略对一条命令的结果
+type Decision struct {
+	Action string
+	// Rule 是命中的规则，允许时为nil
+	Rule *Rule
+	// Command 是命中规则的简单命令
+	Command string
+	// Path 是策略文件的路径
+	Path string
+}
+
+// Allowed 判断命令是否不受限制
+func (d Decision) Allowed() bool {
+	return d.Action == ActionAllow
+}
+
+// String 返回告诉用户的说明，包含规则名称、原因和策略文件
+func (d Decision) String() string {
+	if d.Rule == nil {
+		return "allowed by policy"
+	}
+	verb := "denied"
+	if d.Action == ActionConfirm {
+		verb = "requires confirmation"
+	}
+	s := verb + " by policy rule"
+	if d.Rule.Name != "" {
+		s += fmt.Sprintf(" %q", d.Rule.Name)
+	}
+	if d.Path != "" {
+		s += " in " + d.Path
+	}
+	if d.Rule.Message != "" {
+		s += ": " + d.Rule.Message
+	}
+	if d.Command != "" {
+		s += fmt.Sprintf(" (matched %q)", d.Command)
+	}
+	return s
+}
+
+// unknownProgram 是无法确定实际执行的程序时使用的规则，策略无法判断这样的命令，需要确认后才能执行
+var unknownProgram = Rule{Name: "unknown-program", Action: ActionConfirm, Message: "the program run through the wrapper cannot be determined"}
+
+// unresolved 是只有执行时才能确定的参数或路径可能命中规则时使用的规则，比如变量、命令替换和 cd 到无法确定的目录之后的相对路径
+var unresolved = Rule{Name: "unresolved-argument", Action: ActionConfirm, Message: "an argument or path depends on variables, substitutions or an earlier cd the policy cannot resolve"}
+
+// unknownDir 是 cd 到无法确定的目录之后的工作目录，相对路径基于它解析后也无法确定
+const unknownDir = "$PWD"
+
+// Check 检查command中的每一条简单命令，dir是执行命令的工作目录，用于解析相对路径，命令中的 cd 和 pushd 会改变工作目录
+// 命中任意deny规则时拒绝，否则命中confirm规则、无法确定实际执行的程序或者无法确定的参数可能命中规则时需要确认，说明中使用第一条命中的规则
+func (p *Policy) Check(command, dir string) Decision {
+	decision := Decision{Action: ActionAllow}
+	if p == nil {
+		return decision
+	}
+	home, _ := os.UserHomeDir()
+	for _, c := range safety.Parse(command) {
+		if c.Program() == safety.UnknownProgram && decision.Rule == nil {
+			decision = Decision{Action: ActionConfirm, Rule: &unknownProgram, Command: strings.Join(c.Args, " "), Path: p.Path}
+		}
+		f := newFacts(c, dir, home)
+		for i := range p.Rules {
+			r := &p.Rules[i]
+			matched, exact := r.matches(f)
+			if !matched {
+				continue
+			}
+			if !exact {
+				// 规则可能命中，无法确定时不拒绝也不放行，而是需要确认
+				r = &unresolved
+			}
+			if r.Action == ActionDeny {
+				return Decision{Action: ActionDeny, Rule: r, Command: strings.Join(c.Args, " "), Path: p.Path}
+			}
+			if decision.Rule == nil {
+				decision = Decision{Action: ActionConfirm, Rule: r, Command: strings.Join(c.Args, " "), Path: p.Path}
+			}
+		}
+		dir = chdir(c, dir, home)
+	}
+	return decision
+}
+
+// matches 判断规则是否命中，只是因为参数无法确定而可能命中时exact为false
+func (r *Rule) matches(f *facts) (matched, exact bool) {
+	conditions := []struct {
+		patterns   Patterns
+		candidates []string
+		paths      bool
+	}{
+		{r.Binary, f.binaries, false},
+		{r.Subcommand, f.subcommands, false},
+		{r.Flags, f.flags, false},
+		{r.Args, f.args, false},
+		{r.Paths, f.paths, true},
+	}
+	exact = true
+	for _, c := range conditions {
+		if len(c.patterns) == 0 {
+			continue
+		}
+		if c.paths && c.patterns.matchPaths(c.candidates) || !c.paths && c.patterns.match(c.candidates) {
+			continue
+		}
+		if !dynamic(c.candidates) {
+			return false, false
+		}
+		exact = false
+	}
+	return true, exact
+}
+
+// dynamic 判断是否有只有执行时才能确定的候选值，它们可能匹配任意模式
+func dynamic(candidates []string) bool {
+	for _, c := range candidates {
+		if safety.Dynamic(c) {
+			return true
+		}
+	}
+	return false
+}
+
+// chdir 返回执行c之后的工作目录，cd 和 pushd 的目标无法确定或者执行了 popd 时返回 unknownDir
+func chdir(c safety.SimpleCommand, dir, home string) string {
+	args := c.ProgramArgs()
+	switch c.Program() {
+	case "cd", "pushd", "chdir", "set-location", "sl":
+	case "popd", "pop-location":
+		return unknownDir
+	default:
+		return dir
+	}
+	var targets []string
+	for _, a := range args[1:] {
+		if a == "-" || !strings.HasPrefix(a, "-") {
+			targets = append(targets, a)
+		}
+	}
+	switch {
+	case len(targets) == 0 && home != "":
+		return filepath.ToSlash(home)
+	case len(targets) == 0 || targets[0] == "-" || strings.HasPrefix(targets[0], "+") || safety.Dynamic(targets[0]):
+		return unknownDir
+	}
+	return resolve(targets[0], dir, home)
+}
+
+// facts 是从一条简单命令中提取的用于匹配的信息
+type facts struct {
+	binaries    []string
+	subcommands []string
+	flags       []string
+	args        []string
+	paths       []string
+}
+
+func newFacts(c safety.SimpleCommand, dir, home string) *facts {
+	f := &facts{binaries: append(c.Wrappers(), c.Program())}
+	args := c.ProgramArgs()
+	if len(args) > 0 {
+		args = args[1:]
+	}
+	f.args = args
+	// 变量和命令替换可能展开为选项
+	for _, a := range args {
+		if safety.Dynamic(a) {
+			f.flags = append(f.flags, a)
+		}
+	}
+
+	// 子命令是第一个不是选项的参数，前一个参数是可能带值的选项时，下一个参数也可能是子命令
+	afterFlag := false
+	for _, a := range args {
+		if strings.HasPrefix(a, "-") && a != "-" {
+			afterFlag = !strings.Contains(a, "=")
+			continue
+		}
+		f.subcommands = append(f.subcommands, a)
+		if !afterFlag {
+			break
+		}
+		afterFlag = false
+	}
+
+	operands := false
+	for i, a := range args {
+		switch {
+		case operands || !strings.HasPrefix(a, "-") || a == "-":
+			f.paths = append(f.paths, resolve(a, dir, home))
+		case a == "--":
+			operands = true
+		case strings.HasPrefix(a, "--"):
+			f.flags = append(f.flags, a)
+			if name, value, ok := strings.Cut(a, "="); ok {
+				f.flags = append(f.flags, name)
+				f.paths = append(f.paths, resolve(value, dir, home))
+			} else if i+1 < len(args) && !strings.HasPrefix(args[i+1], "-") {
+				f.flags = append(f.flags, a+"="+args[i+1])
+			}
+		default:
+			f.flags = append(f.flags, a)
+			for _, r := range a[1:] {
+				f.flags = append(f.flags, "-"+string(r))
+			}
+			if len(a) == 2 && i+1 < len(args) && !strings.HasPrefix(args[i+1], "-") {
+				f.flags = append(f.flags, a+"="+args[i+1])
+			}
+		}
+	}
+	for _, redirect := range c.Redirects {
+		if !strings.HasPrefix(redirect.Target, "&") {
+			f.paths = append(f.paths, resolve(redirect.Target, dir, home))
+		}
+	}
+	f.paths = withParents(f.paths)
+	return f
+}
+
+// resolve 把参数解析为使用/分隔的绝对路径，工作目录无法确定时相对路径也无法确定
+func resolve(p, dir, home string) string {
+	p = filepath.ToSlash(p)
+	switch {
+	case p == "~" || strings.HasPrefix(p, "~/"):
+		if home != "" {
+			p = filepath.ToSlash(home) + p[1:]
+		}
+	case !path.IsAbs(p) && !filepath.IsAbs(p) && dir == unknownDir:
+		// 不能规范化，否则 $PWD/../etc 会变成 etc
+		return unknownDir + "/" + p
+	case !path.IsAbs(p) && !filepath.IsAbs(p) && dir != "":
+		p = filepath.ToSlash(dir) + "/" + p
+	}
+	return path.Clean(p)
+}
+
+// withParents 加入所有路径的上级目录，使 /etc 这样的模式也能匹配其中的文件
+func withParents(paths []string) []string {
+	seen := make(map[string]bool)
+	var result []string
+	for _, p := range paths {
+		for {
+			if !seen[p] {
+				seen[p] = true
+				result = append(result, p)
+			}
+			parent := path.Dir(p)
+			if parent == p || parent == "." {
+				break
+			}
+			p = parent
+		}
+	}
+	return result
+}
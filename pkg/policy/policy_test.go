@@ -0,0 +1,163 @@
+package policy
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testPolicy = `
+rules:
+  - name: no-prod-delete
+    action: deny
+    binary: kubectl
+    subcommand: delete
+    flags: ["--context=prod*"]
+    message: deleting resources in production is not allowed
+  - name: protect-etc
+    action: deny
+    binary: [rm, mv, cp, sed, tee, chmod, chown]
+    paths: /etc
+  - name: no-sudo
+    action: deny
+    binary: sudo
+  - name: force-push
+    action: confirm
+    binary: git
+    subcommand: push
+    flags: [-f, --force]
+  - name: terraform
+    action: confirm
+    binary: terraform
+    subcommand: [apply, destroy]
+`
+
+func TestCheck(t *testing.T) {
+	p, err := Parse([]byte(testPolicy))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Path = "/etc/aic/policy.yaml"
+
+	tests := []struct {
+		command string
+		action  string
+		rule    string
+	}{
+		{"kubectl --context prod-eu delete pod web", ActionDeny, "no-prod-delete"},
+		{"kubectl delete pod web --context=prod", ActionDeny, "no-prod-delete"},
+		{"kubectl --context staging delete pod web", ActionAllow, ""},
+		{"kubectl --context prod get pods", ActionAllow, ""},
+		{"rm -f /etc/hosts", ActionDeny, "protect-etc"},
+		{"sed -i 's/a/b/' ../../etc/nginx/nginx.conf", ActionDeny, "protect-etc"},
+		{"echo 1 | tee /etc/sysctl.d/99.conf >/dev/null", ActionDeny, "protect-etc"},
+		{"cat /etc/hosts", ActionAllow, ""},
+		{"rm -rf ./etc", ActionAllow, ""},
+		{"sudo systemctl restart nginx", ActionDeny, "no-sudo"},
+		{"git push -f origin main", ActionConfirm, "force-push"},
+		{"git push origin main", ActionAllow, ""},
+		{"cd infra && terraform apply && git push --force", ActionConfirm, "terraform"},
+		{"terraform plan; sh -c 'sudo reboot'", ActionDeny, "no-sudo"},
+		{"nice -n 10 kubectl --context prod delete ns prod", ActionDeny, "no-prod-delete"},
+		{"timeout -s KILL 5 kubectl --context=prod delete ns prod", ActionDeny, "no-prod-delete"},
+		{"bash -lc 'kubectl --context prod delete ns prod'", ActionDeny, "no-prod-delete"},
+		{"rm /et?/passwd", ActionDeny, "protect-etc"},
+		{"rm -rf /e*", ActionDeny, "protect-etc"},
+		{"cp x /e{t,x}c/hosts", ActionDeny, "protect-etc"},
+		{"rm ./*.log", ActionAllow, ""},
+		{"rm /var/*/x", ActionAllow, ""},
+		{"nice --bogus kubectl delete ns prod", ActionConfirm, "unknown-program"},
+		{"(rm /etc/hosts)", ActionDeny, "protect-etc"},
+		{"{ rm /etc/hosts; }", ActionDeny, "protect-etc"},
+		{"if true; then rm /etc/hosts; fi", ActionDeny, "protect-etc"},
+		{"for f in a; do rm /etc/hosts; done", ActionDeny, "protect-etc"},
+		{`eval "rm /etc/hosts"`, ActionDeny, "protect-etc"},
+		{`su -c "rm /etc/hosts"`, ActionDeny, "protect-etc"},
+		{"busybox rm /etc/hosts", ActionDeny, "protect-etc"},
+		{"cat <(rm /etc/hosts)", ActionDeny, "protect-etc"},
+		{"cd /etc && rm hosts", ActionDeny, "protect-etc"},
+		{"cd /tmp; pushd ../etc && rm hosts", ActionDeny, "protect-etc"},
+		{"cd /tmp && rm -rf build", ActionAllow, ""},
+		{"rm $(echo /etc)/hosts", ActionConfirm, "unresolved-argument"},
+		{"rm $DIR/hosts", ActionConfirm, "unresolved-argument"},
+		{"cd $DIR && rm hosts", ActionConfirm, "unresolved-argument"},
+		{"cd - && rm hosts", ActionConfirm, "unresolved-argument"},
+		{"popd && rm ../etc/hosts", ActionConfirm, "unresolved-argument"},
+		{"cd $DIR && rm /var/tmp/x", ActionAllow, ""},
+		{"git push $FLAGS origin main", ActionConfirm, "unresolved-argument"},
+		{"echo $HOME", ActionAllow, ""},
+		{"$(echo rm) /etc/hosts", ActionConfirm, "unknown-program"},
+	}
+	for _, tt := range tests {
+		d := p.Check(tt.command, "/srv/app")
+		name := ""
+		if d.Rule != nil {
+			name = d.Rule.Name
+		}
+		if d.Action != tt.action || name != tt.rule {
+			t.Errorf("Check(%q) = %s %q, want %s %q", tt.command, d.Action, name, tt.action, tt.rule)
+		}
+	}
+
+	d := p.Check("kubectl --context prod delete ns web", "/srv/app")
+	want := `denied by policy rule "no-prod-delete" in /etc/aic/policy.yaml: deleting resources in production is not allowed (matched "kubectl --context prod delete ns web")`
+	if d.String() != want {
+		t.Errorf("Unexpected message:\n%s\nwant:\n%s", d, want)
+	}
+
+	var none *Policy
+	if d := none.Check("rm -rf /", "/"); !d.Allowed() {
+		t.Errorf("Expected no policy to allow everything, got %v", d)
+	}
+}
+
+func TestParse(t *testing.T) {
+	// JSON is valid YAML
+	p, err := Parse([]byte(`{"rules": [{"action": "deny", "binary": "dd"}]}`))
+	if err != nil || len(p.Rules) != 1 || p.Rules[0].Binary[0] != "dd" {
+		t.Errorf("Unexpected policy %+v, %v", p, err)
+	}
+	if p, err := Parse(nil); err != nil || len(p.Rules) != 0 {
+		t.Errorf("Expected an empty policy, got %+v, %v", p, err)
+	}
+	p, err = Parse([]byte("audit:\n  required: true\n  path: /var/log/aic/audit.jsonl\n"))
+	if err != nil || !p.Audit.Required || p.Audit.Path != "/var/log/aic/audit.jsonl" {
+		t.Errorf("Unexpected audit settings %+v, %v", p, err)
+	}
+
+	for _, data := range []string{
+		"rules:\n  - action: deny\n    binaries: rm\n",
+		"rules:\n  - action: block\n    binary: rm\n",
+		"rules:\n  - action: deny\n",
+		"rules:\n  - action: deny\n    binary: '[rm'\n",
+		"audit:\n  sink: database\n",
+	} {
+		if _, err := Parse([]byte(data)); err == nil {
+			t.Errorf("Parse(%q) expected an error", data)
+		}
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	if p, err := Load(filepath.Join(dir, "missing.yaml")); p != nil || err != nil {
+		t.Errorf("Expected no policy, got %+v, %v", p, err)
+	}
+
+	path := filepath.Join(dir, "policy.yaml")
+	if err := os.WriteFile(path, []byte("rules: [{action: deny, binary: [rm]}]\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	p, err := Load(path)
+	if err != nil || p.Path != path || len(p.Rules) != 1 {
+		t.Errorf("Unexpected policy %+v, %v", p, err)
+	}
+
+	if err := os.WriteFile(path, []byte("rules: {"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(path); err == nil || !strings.Contains(err.Error(), path) {
+		t.Errorf("Expected a parse error naming the file, got %v", err)
+	}
+}
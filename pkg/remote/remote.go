@@ -0,0 +1,338 @@
+package remote
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/signal"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/LubyRuffy/aic/pkg/executor"
+	"github.com/LubyRuffy/aic/pkg/shell"
+	"github.com/LubyRuffy/aic/pkg/sysinfo"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+	"golang.org/x/term"
+)
+
+// DefaultPort 是SSH的默认端口
+const DefaultPort = "22"
+
+// dialTimeout 是建立SSH连接的默认超时时间
+const dialTimeout = 10 * time.Second
+
+// killDelay 是超时后等待远程命令结束的最长时间，服务端不响应时直接返回
+const killDelay = 2 * time.Second
+
+// Config 是SSH连接的配置
+type Config struct {
+	// User 是登录的用户名，目标中没有指定用户时使用
+	User string
+	// Auth 是依次尝试的认证方式
+	Auth []ssh.AuthMethod
+	// HostKeyCallback 校验服务端的主机密钥
+	HostKeyCallback ssh.HostKeyCallback
+	// Timeout 是建立连接的超时时间，为0时使用默认值
+	Timeout time.Duration
+}
+
+// DefaultConfig 返回与ssh命令行一致的默认配置：
+// 使用当前用户名，通过ssh-agent和 ~/.ssh 下未加密的私钥认证，并用 ~/.ssh/known_hosts 校验主机密钥
+func DefaultConfig() (*Config, error) {
+	cfg := &Config{}
+	if u, err := user.Current(); err == nil {
+		cfg.User = u.Username
+	}
+
+	if sock := os.Getenv("SSH_AUTH_SOCK"); sock != "" {
+		if conn, err := net.Dial("unix", sock); err == nil {
+			cfg.Auth = append(cfg.Auth, ssh.PublicKeysCallback(agent.NewClient(conn).Signers))
+		}
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil, fmt.Errorf("error getting home directory: %v", err)
+	}
+	// 有密码的私钥只能通过ssh-agent使用
+	var signers []ssh.Signer
+	for _, name := range []string{"id_ed25519", "id_ecdsa", "id_rsa"} {
+		data, err := os.ReadFile(filepath.Join(home, ".ssh", name))
+		if err != nil {
+			continue
+		}
+		if signer, err := ssh.ParsePrivateKey(data); err == nil {
+			signers = append(signers, signer)
+		}
+	}
+	if len(signers) > 0 {
+		cfg.Auth = append(cfg.Auth, ssh.PublicKeys(signers...))
+	}
+
+	knownHosts := filepath.Join(home, ".ssh", "known_hosts")
+	cfg.HostKeyCallback, err = knownhosts.New(knownHosts)
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s, connect to the host with ssh once to add its key: %v", knownHosts, err)
+	}
+	return cfg, nil
+}
+
+// ParseTarget 解析 [user@]host[:port] 格式的目标，返回用户名和连接地址
+func ParseTarget(target string) (username, addr string, err error) {
+	host := target
+	if i := strings.LastIndex(host, "@"); i >= 0 {
+		username, host = host[:i], host[i+1:]
+	}
+
+	port := DefaultPort
+	// 只有一个冒号或者使用方括号时才包含端口，否则是不带端口的IPv6地址
+	if strings.HasPrefix(host, "[") || strings.Count(host, ":") == 1 {
+		h, p, err := net.SplitHostPort(host)
+		if err != nil {
+			return "", "", fmt.Errorf("invalid host %q: %v", target, err)
+		}
+		host, port = h, p
+	}
+	if host == "" || port == "" {
+		return "", "", fmt.Errorf("invalid host %q: missing host name or port", target)
+	}
+	return username, net.JoinHostPort(host, port), nil
+}
+
+// Client 是到远程主机的SSH连接，生成命令时收集系统信息和执行命令使用同一个连接
+type Client struct {
+	// Target 是连接的目标，也是告诉模型的主机名
+	Target string
+
+	conn *ssh.Client
+	info *sysinfo.SystemInfo
+}
+
+// Dial 使用cfg连接到target
+func Dial(target string, cfg *Config) (*Client, error) {
+	username, addr, err := ParseTarget(target)
+	if err != nil {
+		return nil, err
+	}
+	if username == "" {
+		username = cfg.User
+	}
+	timeout := cfg.Timeout
+	if timeout == 0 {
+		timeout = dialTimeout
+	}
+
+	conn, err := ssh.Dial("tcp", addr, &ssh.ClientConfig{
+		User:            username,
+		Auth:            cfg.Auth,
+		HostKeyCallback: cfg.HostKeyCallback,
+		Timeout:         timeout,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to %s: %v", target, err)
+	}
+	return &Client{Target: target, conn: conn}, nil
+}
+
+// Close 关闭连接
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// SystemInfo 在远程主机上执行 sysinfo.ProbeScript 收集系统信息，结果会被缓存
+func (c *Client) SystemInfo() (*sysinfo.SystemInfo, error) {
+	if c.info != nil {
+		return c.info, nil
+	}
+
+	sess, err := c.conn.NewSession()
+	if err != nil {
+		return nil, fmt.Errorf("error opening SSH session: %v", err)
+	}
+	defer sess.Close()
+
+	// 脚本通过标准输入传给 sh，与远程用户的登录shell无关
+	sess.Stdin = strings.NewReader(sysinfo.ProbeScript)
+	out, err := sess.Output("sh -s")
+	if err != nil {
+		return nil, fmt.Errorf("error collecting system information from %s: %v", c.Target, err)
+	}
+	info := sysinfo.ParseProbe(string(out))
+	if info.OS == "" {
+		return nil, fmt.Errorf("error collecting system information from %s: unsupported system", c.Target)
+	}
+	info.Host = c.Target
+	c.info = info
+	return info, nil
+}
+
+// Shell 返回远程用户的登录shell，无法识别时使用sh，用于按远程shell的规则给参数加引号
+func (c *Client) Shell() (shell.Shell, error) {
+	info, err := c.SystemInfo()
+	if err != nil {
+		return shell.Shell{}, err
+	}
+	s, ok := shell.Lookup(info.Shell)
+	if !ok {
+		s, _ = shell.Lookup("sh")
+	}
+	// 使用远程主机PATH中的shell，而不是本机的路径
+	s.Path = ""
+	return s, nil
+}
+
+// Executor 在远程主机上执行命令，命令由远程用户的登录shell解释
+type Executor struct {
+	Client *Client
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+	// Timeout 是命令的最长执行时间，超时后向远程命令发送SIGKILL并关闭会话，为0时不限制
+	Timeout time.Duration
+	// ForwardSignals 表示是否把收到的SIGINT/SIGTERM转发给远程命令
+	ForwardSignals bool
+	// CaptureLimit 是每个输出流最多捕获的字节数，为0时不捕获
+	CaptureLimit int
+}
+
+// NewExecutor 创建使用标准输入输出的远程执行器
+func (c *Client) NewExecutor() *Executor {
+	return &Executor{
+		Client:         c,
+		Stdin:          os.Stdin,
+		Stdout:         os.Stdout,
+		Stderr:         os.Stderr,
+		ForwardSignals: true,
+	}
+}
+
+// Execute 在远程主机上执行命令
+// 命令以非零状态退出时返回 *executor.ExitError，同时返回执行结果
+func (e *Executor) Execute(command string) (*executor.ExecResult, error) {
+	sess, err := e.Client.conn.NewSession()
+	if err != nil {
+		return nil, fmt.Errorf("error opening SSH session: %v", err)
+	}
+	defer sess.Close()
+
+	var stdout, stderr *executor.HeadTailBuffer
+	sess.Stdout, sess.Stderr = e.Stdout, e.Stderr
+	if e.CaptureLimit > 0 {
+		stdout = executor.NewHeadTailBuffer(e.CaptureLimit)
+		stderr = executor.NewHeadTailBuffer(e.CaptureLimit)
+		sess.Stdout = teeWriter(e.Stdout, stdout)
+		sess.Stderr = teeWriter(e.Stderr, stderr)
+	}
+	// 不使用 sess.Stdin，否则 Wait 会一直等到本地的输入结束
+	// 终端的输入不转发：命令结束后转发的goroutine仍在读取终端，会读走之后确认提示的回答
+	if e.Stdin != nil && !isTerminal(e.Stdin) {
+		w, err := sess.StdinPipe()
+		if err != nil {
+			return nil, fmt.Errorf("error opening SSH session: %v", err)
+		}
+		go func() {
+			io.Copy(w, e.Stdin)
+			w.Close()
+		}()
+	}
+
+	start := time.Now()
+	if err := sess.Start(command); err != nil {
+		return nil, fmt.Errorf("error executing command: %v", err)
+	}
+	result, err := e.wait(sess, start)
+	if result != nil && e.CaptureLimit > 0 {
+		result.Stdout = stdout.String()
+		result.Stderr = stderr.String()
+	}
+	return result, err
+}
+
+// isTerminal 判断r是否是终端
+func isTerminal(r io.Reader) bool {
+	f, ok := r.(*os.File)
+	return ok && term.IsTerminal(int(f.Fd()))
+}
+
+// wait 等待远程命令结束，期间转发信号并处理超时
+func (e *Executor) wait(sess *ssh.Session, start time.Time) (*executor.ExecResult, error) {
+	var sigCh chan os.Signal
+	if e.ForwardSignals {
+		sigCh = make(chan os.Signal, 1)
+		signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
+		defer signal.Stop(sigCh)
+	}
+
+	var timeoutCh <-chan time.Time
+	if e.Timeout > 0 {
+		timer := time.NewTimer(e.Timeout)
+		defer timer.Stop()
+		timeoutCh = timer.C
+	}
+	var killCh <-chan time.Time
+
+	done := make(chan error, 1)
+	go func() {
+		done <- sess.Wait()
+	}()
+
+	timedOut := false
+	for {
+		select {
+		case sig := <-sigCh:
+			if sig == syscall.SIGTERM {
+				sess.Signal(ssh.SIGTERM)
+			} else {
+				sess.Signal(ssh.SIGINT)
+			}
+		case <-timeoutCh:
+			// 不是所有服务端都支持信号，所以同时关闭会话，并且最多再等待 killDelay
+			timedOut = true
+			sess.Signal(ssh.SIGKILL)
+			sess.Close()
+			timeoutCh = nil
+			killCh = time.After(killDelay)
+		case <-killCh:
+			return newResult(time.Since(start), true, errors.New("the command did not exit after being killed"))
+		case err := <-done:
+			return newResult(time.Since(start), timedOut, err)
+		}
+	}
+}
+
+// newResult 根据远程命令的退出状态生成执行结果
+func newResult(duration time.Duration, timedOut bool, waitErr error) (*executor.ExecResult, error) {
+	result := &executor.ExecResult{Duration: duration, TimedOut: timedOut}
+
+	var exitErr *ssh.ExitError
+	switch {
+	case waitErr == nil:
+		return result, nil
+	case errors.As(waitErr, &exitErr):
+		// 被信号终止时退出码已经是128+信号值
+		result.ExitCode = exitErr.ExitStatus()
+		if exitErr.Signal() != "" {
+			result.Signal = "SIG" + exitErr.Signal()
+		}
+	case timedOut:
+		result.ExitCode = executor.ExitCodeTimeout
+	default:
+		return result, fmt.Errorf("error executing command: %v", waitErr)
+	}
+	return result, &executor.ExitError{Result: result, Err: waitErr}
+}
+
+// teeWriter 把输出同时写到w和capture，w为空时只写到capture
+func teeWriter(w io.Writer, capture io.Writer) io.Writer {
+	if w == nil {
+		return capture
+	}
+	return io.MultiWriter(w, capture)
+}
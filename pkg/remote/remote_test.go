@@ -0,0 +1,125 @@
+package remote_test
+
+import (
+	"errors"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/LubyRuffy/aic/pkg/executor"
+	"github.com/LubyRuffy/aic/pkg/remote"
+	"github.com/LubyRuffy/aic/pkg/remote/remotetest"
+	"golang.org/x/crypto/ssh"
+)
+
+// newTestServer starts an in-process SSH server running commands with the local sh
+func newTestServer(t *testing.T) *remotetest.Server {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("the test server runs commands with sh")
+	}
+	srv, err := remotetest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestParseTarget(t *testing.T) {
+	tests := []struct {
+		target, user, addr string
+	}{
+		{"web-01", "", "web-01:22"},
+		{"deploy@web-01", "deploy", "web-01:22"},
+		{"deploy@web-01:2222", "deploy", "web-01:2222"},
+		{"::1", "", "[::1]:22"},
+		{"root@[::1]:2222", "root", "[::1]:2222"},
+	}
+	for _, tt := range tests {
+		user, addr, err := remote.ParseTarget(tt.target)
+		if err != nil || user != tt.user || addr != tt.addr {
+			t.Errorf("remote.ParseTarget(%q) = %q, %q, %v, want %q, %q", tt.target, user, addr, err, tt.user, tt.addr)
+		}
+	}
+	for _, target := range []string{"", "deploy@", "web-01:"} {
+		if _, _, err := remote.ParseTarget(target); err == nil {
+			t.Errorf("remote.ParseTarget(%q) expected an error", target)
+		}
+	}
+}
+
+func TestSystemInfo(t *testing.T) {
+	srv := newTestServer(t)
+	client, err := remote.Dial(srv.Addr, srv.Config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	info, err := client.SystemInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.OS != runtime.GOOS || info.Host != srv.Addr || info.Username == "" || info.CurrentDir == "" || info.Shell == "" {
+		t.Errorf("Unexpected system info: %+v", info)
+	}
+	if _, ok := info.EnvVars["PATH"]; !ok {
+		t.Errorf("Expected environment variable names, got %v", info.EnvVars)
+	}
+	if again, _ := client.SystemInfo(); again != info {
+		t.Error("Expected the system info to be cached")
+	}
+}
+
+func TestExecute(t *testing.T) {
+	srv := newTestServer(t)
+	client, err := remote.Dial(srv.Addr, srv.Config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	var stdout, stderr strings.Builder
+	exec := &remote.Executor{Client: client, Stdin: strings.NewReader("from stdin"), Stdout: &stdout, Stderr: &stderr, CaptureLimit: 1024}
+	result, err := exec.Execute("cat; echo; echo oops >&2; exit 3")
+	var exitErr *executor.ExitError
+	if !errors.As(err, &exitErr) || result.ExitCode != 3 {
+		t.Fatalf("Expected exit code 3, got %+v, %v", result, err)
+	}
+	if stdout.String() != "from stdin\n" || result.Stdout != "from stdin\n" || result.Stderr != "oops\n" {
+		t.Errorf("Unexpected output %q %q, captured %q %q", stdout.String(), stderr.String(), result.Stdout, result.Stderr)
+	}
+
+	// Several commands share the connection
+	exec = &remote.Executor{Client: client, CaptureLimit: 1024}
+	if result, err := exec.Execute("echo ok"); err != nil || result.Stdout != "ok\n" {
+		t.Errorf("Unexpected result %+v, %v", result, err)
+	}
+
+	exec.Timeout = 100 * time.Millisecond
+	start := time.Now()
+	result, err = exec.Execute("sleep 10")
+	if !errors.As(err, &exitErr) || !result.TimedOut || time.Since(start) > 5*time.Second {
+		t.Errorf("Expected a timeout, got %+v, %v", result, err)
+	}
+}
+
+func TestDialHostKeyMismatch(t *testing.T) {
+	srv := newTestServer(t)
+	other, err := remotetest.NewSigner()
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.Config.HostKeyCallback = ssh.FixedHostKey(other.PublicKey())
+	if _, err := remote.Dial(srv.Addr, srv.Config); err == nil {
+		t.Fatal("Expected an error for an unknown host key")
+	}
+
+	srv = newTestServer(t)
+	srv.Config.User = "someone"
+	if _, err := remote.Dial(srv.Addr, srv.Config); err == nil {
+		t.Fatal("Expected an authentication error")
+	}
+}
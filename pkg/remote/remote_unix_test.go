@@ -0,0 +1,55 @@
+//go:build !windows
+
+package remote_test
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/LubyRuffy/aic/pkg/remote"
+	"github.com/creack/pty"
+)
+
+func TestExecuteTerminalInput(t *testing.T) {
+	srv := newTestServer(t)
+	client, err := remote.Dial(srv.Addr, srv.Config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	ptmx, tty, err := pty.Open()
+	if err != nil {
+		t.Skipf("pty not available: %v", err)
+	}
+	defer ptmx.Close()
+	defer tty.Close()
+
+	var stdout strings.Builder
+	exec := &remote.Executor{Client: client, Stdin: tty, Stdout: &stdout, Stderr: &stdout}
+	if _, err := exec.Execute("echo ok"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Input typed after the command exits, such as the answer to the next confirmation, must not be consumed
+	if _, err := ptmx.Write([]byte("y\n")); err != nil {
+		t.Fatal(err)
+	}
+	answer := make(chan string, 1)
+	go func() {
+		line, _ := bufio.NewReader(tty).ReadString('\n')
+		answer <- line
+	}()
+	select {
+	case line := <-answer:
+		if strings.TrimSpace(line) != "y" {
+			t.Errorf("Expected the terminal input to be left unread, got %q", line)
+		}
+	case <-time.After(2 * time.Second):
+		t.Error("Expected the terminal input to be left unread, it was consumed by the remote command")
+		// Release the blocked readers so the terminal can be closed
+		_, _ = ptmx.Write([]byte("\n\n"))
+	}
+}
@@ -0,0 +1,176 @@
+// Package remotetest 提供用于测试的进程内SSH服务端，与 net/http/httptest 类似
+package remotetest
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"io"
+	"net"
+	"os/exec"
+	"sync"
+	"time"
+
+	"github.com/LubyRuffy/aic/pkg/remote"
+	"golang.org/x/crypto/ssh"
+)
+
+// User 是服务端接受的用户名
+const User = "tester"
+
+// Server 是监听本地随机端口的SSH服务端，使用本机的 sh 执行 exec 请求
+type Server struct {
+	// Addr 是服务端的地址，可以作为 remote.Dial 的目标
+	Addr string
+	// Config 是连接服务端使用的客户端配置
+	Config *remote.Config
+
+	ln net.Listener
+	wg sync.WaitGroup
+}
+
+// NewServer 启动一个新的服务端，使用后需要调用 Close
+func NewServer() (*Server, error) {
+	hostKey, err := NewSigner()
+	if err != nil {
+		return nil, err
+	}
+	clientKey, err := NewSigner()
+	if err != nil {
+		return nil, err
+	}
+	config := &ssh.ServerConfig{
+		PublicKeyCallback: func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if conn.User() == User && string(key.Marshal()) == string(clientKey.PublicKey().Marshal()) {
+				return nil, nil
+			}
+			return nil, errors.New("unauthorized")
+		},
+	}
+	config.AddHostKey(hostKey)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{
+		Addr: ln.Addr().String(),
+		Config: &remote.Config{
+			User:            User,
+			Auth:            []ssh.AuthMethod{ssh.PublicKeys(clientKey)},
+			HostKeyCallback: ssh.FixedHostKey(hostKey.PublicKey()),
+		},
+		ln: ln,
+	}
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			s.wg.Add(1)
+			go func() {
+				defer s.wg.Done()
+				serveConn(conn, config)
+			}()
+		}
+	}()
+	return s, nil
+}
+
+// Close 停止监听，并等待所有连接结束
+func (s *Server) Close() {
+	s.ln.Close()
+	s.wg.Wait()
+}
+
+// NewSigner 生成一个新的ed25519密钥
+func NewSigner() (ssh.Signer, error) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	return ssh.NewSignerFromKey(key)
+}
+
+func serveConn(conn net.Conn, config *ssh.ServerConfig) {
+	sconn, chans, reqs, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		conn.Close()
+		return
+	}
+	defer sconn.Close()
+	go ssh.DiscardRequests(reqs)
+
+	var wg sync.WaitGroup
+	for newChannel := range chans {
+		if newChannel.ChannelType() != "session" {
+			newChannel.Reject(ssh.UnknownChannelType, "unsupported channel type")
+			continue
+		}
+		channel, requests, err := newChannel.Accept()
+		if err != nil {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			serveSession(channel, requests)
+		}()
+	}
+	wg.Wait()
+}
+
+// serveSession 执行会话中的第一个 exec 请求，并返回退出码
+func serveSession(channel ssh.Channel, requests <-chan *ssh.Request) {
+	defer channel.Close()
+	for req := range requests {
+		if req.Type != "exec" {
+			req.Reply(false, nil)
+			continue
+		}
+		var payload struct{ Command string }
+		if err := ssh.Unmarshal(req.Payload, &payload); err != nil {
+			req.Reply(false, nil)
+			continue
+		}
+		req.Reply(true, nil)
+
+		// #nosec G204 -- the test server executes what the client asks for
+		cmd := exec.Command("sh", "-c", payload.Command)
+		cmd.Stdout, cmd.Stderr = channel, channel.Stderr()
+		cmd.WaitDelay = 100 * time.Millisecond
+		// 和 sshd 一样，命令结束后不再等待客户端的输入
+		stdin, err := cmd.StdinPipe()
+		if err != nil {
+			return
+		}
+		if err := cmd.Start(); err != nil {
+			return
+		}
+		go func() {
+			io.Copy(stdin, channel)
+			stdin.Close()
+		}()
+		done := make(chan struct{})
+		go func() {
+			// 收到信号或者会话关闭时终止命令
+			for req := range requests {
+				if req.Type == "signal" {
+					cmd.Process.Kill()
+				}
+				req.Reply(false, nil)
+			}
+			cmd.Process.Kill()
+			<-done
+		}()
+		cmd.Wait()
+		close(done)
+
+		status := struct{ Status uint32 }{uint32(cmd.ProcessState.ExitCode())}
+		channel.SendRequest("exit-status", false, ssh.Marshal(&status))
+		return
+	}
+}
@@ -0,0 +1,105 @@
+package safety
+
+import "strings"
+
+// AffectedPaths 返回命令会修改或删除的文件路径，用于在执行前保存快照
+// 只识别常见的删除、移动、就地编辑、修改权限的命令和重定向，路径按出现顺序返回，可能包含通配符
+// 包含变量、命令替换或 ~ 的路径无法静态确定，会被忽略
+func AffectedPaths(command string) []string {
+	var paths []string
+	seen := make(map[string]bool)
+	add := func(candidates ...string) {
+		for _, p := range candidates {
+			if p == "" || seen[p] || strings.ContainsAny(p, "$`") || strings.HasPrefix(p, "~") {
+				continue
+			}
+			seen[p] = true
+			paths = append(paths, p)
+		}
+	}
+
+	for _, c := range Parse(command) {
+		args := c.ProgramArgs()
+		if len(args) > 0 {
+			add(affectedOperands(c.Program(), args[1:])...)
+		}
+		for _, redirect := range c.Redirects {
+			if strings.Contains(redirect.Op, ">") && !strings.HasPrefix(redirect.Target, "&") && !strings.HasPrefix(redirect.Target, "/dev/") {
+				add(redirect.Target)
+			}
+		}
+	}
+	return paths
+}
+
+// affectedOperands 返回命令参数中会被修改的文件
+func affectedOperands(program string, args []string) []string {
+	switch program {
+	case "rm", "rmdir", "shred", "unlink", "mv", "tee":
+		return operands(args)
+	case "cp", "install", "rsync", "ln":
+		// 只有目标会被覆盖
+		if ops := operands(args); len(ops) >= 2 {
+			return ops[len(ops)-1:]
+		}
+	case "sed", "perl":
+		if hasFlag(args, 'i', "--in-place") {
+			return scriptOperands(args)
+		}
+	case "chmod", "chown", "chgrp":
+		// 第一个参数是权限或所有者，除非通过 --reference 指定
+		ops := operands(args)
+		if hasPrefixArg(args, "--reference") {
+			return ops
+		}
+		if len(ops) >= 2 {
+			return ops[1:]
+		}
+	case "truncate":
+		return skipValues(args, "-s", "--size", "-r", "--reference")
+	}
+	return nil
+}
+
+// scriptOperands 返回 sed 和 perl 处理的文件，没有通过 -e 或 -f 指定脚本时第一个参数是脚本
+func scriptOperands(args []string) []string {
+	var files []string
+	script := false
+	for i := 0; i < len(args); i++ {
+		switch a := args[i]; {
+		case a == "-e" || a == "-f" || a == "--expression" || a == "--file":
+			script = true
+			i++
+		case strings.HasPrefix(a, "--expression=") || strings.HasPrefix(a, "--file="):
+			script = true
+		case strings.HasPrefix(a, "-") && len(a) > 1 && a[1] != '-' && !strings.Contains(a, ".") && strings.ContainsAny(a[1:], "ef"):
+			// -pie 's/a/b/' 这样合并的选项中，-e 的值是下一个参数
+			script = true
+			if strings.HasSuffix(a, "e") || strings.HasSuffix(a, "f") {
+				i++
+			}
+		case strings.HasPrefix(a, "-"):
+		default:
+			files = append(files, a)
+		}
+	}
+	if !script && len(files) > 0 {
+		files = files[1:]
+	}
+	return files
+}
+
+// skipValues 返回去掉选项及其值之后的参数
+func skipValues(args []string, options ...string) []string {
+	var result []string
+	for i := 0; i < len(args); i++ {
+		if hasAnyArg(options, args[i]) {
+			i++
+			continue
+		}
+		if !strings.HasPrefix(args[i], "-") {
+			result = append(result, args[i])
+		}
+	}
+	return result
+}
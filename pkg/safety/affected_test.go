@@ -0,0 +1,34 @@
+package safety
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestAffectedPaths(t *testing.T) {
+	tests := []struct {
+		command string
+		want    []string
+	}{
+		{"rm -rf build dist", []string{"build", "dist"}},
+		{"mv a.txt b.txt", []string{"a.txt", "b.txt"}},
+		{"cp -r src backup/", []string{"backup/"}},
+		{"sed -i 's/foo/bar/g' main.go util.go", []string{"main.go", "util.go"}},
+		{"sed -i.bak -e 's/a/b/' -e 's/c/d/' conf.ini", []string{"conf.ini"}},
+		{"perl -pi -e 's/a/b/' notes.txt", []string{"notes.txt"}},
+		{"chmod -R 644 docs *.md", []string{"docs", "*.md"}},
+		{"chown --reference=ref.txt out.txt", []string{"out.txt"}},
+		{"truncate -s 0 app.log", []string{"app.log"}},
+		{"sort data.csv | uniq > result.csv 2>/dev/null", []string{"result.csv"}},
+		{"find . -name '*.tmp' | xargs rm", nil},
+		{"sudo rm /etc/hosts && echo done >> log.txt", []string{"/etc/hosts", "log.txt"}},
+		{"rm $HOME/x ~/y z", []string{"z"}},
+		{"sed 's/a/b/' file", nil},
+		{"ls -la", nil},
+	}
+	for _, tt := range tests {
+		if got := AffectedPaths(tt.command); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("AffectedPaths(%q) = %q, want %q", tt.command, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,573 @@
+package safety
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// SimpleCommand 是命令行中通过管道、分号、&& 等分隔开的一条简单命令
+type SimpleCommand struct {
+	// Args 是去掉引号后的参数，不包含开头的环境变量赋值
+	Args []string
+	// Redirects 是命令中的重定向
+	Redirects []Redirect
+	// PipedFrom 表示这条命令的标准输入来自前一条命令的管道
+	PipedFrom bool
+}
+
+// Redirect 是一个重定向，比如 "> out.txt"
+type Redirect struct {
+	Op     string
+	Target string
+}
+
+// UnknownProgram 是包装程序的选项无法识别时使用的程序名称，无法确定实际执行的程序，规则把它当作高风险
+const UnknownProgram = "<unknown>"
+
+// wrapperOptions 是只是用来包装另一个命令执行的程序以及它们能够识别的选项，值为true的选项带一个参数
+var wrapperOptions = map[string]map[string]bool{
+	"sudo": {
+		"-u": true, "-g": true, "-C": true, "-D": true, "-h": true, "-p": true, "-U": true, "-r": true, "-t": true, "-T": true,
+		"--user": true, "--group": true, "--close-from": true, "--chdir": true, "--host": true, "--prompt": true,
+		"--other-user": true, "--role": true, "--type": true, "--command-timeout": true,
+		"-A": false, "-b": false, "-E": false, "-H": false, "-i": false, "-k": false, "-n": false, "-P": false, "-S": false, "-s": false,
+		"--askpass": false, "--background": false, "--preserve-env": false, "--set-home": false, "--login": false,
+		"--reset-timestamp": false, "--non-interactive": false, "--preserve-groups": false, "--stdin": false, "--shell": false,
+	},
+	"doas":    {"-u": true, "-C": true, "-n": false, "-s": false, "-L": false},
+	"pkexec":  {"--user": true, "--disable-internal-agent": false, "--keep-cwd": false},
+	"env":     {"-u": true, "-C": true, "-S": true, "--unset": true, "--chdir": true, "--split-string": true, "-i": false, "-0": false, "-v": false, "--ignore-environment": false, "--null": false, "--debug": false},
+	"nohup":   {},
+	"time":    {"-o": true, "-f": true, "--output": true, "--format": true, "-p": false, "-v": false, "-a": false, "-q": false, "--portability": false, "--verbose": false, "--append": false, "--quiet": false},
+	"nice":    {"-n": true, "--adjustment": true},
+	"ionice":  {"-c": true, "-n": true, "-p": true, "-P": true, "-u": true, "--class": true, "--classdata": true, "--pid": true, "--pgid": true, "--uid": true, "-t": false, "--ignore": false},
+	"command": {"-p": false, "-v": false, "-V": false},
+	"exec":    {"-a": true, "-c": false, "-l": false},
+	"xargs": {
+		"-I": true, "-n": true, "-P": true, "-L": true, "-d": true, "-a": true, "-E": true, "-s": true,
+		"--replace": true, "--max-args": true, "--max-procs": true, "--max-lines": true, "--delimiter": true, "--arg-file": true,
+		"--eof": true, "--max-chars": true, "--process-slot-var": true,
+		"-0": false, "-r": false, "-t": false, "-p": false, "-x": false, "-o": false,
+		"--null": false, "--no-run-if-empty": false, "--verbose": false, "--interactive": false, "--exit": false, "--open-tty": false,
+	},
+	"timeout": {"-s": true, "-k": true, "--signal": true, "--kill-after": true, "-v": false, "--foreground": false, "--preserve-status": false, "--verbose": false},
+	"stdbuf":  {"-i": true, "-o": true, "-e": true, "--input": true, "--output": true, "--error": true},
+	"busybox": {"--help": false, "--list": false, "--list-full": false},
+	"watch": {
+		"-n": true, "-q": true, "--interval": true, "--equexit": true,
+		"-d": false, "-b": false, "-c": false, "-e": false, "-g": false, "-p": false, "-t": false, "-w": false, "-x": false,
+		"--differences": false, "--beep": false, "--color": false, "--errexit": false, "--chgexit": false, "--precise": false,
+		"--no-title": false, "--no-wrap": false, "--exec": false,
+	},
+}
+
+// Program 返回实际执行的程序名称，会跳过sudo、env、xargs等包装程序以及它们的选项
+func (c SimpleCommand) Program() string {
+	args := c.ProgramArgs()
+	if len(args) == 0 {
+		return ""
+	}
+	return programName(args[0])
+}
+
+// ProgramArgs 返回去掉包装程序之后的参数，包装程序的选项无法识别或者程序名称包含变量、命令替换时返回 UnknownProgram
+func (c SimpleCommand) ProgramArgs() []string {
+	_, args := unwrap(c.Args)
+	return args
+}
+
+// Wrappers 返回命令中使用的包装程序，比如sudo
+func (c SimpleCommand) Wrappers() []string {
+	wrappers, _ := unwrap(c.Args)
+	return wrappers
+}
+
+// unwrap 跳过包装程序以及它们的选项、env的变量赋值和timeout的时长，返回包装程序和剩下的参数
+func unwrap(args []string) ([]string, []string) {
+	var wrappers []string
+	for len(args) > 0 {
+		wrapper := programName(args[0])
+		options, ok := wrapperOptions[wrapper]
+		if !ok {
+			break
+		}
+		wrappers = append(wrappers, wrapper)
+		args = args[1:]
+
+		for len(args) > 0 {
+			a := args[0]
+			if a == "--" {
+				args = args[1:]
+				break
+			}
+			// env - 等同于 env -i
+			if wrapper == "env" && (isAssignment(a) || a == "-") {
+				args = args[1:]
+				continue
+			}
+			if !strings.HasPrefix(a, "-") || a == "-" {
+				break
+			}
+			// nice -10 这样的写法直接给出优先级
+			if wrapper == "nice" && isDigits(a[1:]) {
+				args = args[1:]
+				continue
+			}
+			value, consumed, ok := wrapperOption(options, a, args[1:])
+			if !ok {
+				return wrappers, []string{UnknownProgram}
+			}
+			args = args[1+consumed:]
+			// env -S 把它的值拆分为参数
+			if wrapper == "env" && (strings.HasPrefix(a, "-S") || strings.HasPrefix(a, "--split-string")) {
+				args = append(strings.Fields(value), args...)
+			}
+		}
+		if wrapper == "timeout" && len(args) > 0 {
+			args = args[1:]
+		}
+	}
+	// $(echo rm) 这样的程序名称只有执行时才能确定
+	if len(args) > 0 && Dynamic(args[0]) {
+		return wrappers, []string{UnknownProgram}
+	}
+	return wrappers, args
+}
+
+// Dynamic 判断参数的值是否只有执行时才能确定，比如包含变量、命令替换或进程替换
+func Dynamic(arg string) bool {
+	return strings.ContainsAny(arg, "$`") || strings.Contains(arg, "<(") || strings.Contains(arg, ">(")
+}
+
+// wrapperOption 解析包装程序的一个选项，支持 --user=root、-u root、-uroot 以及 -Eu root 这样的组合，
+// 返回选项的值和额外使用的参数数量，选项无法识别或者缺少值时ok为false
+func wrapperOption(options map[string]bool, arg string, rest []string) (value string, consumed int, ok bool) {
+	if strings.HasPrefix(arg, "--") {
+		name, v, hasValue := strings.Cut(arg, "=")
+		takesValue, known := options[name]
+		switch {
+		case !known:
+			return "", 0, false
+		case hasValue || !takesValue:
+			return v, 0, true
+		case len(rest) == 0:
+			return "", 0, false
+		}
+		return rest[0], 1, true
+	}
+	for i, r := range arg[1:] {
+		takesValue, known := options["-"+string(r)]
+		if !known {
+			return "", 0, false
+		}
+		if !takesValue {
+			continue
+		}
+		if attached := arg[2+i:]; attached != "" {
+			return attached, 0, true
+		}
+		if len(rest) == 0 {
+			return "", 0, false
+		}
+		return rest[0], 1, true
+	}
+	return "", 0, true
+}
+
+// programName 返回去掉路径和.exe后缀的小写程序名称
+func programName(arg string) string {
+	if i := strings.LastIndexAny(arg, `/\`); i >= 0 {
+		arg = arg[i+1:]
+	}
+	return strings.TrimSuffix(strings.ToLower(arg), ".exe")
+}
+
+// Parse 把命令行拆分为简单命令
+// 这是一个面向安全分析的近似解析器，支持引号、转义、管道、命令分隔符、重定向，
+// 子shell、花括号以及 if、for、while、case 等复合命令中的命令会和其他命令一样返回，
+// 并且会把 $(...)、反引号、<(...)、>(...) 以及 sh -c、eval、su -c 中的内容作为独立的命令一起返回
+func Parse(command string) []SimpleCommand {
+	p := &parser{input: []rune(command)}
+	p.parse()
+
+	// 展开 sh -c "..." 这种在字符串中嵌套的命令
+	var nested []SimpleCommand
+	for _, c := range p.commands {
+		if script, ok := nestedScript(c.ProgramArgs()); ok {
+			nested = append(nested, Parse(script)...)
+		}
+	}
+	return append(p.commands, nested...)
+}
+
+// nestedScript 返回 sh -c、eval 以及 su -c、runuser -c 执行的脚本
+func nestedScript(args []string) (string, bool) {
+	if len(args) == 0 {
+		return "", false
+	}
+	switch programName(args[0]) {
+	case "eval":
+		return strings.Join(args[1:], " "), len(args) > 1
+	case "su", "runuser":
+		return suScript(args)
+	}
+	return shellScript(args)
+}
+
+// suScript 返回 su -c "..." 中的脚本，支持 --command=...、--session-command 以及 -lc 这样的组合选项
+func suScript(args []string) (string, bool) {
+	for i := 1; i < len(args); i++ {
+		a := args[i]
+		if name, value, ok := strings.Cut(a, "="); ok && (name == "--command" || name == "--session-command") {
+			return value, true
+		}
+		if a == "--command" || a == "--session-command" || (len(a) > 1 && a[0] == '-' && a[1] != '-' && strings.HasSuffix(a, "c")) {
+			if i+1 < len(args) {
+				return args[i+1], true
+			}
+			return "", false
+		}
+		if len(a) > 1 && a[0] == '-' && a[1] != '-' && strings.ContainsRune(a, 'c') {
+			return a[strings.IndexRune(a, 'c')+1:], true
+		}
+	}
+	return "", false
+}
+
+// shellScript 返回 sh -c "..." 中的脚本，-lc、-ec 这样包含c的组合选项也等同于 -c
+func shellScript(args []string) (string, bool) {
+	if len(args) == 0 || !isShell(programName(args[0])) {
+		return "", false
+	}
+	command := false
+	for i := 1; i < len(args); i++ {
+		a := args[i]
+		switch {
+		case a == "--":
+			continue
+		case a == "-o" || a == "+o":
+			// set -o 的选项名称
+			i++
+		case strings.HasPrefix(a, "--"):
+		case len(a) > 1 && (a[0] == '-' || a[0] == '+'):
+			if strings.ContainsRune(a[1:], 'c') {
+				command = true
+			}
+		default:
+			return a, command
+		}
+	}
+	return "", false
+}
+
+func isShell(name string) bool {
+	switch name {
+	case "sh", "bash", "zsh", "dash", "ksh", "fish":
+		return true
+	}
+	return false
+}
+
+// keywords 是命令开头的shell保留字，它们本身不是命令，后面的内容才是
+var keywords = map[string]bool{
+	"if": true, "then": true, "else": true, "elif": true, "fi": true, "do": true, "done": true,
+	"while": true, "until": true, "esac": true, "{": true, "}": true, "!": true,
+}
+
+// 不是命令的头部，比如 for 的变量和列表、case 的值和模式
+const (
+	headerNone = iota
+	// headerFor 是 for、select 和 function 的头部，到命令结束或者 do、{ 为止
+	headerFor
+	// headerCase 是 case 的头部和模式，到 ) 或者 esac 为止
+	headerCase
+)
+
+type parser struct {
+	input    []rune
+	pos      int
+	commands []SimpleCommand
+
+	current SimpleCommand
+	word    strings.Builder
+	inWord  bool
+	// quoted 表示当前的单词中使用了引号或转义，这样的单词不是保留字
+	quoted bool
+	header int
+	// pendingRedirect 是等待目标的重定向操作符
+	pendingRedirect string
+	piped           bool
+}
+
+func (p *parser) parse() {
+	for p.pos < len(p.input) {
+		r := p.input[p.pos]
+		switch {
+		case r == '\\' && p.pos+1 < len(p.input):
+			p.inWord = true
+			p.quoted = true
+			p.word.WriteRune(p.input[p.pos+1])
+			p.pos += 2
+		case r == '\'':
+			p.inWord = true
+			p.quoted = true
+			p.pos++
+			for p.pos < len(p.input) && p.input[p.pos] != '\'' {
+				p.word.WriteRune(p.input[p.pos])
+				p.pos++
+			}
+			p.pos++
+		case r == '"':
+			p.inWord = true
+			p.quoted = true
+			p.pos++
+			p.parseDoubleQuoted()
+		case r == '$' && p.peek(1) == '(':
+			p.inWord = true
+			p.pos += 2
+			p.parseSubstitution("$(", ')')
+		case r == '`':
+			p.inWord = true
+			p.pos++
+			p.parseSubstitution("$(", '`')
+		case (r == '<' || r == '>') && p.peek(1) == '(':
+			// 进程替换 <(...) 和 >(...)，参数是一个文件描述符的路径
+			p.inWord = true
+			p.pos += 2
+			p.parseSubstitution(string(r)+"(", ')')
+		case r == ' ' || r == '\t':
+			p.endWord()
+			p.pos++
+		case r == '(' || r == ')':
+			// 子shell和 case 的模式
+			p.endWord()
+			p.endCommand()
+			if r == ')' && p.header == headerCase {
+				p.header = headerNone
+			}
+			p.pos++
+		case r == '\n' || r == ';' || r == '&' || r == '|':
+			p.endWord()
+			p.endCommand()
+			p.piped = r == '|' && p.peek(1) != '|'
+			// ;; 之后是 case 的下一个模式
+			if r == ';' && p.peek(1) == ';' {
+				p.header = headerCase
+			}
+			if r == '&' && p.peek(1) == '>' {
+				// &> file 重定向
+				p.piped = false
+				p.pendingRedirect = "&>"
+				p.pos += 2
+				continue
+			}
+			p.pos++
+			if p.peek(0) == r {
+				p.pos++
+			}
+		case r == '>' || r == '<':
+			// 2> 之类的文件描述符前缀属于重定向
+			fd := ""
+			if p.inWord && isDigits(p.word.String()) {
+				fd = p.word.String()
+				p.word.Reset()
+				p.inWord = false
+			}
+			p.endWord()
+			op := fd + string(r)
+			p.pos++
+			for p.pos < len(p.input) && (p.input[p.pos] == '>' || p.input[p.pos] == '&' || p.input[p.pos] == '|') {
+				op += string(p.input[p.pos])
+				p.pos++
+			}
+			p.pendingRedirect = op
+		default:
+			p.inWord = true
+			p.word.WriteRune(r)
+			p.pos++
+		}
+	}
+	p.endWord()
+	p.endCommand()
+}
+
+func (p *parser) peek(offset int) rune {
+	if p.pos+offset < len(p.input) {
+		return p.input[p.pos+offset]
+	}
+	return 0
+}
+
+func (p *parser) parseDoubleQuoted() {
+	for p.pos < len(p.input) && p.input[p.pos] != '"' {
+		r := p.input[p.pos]
+		switch {
+		case r == '\\' && p.pos+1 < len(p.input):
+			p.word.WriteRune(p.input[p.pos+1])
+			p.pos += 2
+		case r == '$' && p.peek(1) == '(':
+			p.pos += 2
+			p.parseSubstitution("$(", ')')
+		case r == '`':
+			p.pos++
+			p.parseSubstitution("$(", '`')
+		default:
+			p.word.WriteRune(r)
+			p.pos++
+		}
+	}
+	p.pos++
+}
+
+// parseSubstitution 解析命令替换或进程替换的内容，并把其中的命令加入结果，
+// 参数中以open开头保留替换的内容
+func (p *parser) parseSubstitution(open string, end rune) {
+	depth := 1
+	start := p.pos
+	for p.pos < len(p.input) {
+		r := p.input[p.pos]
+		if end == ')' && r == '(' {
+			depth++
+		} else if r == end {
+			depth--
+			if depth == 0 {
+				break
+			}
+		}
+		p.pos++
+	}
+	inner := string(p.input[start:p.pos])
+	p.pos++
+	p.word.WriteString(open + inner + ")")
+	p.commands = append(p.commands, Parse(inner)...)
+}
+
+func (p *parser) endWord() {
+	if !p.inWord {
+		return
+	}
+	word := p.word.String()
+	quoted := p.quoted
+	p.word.Reset()
+	p.inWord = false
+	p.quoted = false
+
+	if p.pendingRedirect != "" {
+		p.current.Redirects = append(p.current.Redirects, Redirect{Op: p.pendingRedirect, Target: word})
+		p.pendingRedirect = ""
+		return
+	}
+	if len(p.current.Args) == 0 && p.keyword(word, quoted) {
+		return
+	}
+	// 开头的环境变量赋值不属于参数
+	if len(p.current.Args) == 0 && isAssignment(word) {
+		return
+	}
+	p.current.Args = append(p.current.Args, word)
+}
+
+// keyword 处理命令开头的保留字和复合命令的头部，word不属于命令时返回true
+// 使用了引号的单词不是保留字，但在复合命令的头部中同样不是命令
+func (p *parser) keyword(word string, quoted bool) bool {
+	switch p.header {
+	case headerFor:
+		if !quoted && (word == "do" || word == "{") {
+			p.header = headerNone
+		}
+		return true
+	case headerCase:
+		if !quoted && word == "esac" {
+			p.header = headerNone
+		}
+		return true
+	}
+	if quoted {
+		return false
+	}
+	switch word {
+	case "for", "select", "function":
+		p.header = headerFor
+		return true
+	case "case":
+		p.header = headerCase
+		return true
+	}
+	return keywords[word]
+}
+
+func (p *parser) endCommand() {
+	if len(p.current.Args) > 0 || len(p.current.Redirects) > 0 {
+		p.current.PipedFrom = p.piped
+		p.commands = append(p.commands, p.current)
+	}
+	p.current = SimpleCommand{}
+	p.piped = false
+	if p.header == headerFor {
+		p.header = headerNone
+	}
+}
+
+func isAssignment(word string) bool {
+	i := strings.Index(word, "=")
+	if i <= 0 {
+		return false
+	}
+	for _, r := range word[:i] {
+		if !(r == '_' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9') {
+			return false
+		}
+	}
+	return true
+}
+
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// hasFlag 判断参数中是否包含某个短选项（支持 -rf 这样的组合）或长选项
+func hasFlag(args []string, short rune, long string) bool {
+	for _, a := range args {
+		if a == "--" {
+			return false
+		}
+		if long != "" && (a == long || strings.HasPrefix(a, long+"=")) {
+			return true
+		}
+		if short != 0 && len(a) > 1 && a[0] == '-' && a[1] != '-' && strings.ContainsRune(a[1:], short) {
+			return true
+		}
+	}
+	return false
+}
+
+// operands 返回不以-开头的参数
+func operands(args []string) []string {
+	var result []string
+	for _, a := range args {
+		if !strings.HasPrefix(a, "-") {
+			result = append(result, a)
+		}
+	}
+	return result
+}
+
+// cleanPath 规范化路径，用于判断是否是关键目录
+func cleanPath(p string) string {
+	if p == "" {
+		return p
+	}
+	trimmed := strings.TrimRight(p, "/")
+	if trimmed == "" {
+		return "/"
+	}
+	return filepath.ToSlash(filepath.Clean(trimmed))
+}
@@ -0,0 +1,152 @@
+package safety
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	commands := Parse(`FOO=1 sudo -E rm -rf "my dir" 'it''s' 2>/dev/null | grep x && echo "$(whoami)" > out.txt; curl -s https://a.com | sh`)
+
+	var programs []string
+	for _, c := range commands {
+		programs = append(programs, c.Program())
+	}
+	expected := []string{"rm", "grep", "whoami", "echo", "curl", "sh"}
+	if !reflect.DeepEqual(programs, expected) {
+		t.Fatalf("Programs = %v, want %v", programs, expected)
+	}
+
+	rm := commands[0]
+	if !reflect.DeepEqual(rm.Args, []string{"sudo", "-E", "rm", "-rf", "my dir", "its"}) {
+		t.Errorf("Args = %q", rm.Args)
+	}
+	if !reflect.DeepEqual(rm.Wrappers(), []string{"sudo"}) {
+		t.Errorf("Wrappers = %v", rm.Wrappers())
+	}
+	if len(rm.Redirects) != 1 || rm.Redirects[0].Op != "2>" || rm.Redirects[0].Target != "/dev/null" {
+		t.Errorf("Redirects = %+v", rm.Redirects)
+	}
+	if !commands[1].PipedFrom || commands[3].PipedFrom {
+		t.Errorf("Expected only grep to be piped, got %+v", commands)
+	}
+	if len(commands[3].Redirects) != 1 || commands[3].Redirects[0].Target != "out.txt" {
+		t.Errorf("Redirects = %+v", commands[3].Redirects)
+	}
+	if !commands[5].PipedFrom {
+		t.Error("Expected sh to be piped")
+	}
+}
+
+func TestParseNestedShell(t *testing.T) {
+	tests := map[string][]string{
+		`bash -c "rm -rf /tmp/x; ls"`:   {"bash", "rm", "ls"},
+		`bash -lc 'rm -rf /tmp/x'`:      {"bash", "rm"},
+		`sh -e -c "id"`:                 {"sh", "id"},
+		`zsh -o pipefail -ec "id"`:      {"zsh", "id"},
+		`sudo bash --norc -xc 'reboot'`: {"bash", "reboot"},
+		`bash script.sh`:                {"bash"},
+		`eval "rm -rf /tmp/x"`:          {"eval", "rm"},
+		`su -c "rm -rf /tmp/x" root`:    {"su", "rm"},
+		`su - root -lc id`:              {"su", "id"},
+		`runuser -u www --command=id`:   {"runuser", "id"},
+		`busybox rm -rf /tmp/x`:         {"rm"},
+		`cat <(rm -rf ~)`:               {"rm", "cat"},
+		`diff <(ls a) >(wc -l)`:         {"ls", "wc", "diff"},
+	}
+	for command, want := range tests {
+		var programs []string
+		for _, c := range Parse(command) {
+			programs = append(programs, c.Program())
+		}
+		if !reflect.DeepEqual(programs, want) {
+			t.Errorf("Parse(%q) programs = %v, want %v", command, programs, want)
+		}
+	}
+}
+
+func TestParseProcessSubstitution(t *testing.T) {
+	commands := Parse(`tee >(gzip > out.gz) < in.txt`)
+	if len(commands) != 2 || commands[1].Program() != "tee" {
+		t.Fatalf("Unexpected commands %+v", commands)
+	}
+	tee := commands[1]
+	if !reflect.DeepEqual(tee.Args, []string{"tee", ">(gzip > out.gz)"}) {
+		t.Errorf("Args = %q", tee.Args)
+	}
+	if !reflect.DeepEqual(tee.Redirects, []Redirect{{Op: "<", Target: "in.txt"}}) {
+		t.Errorf("Redirects = %+v", tee.Redirects)
+	}
+	if gzip := commands[0]; !reflect.DeepEqual(gzip.Redirects, []Redirect{{Op: ">", Target: "out.gz"}}) {
+		t.Errorf("Redirects = %+v", gzip.Redirects)
+	}
+}
+
+func TestParseCompound(t *testing.T) {
+	tests := map[string][]string{
+		`(rm -rf /tmp/x)`:    {"rm"},
+		`{ rm -rf /tmp/x; }`: {"rm"},
+		`if test -d x; then rm -r x; elif true; then :; else ls; fi`: {"test", "rm", "true", ":", "ls"},
+		"for f in *.log \"a b\"; do gzip $f; done":                   {"gzip"},
+		"for f in a b\ndo\n  rm $f\ndone":                            {"rm"},
+		`while sleep 1; do date; done`:                               {"sleep", "date"},
+		`until ping -c1 host; do :; done`:                            {"ping", ":"},
+		`! grep -q x f && touch f`:                                   {"grep", "touch"},
+		`case $1 in start) nginx;; stop|halt) nginx -s stop;; esac`:  {"nginx", "nginx"},
+		`function f { id; }`:                                         {"id"},
+		`echo if then fi`:                                            {"echo"},
+		`"if" x`:                                                     {"if"},
+	}
+	for command, want := range tests {
+		var programs []string
+		for _, c := range Parse(command) {
+			programs = append(programs, c.Program())
+		}
+		if !reflect.DeepEqual(programs, want) {
+			t.Errorf("Parse(%q) programs = %v, want %v", command, programs, want)
+		}
+	}
+}
+
+func TestProgramArgs(t *testing.T) {
+	tests := []struct {
+		command  string
+		args     []string
+		wrappers []string
+	}{
+		{"env LANG=C timeout 5 xargs -0 /usr/bin/RM.exe -f a", []string{"/usr/bin/RM.exe", "-f", "a"}, []string{"env", "timeout", "xargs"}},
+		{"sudo -u root rm -rf /", []string{"rm", "-rf", "/"}, []string{"sudo"}},
+		{"sudo -Eu root -- rm x", []string{"rm", "x"}, []string{"sudo"}},
+		{"sudo --user=root id", []string{"id"}, []string{"sudo"}},
+		{"doas -u www rm x", []string{"rm", "x"}, []string{"doas"}},
+		{"nice -n 10 rm -rf /", []string{"rm", "-rf", "/"}, []string{"nice"}},
+		{"nice -10 rm x", []string{"rm", "x"}, []string{"nice"}},
+		{"ionice -c 3 -n7 rm x", []string{"rm", "x"}, []string{"ionice"}},
+		{"timeout -s KILL 5 rm -rf /", []string{"rm", "-rf", "/"}, []string{"timeout"}},
+		{"timeout -k 1 --signal=TERM 5s sudo id", []string{"id"}, []string{"timeout", "sudo"}},
+		{"stdbuf -oL -e 0 grep x", []string{"grep", "x"}, []string{"stdbuf"}},
+		{"xargs -I {} -P 4 rm {}", []string{"rm", "{}"}, []string{"xargs"}},
+		{"xargs -n1 -d '\\n' rm", []string{"rm"}, []string{"xargs"}},
+		{"watch -n 5 -d df -h", []string{"df", "-h"}, []string{"watch"}},
+		{"env -u HOME -C /tmp FOO=1 sudo id", []string{"id"}, []string{"env", "sudo"}},
+		{"env -S 'rm -rf' /", []string{"rm", "-rf", "/"}, []string{"env"}},
+		{"env - PATH=/bin id", []string{"id"}, []string{"env"}},
+		{"sudo --bogus rm -rf /", []string{UnknownProgram}, []string{"sudo"}},
+		{"nice -X rm x", []string{UnknownProgram}, []string{"nice"}},
+		{"sudo -u", []string{UnknownProgram}, []string{"sudo"}},
+		{"$CMD -rf /", []string{UnknownProgram}, nil},
+		{"sudo $CMD x", []string{UnknownProgram}, []string{"sudo"}},
+	}
+	for _, tt := range tests {
+		c := Parse(tt.command)[0]
+		if got := c.ProgramArgs(); !reflect.DeepEqual(got, tt.args) {
+			t.Errorf("ProgramArgs(%q) = %q, want %q", tt.command, got, tt.args)
+		}
+		if got := c.Wrappers(); !reflect.DeepEqual(got, tt.wrappers) {
+			t.Errorf("Wrappers(%q) = %q, want %q", tt.command, got, tt.wrappers)
+		}
+	}
+	if c := Parse("env LANG=C timeout 5 xargs -0 /usr/bin/RM.exe -f a")[0]; c.Program() != "rm" {
+		t.Errorf("Program() = %s, want rm", c.Program())
+	}
+}
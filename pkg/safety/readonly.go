@@ -0,0 +1,188 @@
+package safety
+
+import (
+	"fmt"
+	"strings"
+)
+
+// readOnlyPrograms 是只读取信息的程序，值不为nil时还需要检查参数
+var readOnlyPrograms = map[string]func(args []string) bool{
+	// 文件和文本
+	"ls": nil, "cat": nil, "head": nil, "wc": nil, "cut": nil, "tr": nil,
+	"grep": nil, "egrep": nil, "fgrep": nil, "stat": nil,
+	"readlink": nil, "realpath": nil, "basename": nil, "dirname": nil, "locate": nil, "cmp": nil,
+	"diff": nil, "md5sum": nil, "sha1sum": nil, "sha256sum": nil, "hexdump": nil,
+	"od": nil, "strings": nil, "jq": nil, "echo": nil, "printf": nil, "test": nil, "true": nil,
+	"false": nil, "column": nil, "nl": nil,
+	// tail -f 不会结束
+	"tail": func(args []string) bool { return !hasFlag(args, 'f', "--follow") && !hasFlag(args, 'F', "") },
+	// uniq 的第二个文件参数是输出文件
+	"uniq": func(args []string) bool {
+		return countOperands(args, "-f", "--skip-fields", "-s", "--skip-chars", "-w", "--check-chars") <= 1
+	},
+	// file -C 编译magic文件
+	"file": func(args []string) bool { return !hasFlag(args, 'C', "--compile") },
+	"find": func(args []string) bool {
+		return !hasAnyArg(args, "-delete", "-exec", "-execdir", "-ok", "-okdir", "-fprint", "-fprint0", "-fprintf", "-fls")
+	},
+	"sort": func(args []string) bool {
+		return !hasFlag(args, 'o', "--output") && !hasFlag(args, 0, "--compress-program")
+	},
+	// rg --pre 对每个文件运行指定的程序
+	"rg":   func(args []string) bool { return !hasFlag(args, 0, "--pre") && !hasFlag(args, 0, "--pre-glob") },
+	"tree": func(args []string) bool { return !hasFlag(args, 'o', "") },
+	// xxd -r 和第二个文件参数都会写文件
+	"xxd": func(args []string) bool {
+		for _, a := range args {
+			// -r 以及 -rp 这样的组合
+			if a == "-revert" || (strings.HasPrefix(a, "-r") && len(a) <= 3) {
+				return false
+			}
+		}
+		return countOperands(args, "-c", "-cols", "-g", "-groupsize", "-l", "-len", "-o", "-offset", "-s", "-seek", "-n", "-name") <= 1
+	},
+
+	// 系统和进程
+	"ps": nil, "pgrep": nil, "lsof": nil, "netstat": nil, "df": nil, "du": nil,
+	"free": nil, "uname": nil, "whoami": nil, "id": nil, "groups": nil, "pwd": nil, "env": nil,
+	"printenv": nil, "uptime": nil, "which": nil, "whereis": nil, "type": nil, "getent": nil,
+	"last": nil, "w": nil, "who": nil, "vmstat": nil, "iostat": nil, "lsblk": nil, "blkid": nil,
+	"nproc": nil, "arch": nil, "lscpu": nil, "lsusb": nil, "lspci": nil,
+	// fuser -k 和 ss -K 会结束进程和连接
+	"fuser":    func(args []string) bool { return !hasFlag(args, 'k', "--kill") },
+	"ss":       func(args []string) bool { return !hasFlag(args, 'K', "--kill") },
+	"nslookup": nil, "dig": nil, "host": nil, "mount": func(args []string) bool { return len(args) == 0 },
+	"hostname": func(args []string) bool { return len(args) == 0 },
+	"date":     func(args []string) bool { return !hasFlag(args, 's', "--set") },
+	"dmesg":    func(args []string) bool { return !hasFlag(args, 'c', "--read-clear") && !hasFlag(args, 'C', "--clear") },
+	"sysctl": func(args []string) bool {
+		return !hasFlag(args, 'w', "--write") && !hasFlag(args, 'p', "--load") && !containsArg(args, "=")
+	},
+	"ip": func(args []string) bool {
+		return !hasAnyArg(args, "add", "del", "delete", "set", "flush", "change", "replace", "append", "exec")
+	},
+	"ifconfig": func(args []string) bool { return len(args) <= 1 },
+	"journalctl": func(args []string) bool {
+		return !hasAnyArg(args, "--rotate", "--flush", "--sync", "--relinquish-var", "--smart-relinquish-var") && !hasPrefixArg(args, "--vacuum")
+	},
+	"ping": func(args []string) bool { return hasFlag(args, 'c', "") },
+
+	// 子命令只读的工具
+	"systemctl": subcommands("status", "show", "cat", "list-units", "list-unit-files", "list-timers", "list-sockets", "is-active", "is-enabled", "is-failed"),
+	"docker":    subcommands("ps", "images", "inspect", "logs", "version", "info", "top", "port", "history"),
+	"podman":    subcommands("ps", "images", "inspect", "logs", "version", "info", "top", "port", "history"),
+	"kubectl":   subcommands("get", "describe", "logs", "top", "version", "explain", "api-resources"),
+	"git": func(args []string) bool {
+		// --output 写文件，-O 用指定的程序打开匹配的文件，--ext-diff 运行外部的diff程序
+		return subcommands("status", "log", "diff", "show", "rev-parse", "ls-files", "blame", "shortlog", "describe", "grep")(args) &&
+			!hasFlag(args, 'O', "--open-files-in-pager") && !hasFlag(args, 0, "--output") && !hasFlag(args, 0, "--ext-diff")
+	},
+
+	// Windows
+	"dir": nil, "tasklist": nil, "ipconfig": nil, "systeminfo": nil, "where": nil,
+	"get-childitem": nil, "get-content": nil, "get-process": nil, "get-service": nil, "get-item": nil,
+	"get-nettcpconnection": nil, "get-psdrive": nil, "get-date": nil, "select-string": nil,
+	"select-object": nil, "where-object": nil, "sort-object": nil, "format-table": nil, "format-list": nil,
+}
+
+// subcommands 返回只允许指定子命令的检查函数
+func subcommands(allowed ...string) func(args []string) bool {
+	return func(args []string) bool {
+		for _, a := range args {
+			if strings.HasPrefix(a, "-") {
+				continue
+			}
+			for _, s := range allowed {
+				if a == s {
+					return true
+				}
+			}
+			return false
+		}
+		return false
+	}
+}
+
+// ReadOnly 判断命令是否只读取信息而不改变系统状态，不是只读命令时返回原因
+// 命令中的每一条简单命令都必须是已知的只读程序，不能写文件、提权，并且安全分析的风险必须为低
+func ReadOnly(command string) (bool, string) {
+	commands := Parse(command)
+	if len(commands) == 0 {
+		return false, "empty command"
+	}
+	if report := Analyze(command); report.Risk != RiskLow {
+		return false, report.Explanation()
+	}
+
+	for _, c := range commands {
+		for _, w := range c.Wrappers() {
+			if w == "sudo" || w == "doas" || w == "watch" {
+				return false, fmt.Sprintf("%s is not allowed", w)
+			}
+		}
+		for _, redirect := range c.Redirects {
+			if strings.Contains(redirect.Op, ">") && !strings.HasPrefix(redirect.Target, "&") && redirect.Target != "/dev/null" {
+				return false, "writes to " + redirect.Target
+			}
+		}
+
+		program := c.Program()
+		if program == "" {
+			continue
+		}
+		check, ok := readOnlyPrograms[program]
+		if !ok {
+			return false, fmt.Sprintf("%s is not a known read-only command", program)
+		}
+		if check != nil && !check(c.ProgramArgs()[1:]) {
+			return false, fmt.Sprintf("%s is used with arguments that may change the system", program)
+		}
+	}
+	return true, ""
+}
+
+// countOperands 返回不是选项的参数的数量，valued 是带一个参数的选项，它们的参数不计算在内
+func countOperands(args []string, valued ...string) int {
+	count := 0
+	for i := 0; i < len(args); i++ {
+		switch a := args[i]; {
+		case hasAnyArg([]string{a}, valued...):
+			i++
+		case !strings.HasPrefix(a, "-") || a == "-":
+			count++
+		}
+	}
+	return count
+}
+
+// hasAnyArg 判断args中是否包含values中的任意一个
+func hasAnyArg(args []string, values ...string) bool {
+	for _, a := range args {
+		for _, v := range values {
+			if a == v {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// hasPrefixArg 判断args中是否有以prefix开头的参数
+func hasPrefixArg(args []string, prefix string) bool {
+	for _, a := range args {
+		if strings.HasPrefix(a, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// containsArg 判断args中是否有包含s的参数
+func containsArg(args []string, s string) bool {
+	for _, a := range args {
+		if strings.Contains(a, s) {
+			return true
+		}
+	}
+	return false
+}
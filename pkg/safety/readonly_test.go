@@ -0,0 +1,85 @@
+package safety
+
+import "testing"
+
+func TestReadOnly(t *testing.T) {
+	tests := []struct {
+		command string
+		want    bool
+	}{
+		{"lsof -i :8080", true},
+		{"ss -ltnp | grep 8080", true},
+		{"ps aux | grep -v grep | grep nginx | head -n 5", true},
+		{"cat /etc/os-release 2>/dev/null", true},
+		{"df -h && free -m", true},
+		{"git status && git log --oneline -5", true},
+		{"systemctl status nginx", true},
+		{"docker ps -a", true},
+		{"find . -name '*.log' -size +10M", true},
+		{"ls $(pwd)", true},
+		{"env", true},
+		{"ping -c 3 example.com", true},
+		{"rg -n TODO src", true},
+		{"git diff --stat", true},
+		{"tree -L 2", true},
+		{"xxd -l 64 file.bin", true},
+		{"Get-Process | Sort-Object CPU", true},
+		{"fuser -v 8080/tcp", true},
+		{"ss -tnp", true},
+		{"sort data.txt | uniq -c", true},
+		{"uniq -f 1 data.txt", true},
+		{"file -b /bin/ls", true},
+		{"tail -n 50 /var/log/syslog", true},
+
+		{"", false},
+		{"rm -rf /tmp/x", false},
+		{"kill -9 1234", false},
+		{"sudo lsof -i :8080", false},
+		{"ps aux > procs.txt", false},
+		{"echo hi >> ~/.bashrc", false},
+		{"find . -name '*.log' -delete", false},
+		{`find . -exec rm {} \;`, false},
+		{"sort -o out.txt in.txt", false},
+		{"git push", false},
+		{"git remote add origin url", false},
+		{"systemctl restart nginx", false},
+		{"docker rm web", false},
+		{"ip addr add 10.0.0.1/24 dev eth0", false},
+		{"sysctl -w net.ipv4.ip_forward=1", false},
+		{"date -s '2020-01-01'", false},
+		{"ls | xargs rm", false},
+		{"curl https://example.com", false},
+		{"ls $(rm -rf ~)", false},
+		{"sh -c 'touch x'", false},
+		{"ping example.com", false},
+		{"rg --pre ./evil.sh TODO", false},
+		{"rg --pre-glob '*.pdf' --pre=pdftotext x", false},
+		{"git diff --output=~/.bashrc", false},
+		{"git grep --open-files-in-pager=./x TODO", false},
+		{"git grep -O./x TODO", false},
+		{"git diff --ext-diff", false},
+		{"tree -o ~/.profile", false},
+		{"sort --compress-program=./x big.txt", false},
+		{"xxd -r dump ~/.bashrc", false},
+		{"xxd in.bin out.hex", false},
+		{"fuser -k 8080/tcp", false},
+		{"fuser -ki 8080/tcp", false},
+		{"ss -K dport = 8080", false},
+		{"ss --kill state established", false},
+		{"uniq in.txt out.txt", false},
+		{"uniq -c -f 1 in.txt out.txt", false},
+		{"file -C -m magic", false},
+		{"tail -f /var/log/syslog", false},
+		{"tail -n 20 -F app.log", false},
+		{"tail --follow=name app.log", false},
+	}
+	for _, tt := range tests {
+		got, reason := ReadOnly(tt.command)
+		if got != tt.want {
+			t.Errorf("ReadOnly(%q) = %v (%s), want %v", tt.command, got, reason, tt.want)
+		}
+		if !got && reason == "" {
+			t.Errorf("ReadOnly(%q) returned no reason", tt.command)
+		}
+	}
+}
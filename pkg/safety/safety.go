@@ -0,0 +1,392 @@
+package safety
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Level 是命令的风险等级
+type Level string
+
+// 风险等级，从低到高
+const (
+	RiskLow    Level = "low"
+	RiskMedium Level = "medium"
+	RiskHigh   Level = "high"
+)
+
+// rank 返回风险等级的大小，用于比较
+func (l Level) rank() int {
+	switch l {
+	case RiskHigh:
+		return 2
+	case RiskMedium:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// AtLeast 判断风险等级是否不低于other
+func (l Level) AtLeast(other Level) bool {
+	return l.rank() >= other.rank()
+}
+
+// Report 是对一条命令的安全分析结果
+type Report struct {
+	Risk    Level    `json:"risk"`
+	Reasons []string `json:"reasons,omitempty"`
+}
+
+// Explanation 返回分析结果的简短说明
+func (r *Report) Explanation() string {
+	if len(r.Reasons) == 0 {
+		return "no risky operations detected"
+	}
+	return strings.Join(r.Reasons, "; ")
+}
+
+// add 记录一条风险，风险等级取最高的一条
+func (r *Report) add(level Level, reason string) {
+	for _, existing := range r.Reasons {
+		if existing == reason {
+			return
+		}
+	}
+	r.Reasons = append(r.Reasons, reason)
+	if level.rank() > r.Risk.rank() {
+		r.Risk = level
+	}
+}
+
+// rule 检查一条简单命令，发现风险时记录到报告中
+type rule func(c SimpleCommand, r *Report)
+
+var rules = []rule{
+	checkUnknown,
+	checkDelete,
+	checkDisk,
+	checkPower,
+	checkPermissions,
+	checkPipeToShell,
+	checkModify,
+	checkPrivilege,
+	checkProcess,
+	checkPackages,
+	checkVCS,
+	checkServices,
+	checkWindows,
+}
+
+// forkBomb 匹配常见的fork炸弹写法
+var forkBomb = regexp.MustCompile(`:\s*\(\s*\)\s*\{\s*:\s*\|\s*:\s*&\s*\}\s*;\s*:`)
+
+// Analyze 对命令进行静态的安全分析，返回风险等级和原因
+func Analyze(command string) *Report {
+	r := &Report{Risk: RiskLow}
+	if forkBomb.MatchString(command) {
+		r.add(RiskHigh, "contains a fork bomb")
+	}
+	for _, c := range Parse(command) {
+		for _, check := range rules {
+			check(c, r)
+		}
+	}
+	return r
+}
+
+// criticalPaths 是删除或修改后会严重破坏系统的路径
+var criticalPaths = map[string]bool{
+	"/": true, "/*": true, "~": true, "~/*": true, "$HOME": true, "${HOME}": true, "*": true, ".": true, "..": true,
+	"/bin": true, "/boot": true, "/dev": true, "/etc": true, "/home": true, "/lib": true, "/opt": true,
+	"/root": true, "/sbin": true, "/sys": true, "/usr": true, "/var": true, "/System": true, "/Users": true,
+	"C:": true, `C:\`: true, "C:/": true, `C:\Windows`: true,
+}
+
+// IsCriticalPath 判断路径是否是系统关键目录
+func IsCriticalPath(p string) bool {
+	return criticalPaths[p] || criticalPaths[cleanPath(p)]
+}
+
+func checkUnknown(c SimpleCommand, r *Report) {
+	if c.Program() == UnknownProgram {
+		r.add(RiskHigh, "runs a program that cannot be determined: "+strings.Join(c.Args, " "))
+	}
+}
+
+func checkDelete(c SimpleCommand, r *Report) {
+	args := c.ProgramArgs()
+	switch c.Program() {
+	case "rm", "rmdir", "shred", "unlink":
+		recursive := hasFlag(args[1:], 'r', "--recursive") || hasFlag(args[1:], 'R', "")
+		for _, target := range operands(args[1:]) {
+			if IsCriticalPath(target) {
+				r.add(RiskHigh, "deletes a critical path: "+target)
+			}
+		}
+		if recursive {
+			r.add(RiskMedium, "deletes files recursively")
+		} else {
+			r.add(RiskMedium, "deletes files")
+		}
+		if hasFlag(args[1:], 'f', "--force") {
+			r.add(RiskMedium, "deletes without confirmation")
+		}
+	case "find":
+		for _, a := range args[1:] {
+			if a == "-delete" {
+				r.add(RiskMedium, "deletes the files it finds")
+			}
+			if a == "-exec" || a == "-execdir" {
+				r.add(RiskMedium, "runs a command for each file it finds")
+			}
+		}
+	}
+}
+
+func checkDisk(c SimpleCommand, r *Report) {
+	name := c.Program()
+	if strings.HasPrefix(name, "mkfs") || name == "fdisk" || name == "parted" || name == "wipefs" || name == "sfdisk" || name == "diskpart" {
+		r.add(RiskHigh, "formats or partitions disks")
+	}
+	if name == "dd" {
+		for _, a := range c.ProgramArgs()[1:] {
+			if strings.HasPrefix(a, "of=/dev/") {
+				r.add(RiskHigh, "writes directly to a device")
+			}
+		}
+	}
+	for _, redirect := range c.Redirects {
+		if strings.HasPrefix(redirect.Target, "/dev/") && !isHarmlessDevice(redirect.Target) && strings.Contains(redirect.Op, ">") {
+			r.add(RiskHigh, "writes directly to a device")
+		}
+	}
+}
+
+func isHarmlessDevice(target string) bool {
+	switch target {
+	case "/dev/null", "/dev/stdout", "/dev/stderr", "/dev/tty":
+		return true
+	}
+	return false
+}
+
+func checkPower(c SimpleCommand, r *Report) {
+	args := c.ProgramArgs()
+	switch c.Program() {
+	case "shutdown", "reboot", "halt", "poweroff":
+		r.add(RiskHigh, "shuts down or reboots the system")
+	case "init":
+		if len(args) > 1 && (args[1] == "0" || args[1] == "6") {
+			r.add(RiskHigh, "shuts down or reboots the system")
+		}
+	case "systemctl":
+		if len(args) > 1 && (args[1] == "poweroff" || args[1] == "reboot" || args[1] == "halt") {
+			r.add(RiskHigh, "shuts down or reboots the system")
+		}
+	}
+}
+
+func checkPermissions(c SimpleCommand, r *Report) {
+	args := c.ProgramArgs()
+	switch c.Program() {
+	case "chmod", "chown", "chgrp", "chattr", "setfacl":
+		r.add(RiskMedium, "changes file permissions or ownership")
+		if hasFlag(args[1:], 'R', "--recursive") {
+			for _, target := range operands(args[1:]) {
+				if IsCriticalPath(target) {
+					r.add(RiskHigh, "recursively changes permissions of a critical path: "+target)
+				}
+			}
+		}
+	}
+}
+
+func checkPipeToShell(c SimpleCommand, r *Report) {
+	if !c.PipedFrom {
+		return
+	}
+	switch c.Program() {
+	case "sh", "bash", "zsh", "dash", "ksh", "fish", "python", "python3", "perl", "ruby", "node", "iex", "invoke-expression":
+		r.add(RiskHigh, "pipes content into an interpreter")
+	}
+}
+
+func checkModify(c SimpleCommand, r *Report) {
+	args := c.ProgramArgs()
+	switch c.Program() {
+	case "mv", "truncate":
+		r.add(RiskMedium, "moves or overwrites files")
+	case "cp", "install", "rsync":
+		r.add(RiskMedium, "copies files, possibly overwriting existing ones")
+	case "sed", "perl":
+		if hasFlag(args[1:], 'i', "--in-place") {
+			r.add(RiskMedium, "edits files in place")
+		}
+	case "tee":
+		r.add(RiskMedium, "writes to files")
+	case "ln":
+		if hasFlag(args[1:], 'f', "--force") {
+			r.add(RiskMedium, "replaces existing files with links")
+		}
+	case "curl", "wget":
+		if hasFlag(args[1:], 'o', "--output") || hasFlag(args[1:], 'O', "--remote-name") {
+			r.add(RiskMedium, "downloads files")
+		}
+	}
+	for _, redirect := range c.Redirects {
+		if strings.Contains(redirect.Op, ">") && !strings.HasPrefix(redirect.Target, "&") && !strings.HasPrefix(redirect.Target, "/dev/") {
+			r.add(RiskMedium, "writes to a file with redirection: "+redirect.Target)
+		}
+	}
+}
+
+func checkPrivilege(c SimpleCommand, r *Report) {
+	if escalation(c) != "" {
+		r.add(RiskMedium, "runs with elevated privileges")
+	}
+}
+
+// Escalation 返回命令中用于提权的程序，比如sudo，没有提权时返回空字符串
+func Escalation(command string) string {
+	for _, c := range Parse(command) {
+		if program := escalation(c); program != "" {
+			return program
+		}
+	}
+	return ""
+}
+
+func escalation(c SimpleCommand) string {
+	for _, w := range c.Wrappers() {
+		if w == "sudo" || w == "doas" || w == "pkexec" {
+			return w
+		}
+	}
+	switch program := c.Program(); program {
+	case "su", "runuser", "runas":
+		return program
+	}
+	return ""
+}
+
+// Undetermined 返回命令中第一条无法确定实际执行程序的简单命令，比如包装程序的选项无法识别或者程序名称来自变量，
+// 这样的命令也可能提权，没有时返回空字符串
+func Undetermined(command string) string {
+	for _, c := range Parse(command) {
+		if c.Program() == UnknownProgram {
+			return strings.Join(c.Args, " ")
+		}
+	}
+	return ""
+}
+
+func checkProcess(c SimpleCommand, r *Report) {
+	switch c.Program() {
+	case "kill", "pkill", "killall", "taskkill", "stop-process":
+		r.add(RiskMedium, "terminates processes")
+	}
+}
+
+func checkPackages(c SimpleCommand, r *Report) {
+	args := c.ProgramArgs()
+	if len(args) < 2 {
+		return
+	}
+	switch c.Program() {
+	case "apt", "apt-get", "yum", "dnf", "zypper", "pacman", "apk", "brew", "pip", "pip3", "npm", "pnpm", "yarn", "gem", "cargo", "choco", "winget", "snap":
+		switch args[1] {
+		case "install", "remove", "uninstall", "purge", "upgrade", "update", "-S", "-R", "-Syu", "add", "del", "autoremove":
+			r.add(RiskMedium, "installs or removes packages")
+		}
+	}
+}
+
+func checkVCS(c SimpleCommand, r *Report) {
+	args := c.ProgramArgs()
+	if c.Program() != "git" || len(args) < 2 {
+		return
+	}
+	switch args[1] {
+	case "push":
+		if hasFlag(args[2:], 'f', "--force") || hasFlag(args[2:], 0, "--force-with-lease") {
+			r.add(RiskMedium, "force pushes and may overwrite remote history")
+		}
+	case "reset":
+		if hasFlag(args[2:], 0, "--hard") {
+			r.add(RiskMedium, "discards local changes")
+		}
+	case "clean":
+		if hasFlag(args[2:], 'f', "--force") {
+			r.add(RiskMedium, "deletes untracked files")
+		}
+	case "checkout", "restore":
+		if len(args) > 2 && (args[2] == "." || args[2] == "--") {
+			r.add(RiskMedium, "discards local changes")
+		}
+	}
+}
+
+func checkServices(c SimpleCommand, r *Report) {
+	args := c.ProgramArgs()
+	if len(args) < 2 {
+		return
+	}
+	switch c.Program() {
+	case "systemctl", "service", "launchctl":
+		for _, a := range args[1:] {
+			switch a {
+			case "stop", "restart", "disable", "mask", "unload", "bootout":
+				r.add(RiskMedium, "stops or changes system services")
+				return
+			}
+		}
+	case "docker", "podman":
+		switch args[1] {
+		case "rm", "rmi", "kill", "stop", "prune", "system", "volume":
+			r.add(RiskMedium, "removes or stops containers or images")
+		}
+	case "kubectl":
+		switch args[1] {
+		case "delete", "drain", "cordon", "scale", "apply", "replace", "patch":
+			r.add(RiskMedium, "changes cluster resources")
+		}
+	}
+}
+
+func checkWindows(c SimpleCommand, r *Report) {
+	args := c.ProgramArgs()
+	lower := make([]string, len(args))
+	for i, a := range args {
+		lower[i] = strings.ToLower(a)
+	}
+	has := func(flag string) bool {
+		for _, a := range lower[1:] {
+			if a == flag {
+				return true
+			}
+		}
+		return false
+	}
+
+	switch c.Program() {
+	case "format":
+		r.add(RiskHigh, "formats or partitions disks")
+	case "del", "erase", "rd", "rmdir":
+		if has("/s") {
+			r.add(RiskMedium, "deletes files recursively")
+		} else {
+			r.add(RiskMedium, "deletes files")
+		}
+	case "remove-item", "ri":
+		if has("-recurse") {
+			r.add(RiskMedium, "deletes files recursively")
+		} else {
+			r.add(RiskMedium, "deletes files")
+		}
+	case "stop-computer", "restart-computer":
+		r.add(RiskHigh, "shuts down or reboots the system")
+	case "format-volume", "clear-disk":
+		r.add(RiskHigh, "formats or partitions disks")
+	}
+}
@@ -0,0 +1,140 @@
+package safety
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAnalyze(t *testing.T) {
+	testCases := []struct {
+		command string
+		risk    Level
+		reason  string
+	}{
+		{"ls -la", RiskLow, ""},
+		{"du -sh * | sort -h", RiskLow, ""},
+		{"grep -r TODO . 2>/dev/null", RiskLow, ""},
+		{"rm old.log", RiskMedium, "deletes files"},
+		{"rm -rf ./build", RiskMedium, "deletes files recursively"},
+		{"sudo rm -rf /", RiskHigh, "deletes a critical path: /"},
+		{"rm -rf ~/", RiskHigh, "deletes a critical path"},
+		{"find . -name '*.tmp' -delete", RiskMedium, "deletes the files it finds"},
+		{"mkfs.ext4 /dev/sdb1", RiskHigh, "formats or partitions disks"},
+		{"dd if=/dev/zero of=/dev/sda", RiskHigh, "writes directly to a device"},
+		{"echo hi > /dev/sda", RiskHigh, "writes directly to a device"},
+		{":(){ :|:& };:", RiskHigh, "fork bomb"},
+		{"sudo reboot", RiskHigh, "shuts down or reboots the system"},
+		{"chmod -R 777 /", RiskHigh, "recursively changes permissions"},
+		{"curl -fsSL https://example.com/install.sh | bash", RiskHigh, "pipes content into an interpreter"},
+		{"echo test > out.txt", RiskMedium, "writes to a file with redirection: out.txt"},
+		{"sed -i 's/a/b/' file.txt", RiskMedium, "edits files in place"},
+		{"sudo apt install htop", RiskMedium, "installs or removes packages"},
+		{"git push --force origin main", RiskMedium, "force pushes"},
+		{"git reset --hard HEAD~1", RiskMedium, "discards local changes"},
+		{"kubectl delete pod web-1", RiskMedium, "changes cluster resources"},
+		{"kill -9 1234", RiskMedium, "terminates processes"},
+		{`bash -c "rm -rf /"`, RiskHigh, "deletes a critical path"},
+		{`bash -lc "rm -rf /"`, RiskHigh, "deletes a critical path"},
+		{"sudo -u root rm -rf /", RiskHigh, "deletes a critical path: /"},
+		{"nice -n 10 rm -rf /", RiskHigh, "deletes a critical path: /"},
+		{"timeout -s KILL 5 rm -rf /", RiskHigh, "deletes a critical path: /"},
+		{"sudo --bogus-option whatever", RiskHigh, "runs a program that cannot be determined"},
+		{"echo $(rm -rf /)", RiskHigh, "deletes a critical path"},
+		{"(rm -rf /)", RiskHigh, "deletes a critical path: /"},
+		{"{ rm -rf /; }", RiskHigh, "deletes a critical path: /"},
+		{"if true; then rm -rf /; fi", RiskHigh, "deletes a critical path: /"},
+		{"for f in *; do rm -rf /; done", RiskHigh, "deletes a critical path: /"},
+		{"! rm -rf /", RiskHigh, "deletes a critical path: /"},
+		{"case x in x) rm -rf /;; esac", RiskHigh, "deletes a critical path: /"},
+		{"cat <(rm -rf ~)", RiskHigh, "deletes a critical path: ~"},
+		{"tee >(rm -rf /) < in.txt", RiskHigh, "deletes a critical path: /"},
+		{`eval "rm -rf /"`, RiskHigh, "deletes a critical path: /"},
+		{`su -c "rm -rf /"`, RiskHigh, "deletes a critical path: /"},
+		{`runuser -u root -c "rm -rf /"`, RiskHigh, "deletes a critical path: /"},
+		{"busybox rm -rf /", RiskHigh, "deletes a critical path: /"},
+		{"$(echo rm) -rf /", RiskHigh, "runs a program that cannot be determined"},
+		{"Remove-Item -Recurse -Force C:\\temp", RiskMedium, "deletes files recursively"},
+		{"format C: /q", RiskHigh, "formats or partitions disks"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.command, func(t *testing.T) {
+			report := Analyze(tc.command)
+			if report.Risk != tc.risk {
+				t.Errorf("Risk = %s, want %s (reasons: %v)", report.Risk, tc.risk, report.Reasons)
+			}
+			if tc.reason != "" && !strings.Contains(report.Explanation(), tc.reason) {
+				t.Errorf("Expected reason %q, got %q", tc.reason, report.Explanation())
+			}
+		})
+	}
+}
+
+func TestEscalation(t *testing.T) {
+	tests := map[string]string{
+		"ls -la":                "",
+		"sudo -u postgres psql": "sudo",
+		"cd /srv && doas rc-service nginx restart": "doas",
+		"echo $(pkexec cat /etc/shadow)":           "pkexec",
+		"su - root -c whoami":                      "su",
+		`bash -c "sudo reboot"`:                    "sudo",
+		"grep sudo /var/log/auth.log":              "",
+		"timeout 5 sudo rm -rf /var/lib/x":         "sudo",
+		"env FOO=1 sudo id":                        "sudo",
+		"nice -n 10 sudo id":                       "sudo",
+		"bash -lc 'sudo id'":                       "sudo",
+		"while true; do sudo reboot; done":         "sudo",
+		"(sudo reboot)":                            "sudo",
+		"{ sudo reboot; }":                         "sudo",
+		"if true; then doas reboot; fi":            "doas",
+		"cat <(sudo cat /etc/shadow)":              "sudo",
+		`eval "sudo reboot"`:                       "sudo",
+		"busybox su -c reboot":                     "su",
+		"runuser -u postgres -- psql":              "runuser",
+		"$(echo sudo) reboot":                      "",
+	}
+	for command, want := range tests {
+		if got := Escalation(command); got != want {
+			t.Errorf("Escalation(%q) = %q, want %q", command, got, want)
+		}
+	}
+
+	for command, want := range map[string]string{
+		"ls -la":                  "",
+		"$(echo sudo) reboot":     "$(echo sudo) reboot",
+		"sudo --bogus reboot":     "sudo --bogus reboot",
+		"ls; $CMD /etc/shadow":    "$CMD /etc/shadow",
+		"while true; do ls; done": "",
+	} {
+		if got := Undetermined(command); got != want {
+			t.Errorf("Undetermined(%q) = %q, want %q", command, got, want)
+		}
+	}
+}
+
+func TestLevel(t *testing.T) {
+	if !RiskHigh.AtLeast(RiskMedium) || RiskLow.AtLeast(RiskMedium) || !RiskMedium.AtLeast(RiskMedium) {
+		t.Error("Unexpected level ordering")
+	}
+}
+
+func TestSanitize(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected string
+	}{
+		{"ls -la", "ls -la"},
+		{"  ls -la\n", "ls -la"},
+		{"```bash\nls -la\n```", "ls -la"},
+		{"```\nls -la\n```", "ls -la"},
+		{"`ls -la`", "ls -la"},
+		{"$ ls -la", "ls -la"},
+		{"echo `date`", "echo `date`"},
+	}
+
+	for _, tc := range testCases {
+		if got := Sanitize(tc.input); got != tc.expected {
+			t.Errorf("Sanitize(%q) = %q, want %q", tc.input, got, tc.expected)
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package safety
+
+import (
+	"strings"
+)
+
+// Sanitize 清理模型返回的命令，去掉markdown代码块、包裹的反引号和提示符
+func Sanitize(response string) string {
+	s := strings.TrimSpace(response)
+
+	// ```bash\ncommand\n```
+	if strings.HasPrefix(s, "```") {
+		s = strings.TrimPrefix(s, "```")
+		if i := strings.Index(s, "\n"); i >= 0 {
+			// 去掉代码块的语言标记
+			if lang := strings.TrimSpace(s[:i]); !strings.Contains(lang, " ") {
+				s = s[i+1:]
+			}
+		}
+		if i := strings.LastIndex(s, "```"); i >= 0 {
+			s = s[:i]
+		}
+		s = strings.TrimSpace(s)
+	}
+
+	// `command`
+	if len(s) >= 2 && strings.HasPrefix(s, "`") && strings.HasSuffix(s, "`") && !strings.Contains(s[1:len(s)-1], "`") {
+		s = strings.TrimSpace(s[1 : len(s)-1])
+	}
+
+	// $ command
+	if strings.HasPrefix(s, "$ ") && !strings.Contains(s, "\n") {
+		s = strings.TrimSpace(s[2:])
+	}
+
+	return s
+}
@@ -0,0 +1,75 @@
+package sandbox
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// 沙箱默认的资源限制
+const (
+	DefaultCPUTime = time.Minute
+	DefaultMemory  = 2 << 30
+)
+
+// ErrUnsupported 表示当前系统不支持沙箱
+var ErrUnsupported = errors.New("the sandbox is only supported on Linux")
+
+// Sandbox 是使用 bubblewrap 隔离命令的执行环境：
+// 除了 Dir 之外整个文件系统只读，/tmp 是空的临时目录，没有网络，并通过 ulimit 限制CPU时间和内存
+type Sandbox struct {
+	// Dir 是命令的工作目录，也是唯一可写的目录
+	Dir string
+	// CPUTime 是命令可以使用的CPU时间，为0时不限制
+	CPUTime time.Duration
+	// Memory 是命令可以使用的虚拟内存字节数，为0时不限制
+	Memory int64
+
+	bwrap string
+}
+
+// New 检查系统是否支持沙箱，并返回以dir为工作目录、使用默认资源限制的沙箱
+func New(dir string) (*Sandbox, error) {
+	bwrap, err := lookup()
+	if err != nil {
+		return nil, err
+	}
+	dir, err = filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	return &Sandbox{Dir: dir, CPUTime: DefaultCPUTime, Memory: DefaultMemory, bwrap: bwrap}, nil
+}
+
+// Wrapper 返回在沙箱中运行shell的命令前缀，用于 executor.ShellExecutor 的 Wrapper
+func (s *Sandbox) Wrapper() []string {
+	return []string{
+		s.bwrap,
+		"--ro-bind", "/", "/",
+		"--dev", "/dev",
+		"--proc", "/proc",
+		"--tmpfs", "/tmp",
+		"--bind", s.Dir, s.Dir,
+		"--chdir", s.Dir,
+		// 隔离网络、进程和IPC，aic退出时终止命令，并防止命令向终端注入输入
+		"--unshare-all",
+		"--die-with-parent",
+		"--new-session",
+		"--",
+		"sh", "-c", s.limits() + `exec "$@"`, "aic-sandbox",
+	}
+}
+
+// limits 返回设置资源限制的shell命令
+func (s *Sandbox) limits() string {
+	var b strings.Builder
+	if s.CPUTime > 0 {
+		fmt.Fprintf(&b, "ulimit -t %d && ", int64((s.CPUTime+time.Second-1)/time.Second))
+	}
+	if s.Memory > 0 {
+		fmt.Fprintf(&b, "ulimit -v %d && ", (s.Memory+1023)/1024)
+	}
+	return b.String()
+}
@@ -0,0 +1,27 @@
+//go:build linux
+
+package sandbox
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// lookup 查找 bwrap，并确认内核允许它创建沙箱需要的命名空间
+func lookup() (string, error) {
+	bwrap, err := exec.LookPath("bwrap")
+	if err != nil {
+		return "", fmt.Errorf("the sandbox requires bubblewrap (bwrap), install it with your package manager")
+	}
+	// #nosec G204 -- bwrap is looked up in PATH with fixed arguments
+	out, err := exec.Command(bwrap, "--ro-bind", "/", "/", "--unshare-all", "--", "true").CombinedOutput()
+	if err != nil {
+		msg := strings.TrimSpace(string(out))
+		if msg == "" {
+			msg = err.Error()
+		}
+		return "", fmt.Errorf("the sandbox is not supported on this system, unprivileged user namespaces may be disabled: %s", msg)
+	}
+	return bwrap, nil
+}
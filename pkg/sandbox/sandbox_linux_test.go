@@ -0,0 +1,38 @@
+//go:build linux
+
+package sandbox
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNew(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("PATH", dir)
+	if _, err := New("."); err == nil || !strings.Contains(err.Error(), "requires bubblewrap") {
+		t.Errorf("Expected an error without bwrap, got %v", err)
+	}
+
+	// bwrap fails when the kernel does not allow user namespaces
+	failing := "#!/bin/sh\necho 'bwrap: No permissions to creating new namespace' >&2\nexit 1\n"
+	if err := os.WriteFile(filepath.Join(dir, "bwrap"), []byte(failing), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := New("."); err == nil || !strings.Contains(err.Error(), "No permissions to creating new namespace") {
+		t.Errorf("Expected the bwrap error, got %v", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "bwrap"), []byte("#!/bin/sh\nexit 0\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	s, err := New(".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !filepath.IsAbs(s.Dir) || s.CPUTime != DefaultCPUTime || s.Memory != DefaultMemory || s.Wrapper()[0] != filepath.Join(dir, "bwrap") {
+		t.Errorf("Unexpected sandbox: %+v", s)
+	}
+}
@@ -0,0 +1,8 @@
+//go:build !linux
+
+package sandbox
+
+// lookup 在Linux以外的系统上不支持
+func lookup() (string, error) {
+	return "", ErrUnsupported
+}
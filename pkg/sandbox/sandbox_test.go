@@ -0,0 +1,56 @@
+package sandbox
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/LubyRuffy/aic/pkg/executor"
+	"github.com/LubyRuffy/aic/pkg/shell"
+)
+
+// fakeBwrap ignores the isolation options and runs the command after "--"
+const fakeBwrap = `#!/bin/sh
+while [ $# -gt 0 ] && [ "$1" != "--" ]; do shift; done
+shift
+exec "$@"
+`
+
+func TestWrapper(t *testing.T) {
+	s := &Sandbox{Dir: "/work", CPUTime: 90 * time.Second, Memory: 1 << 30, bwrap: "bwrap"}
+	args := strings.Join(s.Wrapper(), " ")
+	for _, want := range []string{"bwrap --ro-bind / / ", "--bind /work /work --chdir /work", "--unshare-all", `-- sh -c ulimit -t 90 && ulimit -v 1048576 && exec "$@" aic-sandbox`} {
+		if !strings.Contains(args, want) {
+			t.Errorf("Expected %q in %s", want, args)
+		}
+	}
+
+	s.CPUTime, s.Memory = 0, 0
+	if args := s.Wrapper(); args[len(args)-2] != `exec "$@"` {
+		t.Errorf("Expected no limits, got %v", args)
+	}
+}
+
+func TestExecuteLimits(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake bwrap is a shell script")
+	}
+	dir := t.TempDir()
+	bwrap := filepath.Join(dir, "bwrap")
+	if err := os.WriteFile(bwrap, []byte(fakeBwrap), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	// The limits are applied to the shell running the command
+	s := &Sandbox{Dir: dir, CPUTime: 90 * time.Second, Memory: 1 << 30, bwrap: bwrap}
+	sh, _ := shell.Lookup("sh")
+	exec := &executor.ShellExecutor{Shell: &sh, Wrapper: s.Wrapper(), Stderr: &bytes.Buffer{}, CaptureLimit: 64}
+	result, err := exec.Execute("ulimit -t; ulimit -v")
+	if err != nil || result.Stdout != "90\n1048576\n" {
+		t.Errorf("Unexpected result %+v, %v", result, err)
+	}
+}
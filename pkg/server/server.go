@@ -0,0 +1,271 @@
+package server
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/LubyRuffy/aic/pkg/executor"
+	"github.com/LubyRuffy/aic/pkg/pipeline"
+	"github.com/LubyRuffy/aic/pkg/safety"
+)
+
+// maxRequestBody 是请求体的最大字节数
+const maxRequestBody = 1 << 20
+
+// Backend 实现服务端的生成、解释和执行，CLI提供与命令行相同的实现
+type Backend interface {
+	Generate(model, prompt string) (*pipeline.Result, error)
+	Explain(model, command string) (*pipeline.Explanation, error)
+	Execute(result *pipeline.Result) (*executor.ExecResult, error)
+}
+
+// Server 是aic的本地HTTP API
+type Server struct {
+	Backend Backend
+	// Model 是请求中没有指定模型时使用的模型
+	Model string
+	// AllowExecute 为true时开放执行命令的接口，必须同时设置Token
+	AllowExecute bool
+	// Token 是执行命令的接口要求的Bearer token
+	Token string
+	// MaxConcurrent 是同时处理的请求数，超出时返回503，0表示不限制
+	MaxConcurrent int
+	// Logger 记录每个请求，为空时不记录
+	Logger *log.Logger
+}
+
+// GenerateRequest 是 /v1/generate 的请求
+type GenerateRequest struct {
+	Prompt string `json:"prompt"`
+	Model  string `json:"model,omitempty"`
+}
+
+// ExplainRequest 是 /v1/explain 的请求
+type ExplainRequest struct {
+	Command string `json:"command"`
+	Model   string `json:"model,omitempty"`
+}
+
+// ExecuteRequest 是 /v1/execute 的请求，prompt和command二选一
+type ExecuteRequest struct {
+	Prompt  string `json:"prompt,omitempty"`
+	Command string `json:"command,omitempty"`
+	Model   string `json:"model,omitempty"`
+	// Yes 为true时执行高风险命令，与CLI的 -yes 相同
+	Yes bool `json:"yes,omitempty"`
+}
+
+// ExecuteResponse 是 /v1/execute 的响应，在生成结果的基础上附加执行结果
+type ExecuteResponse struct {
+	*pipeline.Result
+	ExitCode       int    `json:"exit_code"`
+	Stdout         string `json:"stdout"`
+	Stderr         string `json:"stderr"`
+	TimedOut       bool   `json:"timed_out,omitempty"`
+	ExecDurationMs int64  `json:"exec_duration_ms"`
+}
+
+// ErrorResponse 是出错时的响应
+type ErrorResponse struct {
+	Error string `json:"error"`
+	// Result 是被拒绝执行的命令的分析结果
+	Result *pipeline.Result `json:"result,omitempty"`
+}
+
+// Handler 返回处理所有接口的 http.Handler
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/health", s.handleHealth)
+	mux.HandleFunc("/v1/generate", s.handleGenerate)
+	mux.HandleFunc("/v1/explain", s.handleExplain)
+	mux.HandleFunc("/v1/execute", s.handleExecute)
+	return s.logRequests(s.limit(mux))
+}
+
+func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{"status": "ok", "execute": s.AllowExecute})
+}
+
+func (s *Server) handleGenerate(w http.ResponseWriter, r *http.Request) {
+	var req GenerateRequest
+	if !decode(w, r, &req) {
+		return
+	}
+	if strings.TrimSpace(req.Prompt) == "" {
+		writeError(w, http.StatusBadRequest, "prompt is required")
+		return
+	}
+
+	result, err := s.Backend.Generate(s.model(req.Model), req.Prompt)
+	if err != nil {
+		writeError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+func (s *Server) handleExplain(w http.ResponseWriter, r *http.Request) {
+	var req ExplainRequest
+	if !decode(w, r, &req) {
+		return
+	}
+	if strings.TrimSpace(req.Command) == "" {
+		writeError(w, http.StatusBadRequest, "command is required")
+		return
+	}
+
+	explanation, err := s.Backend.Explain(s.model(req.Model), req.Command)
+	if err != nil {
+		writeError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, explanation)
+}
+
+func (s *Server) handleExecute(w http.ResponseWriter, r *http.Request) {
+	if !s.AllowExecute {
+		writeError(w, http.StatusForbidden, "command execution is disabled, start the server with --allow-execute")
+		return
+	}
+	if !s.authorized(r) {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		writeError(w, http.StatusUnauthorized, "invalid or missing token")
+		return
+	}
+
+	var req ExecuteRequest
+	if !decode(w, r, &req) {
+		return
+	}
+	model := s.model(req.Model)
+
+	var result *pipeline.Result
+	switch {
+	case strings.TrimSpace(req.Command) != "" && strings.TrimSpace(req.Prompt) == "":
+		result = pipeline.NewResult("", model, req.Command, 0)
+	case strings.TrimSpace(req.Prompt) != "" && strings.TrimSpace(req.Command) == "":
+		var err error
+		if result, err = s.Backend.Generate(model, req.Prompt); err != nil {
+			writeError(w, http.StatusBadGateway, err.Error())
+			return
+		}
+	default:
+		writeError(w, http.StatusBadRequest, "exactly one of prompt and command is required")
+		return
+	}
+
+	if result.Risk.AtLeast(safety.RiskHigh) && !req.Yes {
+		writeJSON(w, http.StatusForbidden, ErrorResponse{
+			Error:  fmt.Sprintf("refusing to execute a %s risk command without \"yes\": %s", result.Risk, result.Explanation),
+			Result: result,
+		})
+		return
+	}
+
+	execResult, err := s.Backend.Execute(result)
+	var exitErr *executor.ExitError
+	if err != nil && !errors.As(err, &exitErr) {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: err.Error(), Result: result})
+		return
+	}
+
+	resp := &ExecuteResponse{Result: result}
+	if execResult != nil {
+		resp.ExitCode = execResult.ExitCode
+		resp.Stdout = execResult.Stdout
+		resp.Stderr = execResult.Stderr
+		resp.TimedOut = execResult.TimedOut
+		resp.ExecDurationMs = execResult.Duration.Milliseconds()
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// model 返回请求使用的模型
+func (s *Server) model(model string) string {
+	if model != "" {
+		return model
+	}
+	return s.Model
+}
+
+// authorized 检查请求的Bearer token
+func (s *Server) authorized(r *http.Request) bool {
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return s.Token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(s.Token)) == 1
+}
+
+// limit 限制同时处理的请求数
+func (s *Server) limit(next http.Handler) http.Handler {
+	if s.MaxConcurrent <= 0 {
+		return next
+	}
+	sem := make(chan struct{}, s.MaxConcurrent)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case sem <- struct{}{}:
+			defer func() { <-sem }()
+			next.ServeHTTP(w, r)
+		default:
+			w.Header().Set("Retry-After", "1")
+			writeError(w, http.StatusServiceUnavailable, "too many concurrent requests")
+		}
+	})
+}
+
+// statusWriter 记录响应的状态码
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// logRequests 记录每个请求的方法、路径、状态码和耗时
+func (s *Server) logRequests(next http.Handler) http.Handler {
+	if s.Logger == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(sw, r)
+		s.Logger.Printf("%s %s %s %d %s", r.RemoteAddr, r.Method, r.URL.Path, sw.status, time.Since(start).Round(time.Millisecond))
+	})
+}
+
+// decode 解析POST请求的JSON请求体，失败时写入错误响应并返回false
+func decode(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return false
+	}
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestBody))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request: "+err.Error())
+		return false
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	_ = enc.Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, ErrorResponse{Error: message})
+}
@@ -0,0 +1,209 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/LubyRuffy/aic/pkg/executor"
+	"github.com/LubyRuffy/aic/pkg/pipeline"
+)
+
+// fakeBackend generates response for every prompt and records executed commands
+type fakeBackend struct {
+	response string
+	block    chan struct{}
+
+	mu       sync.Mutex
+	models   []string
+	executed []string
+}
+
+func (b *fakeBackend) Generate(model, prompt string) (*pipeline.Result, error) {
+	if b.block != nil {
+		<-b.block
+	}
+	b.mu.Lock()
+	b.models = append(b.models, model)
+	b.mu.Unlock()
+	if b.response == "" {
+		return nil, errors.New("model not found")
+	}
+	return pipeline.NewResult(prompt, model, b.response, time.Millisecond), nil
+}
+
+func (b *fakeBackend) Explain(model, command string) (*pipeline.Explanation, error) {
+	return &pipeline.Explanation{Command: command, Model: model, Description: "Lists files."}, nil
+}
+
+func (b *fakeBackend) Execute(result *pipeline.Result) (*executor.ExecResult, error) {
+	b.mu.Lock()
+	b.executed = append(b.executed, result.Command)
+	b.mu.Unlock()
+	if result.Command == "false" {
+		r := &executor.ExecResult{ExitCode: 1}
+		return r, &executor.ExitError{Result: r}
+	}
+	return &executor.ExecResult{Stdout: "ok\n"}, nil
+}
+
+func post(t *testing.T, url, token, body string) (int, map[string]interface{}) {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodPost, url, strings.NewReader(body))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var v map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&v); err != nil {
+		t.Fatalf("Expected JSON response: %v", err)
+	}
+	return resp.StatusCode, v
+}
+
+func TestGenerate(t *testing.T) {
+	backend := &fakeBackend{response: "df -h"}
+	var logs bytes.Buffer
+	s := &Server{Backend: backend, Model: "default", Logger: log.New(&logs, "", 0)}
+	ts := httptest.NewServer(s.Handler())
+	defer ts.Close()
+
+	status, v := post(t, ts.URL+"/v1/generate", "", `{"prompt": "show disk usage"}`)
+	if status != http.StatusOK || v["command"] != "df -h" || v["model"] != "default" || v["risk"] != "low" || v["prompt"] != "show disk usage" {
+		t.Errorf("Unexpected response %d: %v", status, v)
+	}
+	if status, _ := post(t, ts.URL+"/v1/generate", "", `{"prompt": "x", "model": "other"}`); status != http.StatusOK || backend.models[1] != "other" {
+		t.Errorf("Expected the requested model, got %d %v", status, backend.models)
+	}
+
+	for body, want := range map[string]int{
+		`{"prompt": ""}`:    http.StatusBadRequest,
+		`{"prompt": 1}`:     http.StatusBadRequest,
+		`{"unknown": "x"}`:  http.StatusBadRequest,
+		`not json`:          http.StatusBadRequest,
+		`{"prompt": "xyz"}`: http.StatusOK,
+	} {
+		if status, _ := post(t, ts.URL+"/v1/generate", "", body); status != want {
+			t.Errorf("POST %s = %d, want %d", body, status, want)
+		}
+	}
+
+	resp, err := http.Get(ts.URL + "/v1/generate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("GET = %d, want %d", resp.StatusCode, http.StatusMethodNotAllowed)
+	}
+
+	backend.response = ""
+	if status, v := post(t, ts.URL+"/v1/generate", "", `{"prompt": "x"}`); status != http.StatusBadGateway || v["error"] != "model not found" {
+		t.Errorf("Unexpected error response %d: %v", status, v)
+	}
+
+	if !strings.Contains(logs.String(), "POST /v1/generate 200") || !strings.Contains(logs.String(), "GET /v1/generate 405") {
+		t.Errorf("Unexpected request log: %s", logs.String())
+	}
+}
+
+func TestExplain(t *testing.T) {
+	ts := httptest.NewServer((&Server{Backend: &fakeBackend{}, Model: "default"}).Handler())
+	defer ts.Close()
+
+	status, v := post(t, ts.URL+"/v1/explain", "", `{"command": "ls -la"}`)
+	if status != http.StatusOK || v["command"] != "ls -la" || v["description"] != "Lists files." {
+		t.Errorf("Unexpected response %d: %v", status, v)
+	}
+	if status, _ := post(t, ts.URL+"/v1/explain", "", `{}`); status != http.StatusBadRequest {
+		t.Errorf("Expected %d without a command, got %d", http.StatusBadRequest, status)
+	}
+}
+
+func TestExecute(t *testing.T) {
+	backend := &fakeBackend{response: "ls"}
+	s := &Server{Backend: backend, Model: "default"}
+	ts := httptest.NewServer(s.Handler())
+	defer ts.Close()
+
+	if status, _ := post(t, ts.URL+"/v1/execute", "secret", `{"command": "ls"}`); status != http.StatusForbidden {
+		t.Errorf("Expected execution to be disabled, got %d", status)
+	}
+
+	s.AllowExecute = true
+	s.Token = "secret"
+	ts = httptest.NewServer(s.Handler())
+	defer ts.Close()
+
+	for _, token := range []string{"", "wrong"} {
+		if status, _ := post(t, ts.URL+"/v1/execute", token, `{"command": "ls"}`); status != http.StatusUnauthorized {
+			t.Errorf("Expected %d for token %q, got %d", http.StatusUnauthorized, token, status)
+		}
+	}
+
+	status, v := post(t, ts.URL+"/v1/execute", "secret", `{"prompt": "list files"}`)
+	if status != http.StatusOK || v["command"] != "ls" || v["stdout"] != "ok\n" || v["exit_code"] != 0.0 {
+		t.Errorf("Unexpected response %d: %v", status, v)
+	}
+	status, v = post(t, ts.URL+"/v1/execute", "secret", `{"command": "false"}`)
+	if status != http.StatusOK || v["exit_code"] != 1.0 {
+		t.Errorf("Expected the exit code of a failed command, got %d: %v", status, v)
+	}
+
+	// High risk commands require "yes"
+	status, v = post(t, ts.URL+"/v1/execute", "secret", `{"command": "rm -rf /"}`)
+	if status != http.StatusForbidden || v["result"] == nil {
+		t.Errorf("Expected high risk command to be refused, got %d: %v", status, v)
+	}
+	if status, _ := post(t, ts.URL+"/v1/execute", "secret", `{"command": "rm -rf /", "yes": true}`); status != http.StatusOK {
+		t.Errorf("Expected high risk command to run with yes, got %d", status)
+	}
+	if status, _ := post(t, ts.URL+"/v1/execute", "secret", `{"command": "ls", "prompt": "x"}`); status != http.StatusBadRequest {
+		t.Errorf("Expected %d with both prompt and command, got %d", http.StatusBadRequest, status)
+	}
+
+	if strings.Join(backend.executed, ";") != "ls;false;rm -rf /" {
+		t.Errorf("Unexpected executed commands: %v", backend.executed)
+	}
+}
+
+func TestMaxConcurrent(t *testing.T) {
+	backend := &fakeBackend{response: "ls", block: make(chan struct{})}
+	ts := httptest.NewServer((&Server{Backend: backend, MaxConcurrent: 1}).Handler())
+	defer ts.Close()
+
+	done := make(chan int)
+	go func() {
+		status, _ := post(t, ts.URL+"/v1/generate", "", `{"prompt": "slow"}`)
+		done <- status
+	}()
+
+	// Wait until the first request holds the only slot
+	var status int
+	for i := 0; i < 100; i++ {
+		status, _ = post(t, ts.URL+"/v1/explain", "", `{"command": "ls"}`)
+		if status == http.StatusServiceUnavailable {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if status != http.StatusServiceUnavailable {
+		t.Errorf("Expected %d while busy, got %d", http.StatusServiceUnavailable, status)
+	}
+
+	close(backend.block)
+	if status := <-done; status != http.StatusOK {
+		t.Errorf("Expected the first request to succeed, got %d", status)
+	}
+}
@@ -0,0 +1,130 @@
+package session
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/LubyRuffy/aic/pkg/config"
+	"github.com/LubyRuffy/aic/pkg/injection"
+	"github.com/LubyRuffy/aic/pkg/ollama"
+)
+
+// FileName 是配置目录下会话文件的名称
+const FileName = "session.json"
+
+// MaxOutputSnippet 是会话中保留的命令输出的最大字节数
+const MaxOutputSnippet = 2048
+
+// MaxTurns 是会话中保留的最近对话轮数，每轮包含一条用户消息和一条助手消息，
+// 避免多次 --continue 之后会话文件和提示词无限增长
+const MaxTurns = 5
+
+// ErrNoSession 表示本地还没有保存过会话
+var ErrNoSession = errors.New("no previous session found")
+
+// Session 记录上一次运行的对话消息以及执行的命令，用于 --continue 追问
+type Session struct {
+	Model    string           `json:"model"`
+	Messages []ollama.Message `json:"messages"`
+	Command  string           `json:"command"`
+	Output   string           `json:"output"`
+	// Executed 为true时命令已经被执行，而不是只输出或预览
+	Executed  bool      `json:"executed,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// DefaultPath 返回会话文件的默认保存路径
+func DefaultPath() (string, error) {
+	dir, err := config.Dir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, FileName), nil
+}
+
+// Load 从path读取会话，文件不存在时返回 ErrNoSession
+func Load(path string) (*Session, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, ErrNoSession
+		}
+		return nil, fmt.Errorf("error reading session: %v", err)
+	}
+
+	var s Session
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("error parsing session: %v", err)
+	}
+	return &s, nil
+}
+
+// Save 将会话写入path，必要时创建目录
+func (s *Session) Save(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return fmt.Errorf("error creating session directory: %v", err)
+	}
+
+	s.UpdatedAt = time.Now()
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error serializing session: %v", err)
+	}
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		return fmt.Errorf("error writing session: %v", err)
+	}
+	return nil
+}
+
+// FollowUp 基于上一次会话构建追问的消息列表
+// 新的用户消息中会带上上一次执行的命令和截断后的输出作为上下文
+func (s *Session) FollowUp(prompt string) []ollama.Message {
+	var b strings.Builder
+	if s.Command != "" {
+		fmt.Fprintf(&b, "The previous command was:\n%s\n\n", s.Command)
+		if s.Output != "" {
+			fmt.Fprintf(&b, "Its output (possibly truncated) was:\n%s\n\n", injection.Wrap("command output", s.Output))
+		}
+	}
+	fmt.Fprintf(&b, "Follow-up request: %s", prompt)
+
+	history := recent(s.Messages, MaxTurns-1)
+	messages := make([]ollama.Message, 0, len(history)+1)
+	messages = append(messages, history...)
+	return append(messages, ollama.Message{Role: ollama.RoleUser, Content: b.String()})
+}
+
+// Record 记录本轮的对话和执行结果，只保留最近 MaxTurns 轮对话，output 超过 MaxOutputSnippet 时会被截断
+func (s *Session) Record(model string, messages []ollama.Message, command, output string) {
+	s.Model = model
+	s.Messages = recent(append(messages, ollama.Message{Role: ollama.RoleAssistant, Content: command}), MaxTurns)
+	s.Command = command
+	s.Output = Truncate(output, MaxOutputSnippet)
+	s.Executed = false
+}
+
+// recent 返回messages中最近的turns轮对话，丢弃的部分总是从用户消息开始
+func recent(messages []ollama.Message, turns int) []ollama.Message {
+	if len(messages) <= 2*turns {
+		return messages
+	}
+	messages = messages[len(messages)-2*turns:]
+	for len(messages) > 0 && messages[0].Role != ollama.RoleUser {
+		messages = messages[1:]
+	}
+	return messages
+}
+
+// Truncate 将s截断到最多n个字节，并在截断处加上标记
+func Truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	// 截断处可能把多字节字符切开
+	return strings.ToValidUTF8(s[:n], "") + "\n...(truncated)"
+}
@@ -0,0 +1,92 @@
+package session
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/LubyRuffy/aic/pkg/ollama"
+)
+
+func TestSaveAndLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "aic", "session.json")
+
+	if _, err := Load(path); !errors.Is(err, ErrNoSession) {
+		t.Fatalf("Expected ErrNoSession, got %v", err)
+	}
+
+	s := &Session{}
+	s.Record("test-model", []ollama.Message{{Role: ollama.RoleUser, Content: "list files"}}, "ls -la", "a\nb\n")
+	if err := s.Save(path); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	loaded, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if loaded.Command != "ls -la" || loaded.Model != "test-model" {
+		t.Errorf("Unexpected session: %+v", loaded)
+	}
+	if len(loaded.Messages) != 2 || loaded.Messages[1].Role != ollama.RoleAssistant {
+		t.Errorf("Expected user and assistant messages, got %+v", loaded.Messages)
+	}
+}
+
+func TestFollowUp(t *testing.T) {
+	s := &Session{}
+	s.Record("test-model", []ollama.Message{{Role: ollama.RoleUser, Content: "list files"}}, "ls -la", "main.go\n")
+
+	messages := s.FollowUp("also sort by size")
+	if len(messages) != 3 {
+		t.Fatalf("Expected 3 messages, got %d", len(messages))
+	}
+
+	last := messages[2]
+	if last.Role != ollama.RoleUser {
+		t.Errorf("Expected user role, got %s", last.Role)
+	}
+	for _, want := range []string{"ls -la", "main.go", "also sort by size"} {
+		if !strings.Contains(last.Content, want) {
+			t.Errorf("Expected follow-up to contain %q, got %q", want, last.Content)
+		}
+	}
+}
+
+func TestFollowUpKeepsRecentTurns(t *testing.T) {
+	s := &Session{}
+	messages := []ollama.Message{{Role: ollama.RoleUser, Content: "request 0"}}
+	for i := 1; i <= 2*MaxTurns; i++ {
+		s.Record("test-model", messages, fmt.Sprintf("command %d", i-1), "")
+		messages = s.FollowUp(fmt.Sprintf("request %d", i))
+	}
+
+	if len(s.Messages) != 2*MaxTurns {
+		t.Fatalf("Expected %d messages in the session, got %d", 2*MaxTurns, len(s.Messages))
+	}
+	if len(messages) != 2*MaxTurns-1 || messages[0].Role != ollama.RoleUser {
+		t.Fatalf("Expected %d messages starting with a user message, got %+v", 2*MaxTurns-1, messages)
+	}
+	if last := s.Messages[len(s.Messages)-1].Content; last != fmt.Sprintf("command %d", 2*MaxTurns-1) {
+		t.Errorf("Expected the latest command to be kept, got %q", last)
+	}
+	for _, m := range messages {
+		if strings.Contains(m.Content, "command 0\n") || m.Content == "request 0" {
+			t.Errorf("Expected the oldest turns to be dropped, got %q", m.Content)
+		}
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	if got := Truncate("hello world", 5); got != "hello\n...(truncated)" {
+		t.Errorf("Truncate() = %q", got)
+	}
+	// "文件" is 6 bytes, cutting at 4 must not leave half a character
+	got := Truncate("文件列表", 4)
+	if !utf8.ValidString(got) || got != "文\n...(truncated)" {
+		t.Errorf("Truncate() = %q", got)
+	}
+}
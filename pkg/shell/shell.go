@@ -0,0 +1,165 @@
+package shell
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+// Shell 描述一种shell的调用方式、引号规则以及在提示词中的名称
+// sysinfo 和 executor 都通过这里的注册表选择shell，保证两者一致
+type Shell struct {
+	// Name 是shell的名称，也是 --shell 参数接受的值
+	Name string
+	// PromptName 是在系统提示词中告诉模型的shell名称
+	PromptName string
+	// Executable 是默认的可执行文件名
+	Executable string
+	// Flags 是执行一条命令时放在命令之前的参数
+	Flags []string
+	// Path 是实际使用的可执行文件路径，为空时使用 Executable
+	Path string
+
+	quote func(string) string
+	// aliases 是可执行文件的其他名称
+	aliases []string
+}
+
+// registry 是所有支持的shell
+var registry = []Shell{
+	{Name: "bash", PromptName: "bash", Executable: "bash", Flags: []string{"-c"}, quote: quotePOSIX},
+	{Name: "zsh", PromptName: "zsh", Executable: "zsh", Flags: []string{"-c"}, quote: quotePOSIX},
+	{Name: "sh", PromptName: "sh (POSIX shell)", Executable: "sh", Flags: []string{"-c"}, quote: quotePOSIX, aliases: []string{"dash", "ash", "ksh"}},
+	{Name: "fish", PromptName: "fish (not POSIX compatible)", Executable: "fish", Flags: []string{"-c"}, quote: quoteFish},
+	{Name: "nushell", PromptName: "nushell (nu, not POSIX compatible)", Executable: "nu", Flags: []string{"-c"}, quote: quoteNu, aliases: []string{"nu"}},
+	{Name: "pwsh", PromptName: "PowerShell Core (pwsh)", Executable: "pwsh", Flags: []string{"-NoLogo", "-NoProfile", "-Command"}, quote: quotePowerShell},
+	{Name: "powershell", PromptName: "Windows PowerShell", Executable: "powershell", Flags: []string{"-NoLogo", "-NoProfile", "-Command"}, quote: quotePowerShell},
+	{Name: "cmd", PromptName: "cmd", Executable: "cmd", Flags: []string{"/V:OFF", "/C"}, quote: quoteCmd},
+}
+
+// Names 返回支持的shell名称列表
+func Names() []string {
+	names := make([]string, 0, len(registry))
+	for _, s := range registry {
+		names = append(names, s.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Lookup 根据名称、别名或可执行文件路径查找shell
+func Lookup(name string) (Shell, bool) {
+	// 同时支持Unix和Windows风格的路径
+	base := name
+	if i := strings.LastIndexAny(base, `/\`); i >= 0 {
+		base = base[i+1:]
+	}
+	base = strings.TrimSuffix(strings.ToLower(base), ".exe")
+	for _, s := range registry {
+		if base == s.Name || base == s.Executable || contains(s.aliases, base) {
+			if strings.ContainsAny(name, `/\`) {
+				s.Path = name
+			}
+			return s, true
+		}
+	}
+	return Shell{}, false
+}
+
+// Resolve 返回名称为name的shell，name为空时自动检测当前的shell
+func Resolve(name string) (Shell, error) {
+	if name == "" {
+		return Detect(), nil
+	}
+	s, ok := Lookup(name)
+	if !ok {
+		return Shell{}, fmt.Errorf("unsupported shell %q, supported shells: %s", name, strings.Join(Names(), ", "))
+	}
+	return s, nil
+}
+
+// Detect 根据环境变量检测当前的shell
+// Windows上根据PSModulePath区分PowerShell和cmd，Unix上使用SHELL环境变量，无法识别时使用sh
+func Detect() Shell {
+	if runtime.GOOS == "windows" {
+		if os.Getenv("PSModulePath") != "" {
+			s, _ := Lookup("powershell")
+			return s
+		}
+		s, _ := Lookup("cmd")
+		return s
+	}
+
+	if env := os.Getenv("SHELL"); env != "" {
+		if s, ok := Lookup(env); ok {
+			return s
+		}
+	}
+	s, _ := Lookup("sh")
+	s.Path = "/bin/sh"
+	return s
+}
+
+// Command 返回执行command所需的可执行文件和参数
+func (s Shell) Command(command string) (string, []string) {
+	path := s.Path
+	if path == "" {
+		path = s.Executable
+	}
+	args := make([]string, 0, len(s.Flags)+1)
+	args = append(args, s.Flags...)
+	return path, append(args, command)
+}
+
+// Quote 按照shell的引号规则把arg转义为一个完整的参数
+func (s Shell) Quote(arg string) string {
+	if s.quote == nil {
+		return quotePOSIX(arg)
+	}
+	return s.quote(arg)
+}
+
+// quotePOSIX 使用单引号，参数中的单引号先结束引用，用反斜杠转义后再重新开始引用
+func quotePOSIX(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// quoteFish 使用单引号，单引号和反斜杠需要转义
+func quoteFish(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, "'", `\'`).Replace(s) + "'"
+}
+
+// quoteNu 使用单引号，包含单引号时使用原始字符串
+func quoteNu(s string) string {
+	if !strings.Contains(s, "'") {
+		return "'" + s + "'"
+	}
+	hashes := "#"
+	for strings.Contains(s, "'"+hashes) {
+		hashes += "#"
+	}
+	return "r" + hashes + "'" + s + "'" + hashes
+}
+
+// quotePowerShell 使用单引号，单引号本身转义为两个单引号
+func quotePowerShell(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// quoteCmd 使用双引号，双引号本身转义为两个双引号
+// cmd 在双引号中仍然会展开 %VAR% 和 !VAR!，而 /C 执行的命令行中 %% 不是转义，
+// 所以 % 和 ! 放在引号之外用 ^ 转义，"a%b" 变为 "a"^%"b"；/V:OFF 关闭了延迟展开，^! 只表示 !
+func quoteCmd(s string) string {
+	return `"` + strings.NewReplacer(`"`, `""`, "%", `"^%"`, "!", `"^!"`).Replace(s) + `"`
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,119 @@
+package shell
+
+import (
+	"os"
+	"os/exec"
+	"reflect"
+	"runtime"
+	"testing"
+)
+
+func TestLookup(t *testing.T) {
+	testCases := []struct {
+		name     string
+		expected string
+		path     string
+	}{
+		{"bash", "bash", ""},
+		{"/usr/bin/zsh", "zsh", "/usr/bin/zsh"},
+		{"/usr/local/bin/fish", "fish", "/usr/local/bin/fish"},
+		{"/usr/bin/nu", "nushell", "/usr/bin/nu"},
+		{"nushell", "nushell", ""},
+		{"pwsh", "pwsh", ""},
+		{"/bin/dash", "sh", "/bin/dash"},
+		{`C:\Windows\System32\cmd.exe`, "cmd", `C:\Windows\System32\cmd.exe`},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			s, ok := Lookup(tc.name)
+			if !ok {
+				t.Fatalf("Lookup(%s) not found", tc.name)
+			}
+			if s.Name != tc.expected || s.Path != tc.path {
+				t.Errorf("Lookup(%s) = %s (%s), want %s (%s)", tc.name, s.Name, s.Path, tc.expected, tc.path)
+			}
+		})
+	}
+
+	if _, ok := Lookup("tcsh"); ok {
+		t.Error("Expected tcsh to be unsupported")
+	}
+	if _, err := Resolve("tcsh"); err == nil {
+		t.Error("Expected error for unsupported shell, got nil")
+	}
+}
+
+func TestDetect(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses the SHELL environment variable")
+	}
+
+	original := os.Getenv("SHELL")
+	defer os.Setenv("SHELL", original)
+
+	os.Setenv("SHELL", "/usr/bin/fish")
+	if s := Detect(); s.Name != "fish" || s.Path != "/usr/bin/fish" {
+		t.Errorf("Detect() = %+v, want fish", s)
+	}
+
+	// 无法识别的shell回退到sh
+	os.Setenv("SHELL", "/bin/tcsh")
+	if s := Detect(); s.Name != "sh" || s.Path != "/bin/sh" {
+		t.Errorf("Detect() = %+v, want sh", s)
+	}
+}
+
+func TestCommand(t *testing.T) {
+	s, _ := Lookup("pwsh")
+	path, args := s.Command("Get-ChildItem")
+	if path != "pwsh" || !reflect.DeepEqual(args, []string{"-NoLogo", "-NoProfile", "-Command", "Get-ChildItem"}) {
+		t.Errorf("Command() = %s %v", path, args)
+	}
+
+	s, _ = Lookup("/usr/bin/zsh")
+	path, args = s.Command("ls")
+	if path != "/usr/bin/zsh" || !reflect.DeepEqual(args, []string{"-c", "ls"}) {
+		t.Errorf("Command() = %s %v", path, args)
+	}
+}
+
+func TestQuote(t *testing.T) {
+	testCases := []struct {
+		shell    string
+		arg      string
+		expected string
+	}{
+		{"bash", "it's", `'it'\''s'`},
+		{"fish", `it's \n`, `'it\'s \\n'`},
+		{"nushell", "plain", "'plain'"},
+		{"nushell", "it's", "r#'it's'#"},
+		{"pwsh", "it's", "'it''s'"},
+		{"cmd", `say "hi"`, `"say ""hi"""`},
+		{"cmd", "%PATH% !PATH!", `""^%"PATH"^%" "^!"PATH"^!""`},
+	}
+
+	for _, tc := range testCases {
+		s, _ := Lookup(tc.shell)
+		if got := s.Quote(tc.arg); got != tc.expected {
+			t.Errorf("%s Quote(%q) = %s, want %s", tc.shell, tc.arg, got, tc.expected)
+		}
+	}
+}
+
+func TestQuotePOSIXRoundTrip(t *testing.T) {
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("sh not available")
+	}
+
+	s, _ := Lookup("sh")
+	arg := `a 'b' "c" $HOME; rm -rf /`
+	out, err := exec.Command(sh, "-c", "printf %s "+s.Quote(arg)).Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != arg {
+		t.Errorf("Expected %q, got %q", arg, out)
+	}
+}
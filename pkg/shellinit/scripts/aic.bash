@@ -0,0 +1,12 @@
+# aic shell integration for bash
+# Type a description on the command line and press Alt+A to replace it
+# with the command generated by aic. The command is not executed.
+_aic_widget() {
+  [[ -z "$READLINE_LINE" ]] && return
+  local cmd
+  if cmd="$(aic --print-only -- "$READLINE_LINE")" && [[ -n "$cmd" ]]; then
+    READLINE_LINE="$cmd"
+    READLINE_POINT=${#READLINE_LINE}
+  fi
+}
+bind -x '"\ea": _aic_widget'
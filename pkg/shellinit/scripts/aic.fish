@@ -0,0 +1,15 @@
+# aic shell integration for fish
+# Type a description on the command line and press Alt+A to replace it
+# with the command generated by aic. The command is not executed.
+function _aic_widget
+    set -l buf (commandline)
+    if test -z "$buf"
+        return
+    end
+    set -l cmd (aic --print-only -- "$buf")
+    if test $status -eq 0; and test -n "$cmd"
+        commandline -r -- (string join \n $cmd)
+    end
+    commandline -f repaint
+end
+bind \ea _aic_widget
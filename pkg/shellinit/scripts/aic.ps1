@@ -0,0 +1,13 @@
+# aic shell integration for PowerShell (requires PSReadLine)
+# Type a description on the command line and press Alt+A to replace it
+# with the command generated by aic. The command is not executed.
+Set-PSReadLineKeyHandler -Chord 'Alt+a' -BriefDescription 'aic' -Description 'Replace the current line with a command generated by aic' -ScriptBlock {
+    $line = $null
+    $cursor = $null
+    [Microsoft.PowerShell.PSConsoleReadLine]::GetBufferState([ref]$line, [ref]$cursor)
+    if ([string]::IsNullOrWhiteSpace($line)) { return }
+    $cmd = (& aic --print-only -- $line) -join "`n"
+    if ($LASTEXITCODE -eq 0 -and $cmd) {
+        [Microsoft.PowerShell.PSConsoleReadLine]::Replace(0, $line.Length, $cmd)
+    }
+}
@@ -0,0 +1,44 @@
+package shellinit
+
+import (
+	"embed"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+//go:embed scripts
+var scripts embed.FS
+
+// files 是各个shell对应的集成脚本
+var files = map[string]string{
+	"bash":       "scripts/aic.bash",
+	"zsh":        "scripts/aic.zsh",
+	"fish":       "scripts/aic.fish",
+	"powershell": "scripts/aic.ps1",
+	"pwsh":       "scripts/aic.ps1",
+}
+
+// Shells 返回支持的shell名称列表
+func Shells() []string {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Script 返回指定shell的集成脚本
+func Script(shell string) (string, error) {
+	file, ok := files[strings.ToLower(shell)]
+	if !ok {
+		return "", fmt.Errorf("unsupported shell %q, supported shells: %s", shell, strings.Join(Shells(), ", "))
+	}
+
+	data, err := scripts.ReadFile(file)
+	if err != nil {
+		return "", fmt.Errorf("error reading script for %s: %v", shell, err)
+	}
+	return string(data), nil
+}
@@ -0,0 +1,25 @@
+package shellinit
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestScript(t *testing.T) {
+	for _, shell := range Shells() {
+		t.Run(shell, func(t *testing.T) {
+			script, err := Script(shell)
+			if err != nil {
+				t.Fatalf("Script(%s) error = %v", shell, err)
+			}
+			// 所有的集成脚本都必须只生成命令，不能执行
+			if !strings.Contains(script, "aic --print-only") {
+				t.Errorf("Expected script for %s to call aic --print-only", shell)
+			}
+		})
+	}
+
+	if _, err := Script("tcsh"); err == nil {
+		t.Error("Expected error for unsupported shell, got nil")
+	}
+}
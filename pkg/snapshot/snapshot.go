@@ -0,0 +1,423 @@
+package snapshot
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DirName 是配置目录下保存快照的目录名称
+const DirName = "snapshots"
+
+// 快照的默认限制
+const (
+	DefaultMaxFileSize  = 10 << 20
+	DefaultMaxTotalSize = 100 << 20
+	DefaultKeep         = 20
+)
+
+// manifestName 是快照目录中记录文件列表的文件
+const manifestName = "manifest.json"
+
+// 快照中文件的类型
+const (
+	KindFile    = "file"
+	KindDir     = "dir"
+	KindSymlink = "symlink"
+	// KindMissing 表示执行前不存在的文件，恢复时会被删除
+	KindMissing = "missing"
+)
+
+// ErrNoSnapshot 表示没有可以恢复的快照
+var ErrNoSnapshot = errors.New("no snapshot to restore")
+
+// File 是快照中的一个路径
+type File struct {
+	Path string      `json:"path"`
+	Kind string      `json:"kind"`
+	Mode fs.FileMode `json:"mode,omitempty"`
+	Size int64       `json:"size,omitempty"`
+	// Link 是符号链接的目标
+	Link string `json:"link,omitempty"`
+	// Data 是文件内容在快照目录中的文件名
+	Data string `json:"data,omitempty"`
+}
+
+// Skipped 是没有保存到快照中的路径及原因
+type Skipped struct {
+	Path   string `json:"path"`
+	Reason string `json:"reason"`
+}
+
+// Snapshot 是执行命令前保存的文件
+type Snapshot struct {
+	ID      string    `json:"id"`
+	Time    time.Time `json:"time"`
+	Command string    `json:"command"`
+	// Dir 是执行命令的工作目录，只保存其中的文件
+	Dir     string    `json:"dir"`
+	Files   []File    `json:"files"`
+	Skipped []Skipped `json:"skipped,omitempty"`
+}
+
+// Store 是保存在本地目录中的快照，每个快照一个子目录
+type Store struct {
+	Dir string
+	// MaxFileSize 是单个文件的最大大小，更大的文件不会被保存
+	MaxFileSize int64
+	// MaxTotalSize 是一个快照中所有文件的最大总大小
+	MaxTotalSize int64
+	// Keep 是保留的快照数量，超出时删除最旧的快照
+	Keep int
+}
+
+// New 创建使用默认限制的快照存储
+func New(dir string) *Store {
+	return &Store{Dir: dir, MaxFileSize: DefaultMaxFileSize, MaxTotalSize: DefaultMaxTotalSize, Keep: DefaultKeep}
+}
+
+// Take 在执行command前保存paths，相对路径和通配符相对于工作目录cwd
+// 工作目录之外的路径和超出大小限制的文件不会被保存，记录在 Skipped 中
+// 没有需要保存的路径时返回nil，所有路径都被跳过时返回没有保存到存储中的快照
+func (s *Store) Take(id, command, cwd string, paths []string) (*Snapshot, error) {
+	cwd, err := filepath.Abs(cwd)
+	if err != nil {
+		return nil, fmt.Errorf("error resolving working directory: %v", err)
+	}
+	snap := &Snapshot{ID: id, Time: time.Now(), Command: command, Dir: cwd}
+	t := &taker{store: s, snap: snap, dir: filepath.Join(s.Dir, id), seen: make(map[string]bool)}
+
+	for _, p := range paths {
+		if !filepath.IsAbs(p) {
+			p = filepath.Join(cwd, p)
+		}
+		p = filepath.Clean(p)
+		matches := []string{p}
+		if strings.ContainsAny(p, "*?[") {
+			matches, _ = filepath.Glob(p)
+		}
+		for _, m := range matches {
+			if !within(cwd, m) {
+				snap.Skipped = append(snap.Skipped, Skipped{Path: m, Reason: "outside the working directory"})
+				continue
+			}
+			if err := t.add(m); err != nil {
+				_ = os.RemoveAll(t.dir)
+				return nil, err
+			}
+		}
+	}
+	if len(snap.Files) == 0 {
+		_ = os.RemoveAll(t.dir)
+		if len(snap.Skipped) == 0 {
+			return nil, nil
+		}
+		return snap, nil
+	}
+
+	if err := s.save(snap); err != nil {
+		_ = os.RemoveAll(t.dir)
+		return nil, err
+	}
+	s.prune()
+	return snap, nil
+}
+
+// within 判断path是否在dir中
+func within(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// taker 复制一个快照的文件
+type taker struct {
+	store *Store
+	snap  *Snapshot
+	dir   string
+	seen  map[string]bool
+	total int64
+}
+
+// add 保存path，目录会被递归保存，不跟随符号链接
+func (t *taker) add(path string) error {
+	if t.seen[path] {
+		return nil
+	}
+	info, err := os.Lstat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		t.seen[path] = true
+		t.snap.Files = append(t.snap.Files, File{Path: path, Kind: KindMissing})
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error reading %s: %v", path, err)
+	}
+	if !info.IsDir() {
+		return t.addFile(path, info)
+	}
+	return filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return fmt.Errorf("error reading %s: %v", p, err)
+		}
+		if t.seen[p] {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return fmt.Errorf("error reading %s: %v", p, err)
+		}
+		if d.IsDir() {
+			t.seen[p] = true
+			t.snap.Files = append(t.snap.Files, File{Path: p, Kind: KindDir, Mode: info.Mode().Perm()})
+			return nil
+		}
+		return t.addFile(p, info)
+	})
+}
+
+// addFile 保存普通文件或符号链接，其他类型的文件会被跳过
+func (t *taker) addFile(path string, info fs.FileInfo) error {
+	t.seen[path] = true
+	switch {
+	case info.Mode()&fs.ModeSymlink != 0:
+		link, err := os.Readlink(path)
+		if err != nil {
+			return fmt.Errorf("error reading %s: %v", path, err)
+		}
+		t.snap.Files = append(t.snap.Files, File{Path: path, Kind: KindSymlink, Link: link})
+		return nil
+	case !info.Mode().IsRegular():
+		t.skip(path, "not a regular file")
+		return nil
+	case info.Size() > t.store.MaxFileSize:
+		t.skip(path, fmt.Sprintf("larger than %d bytes", t.store.MaxFileSize))
+		return nil
+	case t.total+info.Size() > t.store.MaxTotalSize:
+		t.skip(path, fmt.Sprintf("snapshot size limit of %d bytes reached", t.store.MaxTotalSize))
+		return nil
+	}
+
+	data := strconv.Itoa(len(t.snap.Files))
+	if err := os.MkdirAll(t.dir, 0o700); err != nil {
+		return fmt.Errorf("error creating snapshot directory: %v", err)
+	}
+	if err := copyFile(path, filepath.Join(t.dir, data), 0o600); err != nil {
+		return err
+	}
+	t.total += info.Size()
+	t.snap.Files = append(t.snap.Files, File{Path: path, Kind: KindFile, Mode: info.Mode().Perm(), Size: info.Size(), Data: data})
+	return nil
+}
+
+func (t *taker) skip(path, reason string) {
+	t.snap.Skipped = append(t.snap.Skipped, Skipped{Path: path, Reason: reason})
+}
+
+// copyFile 把src的内容复制到dst，dst已存在时被覆盖
+func copyFile(src, dst string, mode fs.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("error reading %s: %v", src, err)
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+	if err != nil {
+		return fmt.Errorf("error writing %s: %v", dst, err)
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return fmt.Errorf("error writing %s: %v", dst, err)
+	}
+	if err := out.Close(); err != nil {
+		return fmt.Errorf("error writing %s: %v", dst, err)
+	}
+	return nil
+}
+
+// save 写入快照的文件列表
+func (s *Store) save(snap *Snapshot) error {
+	data, err := json.MarshalIndent(snap, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error serializing snapshot: %v", err)
+	}
+	dir := filepath.Join(s.Dir, snap.ID)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return fmt.Errorf("error creating snapshot directory: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, manifestName), data, 0o600); err != nil {
+		return fmt.Errorf("error writing snapshot: %v", err)
+	}
+	return nil
+}
+
+// prune 删除超出 Keep 数量的最旧的快照
+func (s *Store) prune() {
+	if s.Keep <= 0 {
+		return
+	}
+	ids, err := s.ids()
+	if err != nil {
+		return
+	}
+	for len(ids) > s.Keep {
+		_ = s.Delete(ids[0])
+		ids = ids[1:]
+	}
+}
+
+// ids 返回按时间排序的快照ID
+func (s *Store) ids() ([]string, error) {
+	entries, err := os.ReadDir(s.Dir)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error reading snapshots: %v", err)
+	}
+	var ids []string
+	for _, e := range entries {
+		if e.IsDir() {
+			if _, err := os.Stat(filepath.Join(s.Dir, e.Name(), manifestName)); err == nil {
+				ids = append(ids, e.Name())
+			}
+		}
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// Load 读取ID为id的快照
+func (s *Store) Load(id string) (*Snapshot, error) {
+	if id == "" || id != filepath.Base(id) {
+		return nil, fmt.Errorf("invalid snapshot id %q", id)
+	}
+	data, err := os.ReadFile(filepath.Join(s.Dir, id, manifestName))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("snapshot %q not found", id)
+		}
+		return nil, fmt.Errorf("error reading snapshot: %v", err)
+	}
+	var snap Snapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return nil, fmt.Errorf("error parsing snapshot %s: %v", id, err)
+	}
+	return &snap, nil
+}
+
+// Latest 返回最近的快照，没有快照时返回 ErrNoSnapshot
+func (s *Store) Latest() (*Snapshot, error) {
+	ids, err := s.ids()
+	if err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return nil, ErrNoSnapshot
+	}
+	return s.Load(ids[len(ids)-1])
+}
+
+// Delete 删除ID为id的快照
+func (s *Store) Delete(id string) error {
+	if id == "" || id != filepath.Base(id) {
+		return fmt.Errorf("invalid snapshot id %q", id)
+	}
+	if err := os.RemoveAll(filepath.Join(s.Dir, id)); err != nil {
+		return fmt.Errorf("error deleting snapshot: %v", err)
+	}
+	return nil
+}
+
+// Restore 把文件恢复到快照时的状态：删除执行前不存在的文件，重建目录，写回文件内容、权限和符号链接
+// 快照中目录里新增的文件会被保留
+func (s *Store) Restore(snap *Snapshot) error {
+	var errs []error
+	for _, f := range snap.Files {
+		if f.Kind == KindMissing {
+			if err := os.RemoveAll(f.Path); err != nil {
+				errs = append(errs, fmt.Errorf("error removing %s: %v", f.Path, err))
+			}
+		}
+	}
+	// 目录在其中的文件之前，WalkDir 按此顺序记录
+	for _, f := range snap.Files {
+		var err error
+		switch f.Kind {
+		case KindDir:
+			err = restoreDir(f)
+		case KindFile:
+			err = s.restoreFile(snap, f)
+		case KindSymlink:
+			err = restoreSymlink(f)
+		}
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func restoreDir(f File) error {
+	if info, err := os.Lstat(f.Path); err == nil && !info.IsDir() {
+		if err := os.Remove(f.Path); err != nil {
+			return fmt.Errorf("error restoring %s: %v", f.Path, err)
+		}
+	}
+	if err := os.MkdirAll(f.Path, 0o700); err != nil {
+		return fmt.Errorf("error restoring %s: %v", f.Path, err)
+	}
+	if err := os.Chmod(f.Path, f.Mode); err != nil {
+		return fmt.Errorf("error restoring %s: %v", f.Path, err)
+	}
+	return nil
+}
+
+func (s *Store) restoreFile(snap *Snapshot, f File) error {
+	if err := prepare(f.Path); err != nil {
+		return err
+	}
+	if err := copyFile(filepath.Join(s.Dir, snap.ID, f.Data), f.Path, f.Mode); err != nil {
+		return err
+	}
+	// 文件已存在时 OpenFile 不会修改权限
+	if err := os.Chmod(f.Path, f.Mode); err != nil {
+		return fmt.Errorf("error restoring %s: %v", f.Path, err)
+	}
+	return nil
+}
+
+func restoreSymlink(f File) error {
+	if err := prepare(f.Path); err != nil {
+		return err
+	}
+	if _, err := os.Lstat(f.Path); err == nil {
+		if err := os.Remove(f.Path); err != nil {
+			return fmt.Errorf("error restoring %s: %v", f.Path, err)
+		}
+	}
+	if err := os.Symlink(f.Link, f.Path); err != nil {
+		return fmt.Errorf("error restoring %s: %v", f.Path, err)
+	}
+	return nil
+}
+
+// prepare 创建path的上级目录，path被替换成目录或符号链接时删除它，避免写入到其他位置
+func prepare(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("error restoring %s: %v", path, err)
+	}
+	if info, err := os.Lstat(path); err == nil && (info.IsDir() || info.Mode()&fs.ModeSymlink != 0) {
+		if err := os.RemoveAll(path); err != nil {
+			return fmt.Errorf("error restoring %s: %v", path, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+package snapshot
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestTakeRestore(t *testing.T) {
+	work := t.TempDir()
+	writeFile(t, filepath.Join(work, "a.txt"), "alpha")
+	writeFile(t, filepath.Join(work, "build", "out.bin"), "binary")
+	writeFile(t, filepath.Join(work, "build", "sub", "x.log"), "log")
+	writeFile(t, filepath.Join(work, "one.md"), "one")
+	writeFile(t, filepath.Join(work, "two.md"), "two")
+
+	outside := filepath.Join(filepath.Dir(work), "outside")
+	s := New(filepath.Join(t.TempDir(), DirName))
+	snap, err := s.Take("20260101-000000-0001", "rm -rf build; mv a.txt b.txt", work, []string{"build", "a.txt", "b.txt", "*.md", outside})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snap.Skipped) != 1 || snap.Skipped[0].Path != outside {
+		t.Errorf("Expected paths outside the working directory to be skipped, got %+v", snap.Skipped)
+	}
+
+	// Simulate the command
+	if err := os.RemoveAll(filepath.Join(work, "build")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(filepath.Join(work, "a.txt"), filepath.Join(work, "b.txt")); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(work, "one.md"), "changed")
+	if err := os.Chmod(filepath.Join(work, "two.md"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	latest, err := s.Latest()
+	if err != nil || latest.ID != snap.ID || len(latest.Files) != len(snap.Files) {
+		t.Fatalf("Unexpected latest snapshot %+v, %v", latest, err)
+	}
+	if err := s.Restore(latest); err != nil {
+		t.Fatal(err)
+	}
+	if readFile(t, filepath.Join(work, "a.txt")) != "alpha" || readFile(t, filepath.Join(work, "build", "sub", "x.log")) != "log" || readFile(t, filepath.Join(work, "one.md")) != "one" {
+		t.Error("Expected the files to be restored")
+	}
+	if _, err := os.Stat(filepath.Join(work, "b.txt")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expected b.txt created by the command to be removed, got %v", err)
+	}
+	if info, err := os.Stat(filepath.Join(work, "two.md")); err != nil || (runtime.GOOS != "windows" && info.Mode().Perm() != 0o644) {
+		t.Errorf("Expected the mode to be restored, got %v, %v", info.Mode(), err)
+	}
+
+	if err := s.Delete(snap.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Latest(); !errors.Is(err, ErrNoSnapshot) {
+		t.Errorf("Expected ErrNoSnapshot, got %v", err)
+	}
+}
+
+func TestTakeLimits(t *testing.T) {
+	work := t.TempDir()
+	writeFile(t, filepath.Join(work, "small"), "12345")
+	writeFile(t, filepath.Join(work, "big"), strings.Repeat("x", 100))
+	writeFile(t, filepath.Join(work, "other"), "12345")
+
+	s := &Store{Dir: t.TempDir(), MaxFileSize: 50, MaxTotalSize: 8, Keep: 2}
+	snap, err := s.Take("1", "rm small big other", work, []string{"small", "big", "other"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snap.Files) != 1 || snap.Files[0].Path != filepath.Join(work, "small") || len(snap.Skipped) != 2 {
+		t.Errorf("Unexpected snapshot %+v", snap)
+	}
+
+	// Nothing to save
+	if snap, err := s.Take("2", "ls", work, nil); snap != nil || err != nil {
+		t.Errorf("Expected no snapshot, got %+v, %v", snap, err)
+	}
+
+	// Old snapshots are pruned
+	for _, id := range []string{"2", "3", "4"} {
+		if _, err := s.Take(id, "rm small", work, []string{"small"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if ids, _ := s.ids(); strings.Join(ids, ",") != "3,4" {
+		t.Errorf("Expected the oldest snapshots to be pruned, got %v", ids)
+	}
+	if _, err := s.Load("../x"); err == nil {
+		t.Error("Expected an error for an invalid id")
+	}
+}
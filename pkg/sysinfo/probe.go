@@ -0,0 +1,79 @@
+package sysinfo
+
+import (
+	"sort"
+	"strings"
+)
+
+// ProbeScript 是在远程主机或容器中收集系统信息的POSIX shell脚本，通过 sh -s 从标准输入执行
+// 每行输出一个 key=value，环境变量只输出名称
+const ProbeScript = `echo "os=$(uname -s 2>/dev/null)"
+echo "kernel=$(uname -r 2>/dev/null)"
+if [ -r /etc/os-release ]; then (. /etc/os-release && echo "os_version=$PRETTY_NAME"); fi
+if command -v sw_vers >/dev/null 2>&1; then echo "os_version=macOS $(sw_vers -productVersion)"; fi
+echo "shell=$SHELL"
+echo "user=$(id -un 2>/dev/null || whoami)"
+echo "uid=$(id -u 2>/dev/null)"
+echo "home=$HOME"
+echo "cwd=$(pwd)"
+for t in ` + probeToolList + `; do
+	if command -v "$t" >/dev/null 2>&1; then echo "tool=$t"; fi
+done
+if command -v busybox >/dev/null 2>&1; then busybox --list 2>/dev/null | sed 's/^/applet=/'; fi
+env | sed -n 's/^\([A-Za-z_][A-Za-z0-9_]*\)=.*/env=\1/p'
+`
+
+// probeToolList 是探测的常用工具，告诉模型目标环境中有哪些命令可用
+const probeToolList = "bash zsh fish busybox sudo doas systemctl journalctl docker podman kubectl git curl wget jq awk sed grep rg ss netstat lsof ip ifconfig ps top apt-get dnf yum apk brew python3 nginx"
+
+// ParseProbe 解析 ProbeScript 的输出，未识别的行会被忽略
+func ParseProbe(output string) *SystemInfo {
+	info := &SystemInfo{EnvVars: make(map[string]string)}
+	var kernel string
+	for _, line := range strings.Split(output, "\n") {
+		key, value, ok := strings.Cut(strings.TrimRight(line, "\r"), "=")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "os":
+			info.OS = strings.ToLower(value)
+		case "kernel":
+			kernel = value
+		case "os_version":
+			info.OSVersion = value
+		case "shell":
+			info.Shell = value
+		case "user":
+			info.Username = value
+		case "uid":
+			info.IsRoot = value == "0"
+		case "home":
+			info.HomeDir = value
+		case "cwd":
+			info.CurrentDir = value
+		case "tool":
+			info.Tools = append(info.Tools, value)
+			if value == "sudo" || value == "doas" {
+				info.HasSudo = true
+			}
+		case "applet":
+			info.Applets = append(info.Applets, value)
+		case "env":
+			info.EnvVars[value] = ""
+		}
+	}
+
+	// 与本机的 runtime.GOOS 保持一致，没有发行版信息时使用内核版本
+	if info.OSVersion == "" {
+		info.OSVersion = strings.TrimSpace(kernel)
+	}
+	if info.Shell == "" {
+		info.Shell = "sh"
+	} else if i := strings.LastIndex(info.Shell, "/"); i >= 0 {
+		info.Shell = info.Shell[i+1:]
+	}
+	sort.Strings(info.Tools)
+	sort.Strings(info.Applets)
+	return info
+}
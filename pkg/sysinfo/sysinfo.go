@@ -3,10 +3,12 @@ package sysinfo
 import (
 	"fmt"
 	"os"
+	"os/exec"
 	"os/user"
-	"path/filepath"
 	"runtime"
 	"strings"
+
+	"github.com/LubyRuffy/aic/pkg/shell"
 )
 
 // SystemInfo 包含系统环境的相关信息
@@ -18,6 +20,18 @@ type SystemInfo struct {
 	HomeDir    string
 	CurrentDir string
 	EnvVars    map[string]string // 环境变量列表
+	// Host 是执行命令的远程目标，在本机执行时为空
+	Host string
+	// Tools 是目标环境中可用的常用工具，只在探测远程目标时收集
+	Tools []string
+	// Applets 是BusyBox提供的命令，这些命令支持的选项比GNU版本少
+	Applets []string
+	// IsRoot 表示以root用户执行命令，Windows上总是为false
+	IsRoot bool
+	// HasSudo 表示可以通过sudo或doas提权
+	HasSudo bool
+	// SudoDisabled 表示用户禁止了提权（--no-sudo），模型不应该生成需要提权的命令
+	SudoDisabled bool
 }
 
 // GetSystemInfo 获取当前系统的环境信息
@@ -34,19 +48,8 @@ func GetSystemInfo() (*SystemInfo, error) {
 		return nil, fmt.Errorf("error getting current directory: %v", err)
 	}
 
-	// 获取shell类型
-	shell := os.Getenv("SHELL")
-	if runtime.GOOS == "windows" {
-		// 在Windows上检查是否是PowerShell
-		if os.Getenv("PSModulePath") != "" {
-			shell = "powershell"
-		} else {
-			shell = "cmd"
-		}
-	} else {
-		// 对于Unix系统，从SHELL环境变量中提取shell名称
-		shell = filepath.Base(shell)
-	}
+	// 获取shell类型，与执行命令时使用的shell保持一致
+	shell := shell.Detect().Name
 
 	// 获取环境变量
 	envVars := make(map[string]string)
@@ -65,9 +68,35 @@ func GetSystemInfo() (*SystemInfo, error) {
 		HomeDir:    currentUser.HomeDir,
 		CurrentDir: cwd,
 		EnvVars:    envVars,
+		IsRoot:     os.Geteuid() == 0,
+		HasSudo:    hasSudo(),
 	}, nil
 }
 
+// hasSudo 判断PATH中是否有sudo或doas
+func hasSudo() bool {
+	for _, name := range []string{"sudo", "doas"} {
+		if _, err := exec.LookPath(name); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// Privileges 返回告诉模型的权限说明
+func (i *SystemInfo) Privileges() string {
+	switch {
+	case i.IsRoot:
+		return "running as root, do not prefix commands with sudo"
+	case i.SudoDisabled:
+		return "regular user, privilege escalation is not allowed: never use sudo, doas or su, prefer commands that work without root"
+	case i.HasSudo:
+		return "regular user with sudo available, only prefix commands with sudo when they need root privileges"
+	default:
+		return "regular user without sudo, do not use sudo"
+	}
+}
+
 // getOSVersion 获取操作系统版本
 func getOSVersion() string {
 	switch runtime.GOOS {
@@ -120,3 +120,36 @@ func TestGetOSVersion(t *testing.T) {
 		}
 	}
 }
+
+func TestParseProbe(t *testing.T) {
+	info := ParseProbe("os=Linux\nkernel=6.1.0\nos_version=Alpine Linux v3.19\nshell=/bin/ash\nuser=root\nuid=0\nhome=/root\ncwd=/app\ntool=git\ntool=busybox\napplet=ls\napplet=grep\nenv=PATH\nenv=HOME\nnoise\n")
+	if info.OS != "linux" || info.OSVersion != "Alpine Linux v3.19" || info.Shell != "ash" || info.Username != "root" || info.HomeDir != "/root" || info.CurrentDir != "/app" || !info.IsRoot {
+		t.Errorf("Unexpected system info: %+v", info)
+	}
+	if strings.Join(info.Tools, ",") != "busybox,git" || strings.Join(info.Applets, ",") != "grep,ls" || len(info.EnvVars) != 2 {
+		t.Errorf("Unexpected tools or environment: %v %v %v", info.Tools, info.Applets, info.EnvVars)
+	}
+
+	// Without os-release the kernel version is used, and sh without SHELL
+	info = ParseProbe("os=Darwin\nkernel=23.1.0\nuid=501\ntool=sudo\n")
+	if info.OS != "darwin" || info.OSVersion != "23.1.0" || info.Shell != "sh" || info.IsRoot || !info.HasSudo {
+		t.Errorf("Unexpected system info: %+v", info)
+	}
+}
+
+func TestPrivileges(t *testing.T) {
+	tests := []struct {
+		info SystemInfo
+		want string
+	}{
+		{SystemInfo{IsRoot: true, HasSudo: true, SudoDisabled: true}, "running as root"},
+		{SystemInfo{HasSudo: true, SudoDisabled: true}, "privilege escalation is not allowed"},
+		{SystemInfo{HasSudo: true}, "sudo available"},
+		{SystemInfo{}, "without sudo"},
+	}
+	for _, tt := range tests {
+		if got := tt.info.Privileges(); !strings.Contains(got, tt.want) {
+			t.Errorf("Privileges() of %+v = %q, want %q", tt.info, got, tt.want)
+		}
+	}
+}